@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -10,8 +12,39 @@ import (
 Env list
 ACCESS_TOKEN_SECRET
 REFRESH_TOKEN_SECRET
+CURSOR_SECRET (optional, signs pagination cursors, default ACCESS_TOKEN_SECRET)
 MONGODB_USERNAME
 MONGODB_PASSWORD
+REACTION_EMOJIS (optional, comma separated, default heart,thumbsup,laugh,wow,sad,fire)
+METADATA_SERVICE_ENDPOINT_URL (optional, fetch link previews through an external metadata service)
+METADATA_TIMEOUT_SECONDS (optional, default 5)
+METADATA_MAX_BYTES (optional, default 1048576)
+METADATA_MAX_REDIRECTS (optional, default 5)
+METADATA_ALLOWED_PORTS (optional, comma separated, default 80,443)
+METADATA_CACHE_TTL_HOURS (optional, default 24)
+METADATA_CACHE_REFRESH_MINUTES (optional, default 60)
+METADATA_CACHE_NEGATIVE_SECONDS (optional, default 300)
+TRENDING_WINDOW_MINUTES (optional, default 60)
+TRENDING_BASELINE_HOURS (optional, default 24)
+TRENDING_INTERVAL_MINUTES (optional, default 5)
+TRENDING_MIN_USERS (optional, default 3)
+POST_SCHEDULER_INTERVAL_SECONDS (optional, default 15)
+MEDIA_MAX_UPLOAD_BYTES (optional, default 10485760)
+MEDIA_MAX_VIDEO_BYTES (optional, default 52428800)
+MEDIA_MAX_VIDEO_SECONDS (optional, default 140)
+MEDIA_WORKER_INTERVAL_SECONDS (optional, default 5)
+MEDIA_GC_INTERVAL_MINUTES (optional, default 60)
+MEDIA_GC_GRACE_HOURS (optional, default 24)
+COUNTER_RECONCILE_INTERVAL_MINUTES (optional, default 60)
+TIMELINE_FANOUT_MAX_FOLLOWERS (optional, default 10000)
+TIMELINE_BACKFILL_POSTS (optional, default 200)
+FFMPEG_PATH (optional, default ffmpeg)
+FFPROBE_PATH (optional, default ffprobe)
+STORAGE_DRIVER (optional, imagekit, local or s3, default imagekit)
+LOCAL_STORAGE_DIR (optional, default ./uploads)
+LOCAL_STORAGE_BASE_URL (optional, default /uploads)
+S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY (required for s3)
+S3_PUBLIC_URL (optional, default S3_ENDPOINT/S3_BUCKET)
 
 Below will be consumed automatically
 IMAGEKIT_PUBLIC_KEY: public_+3rAkPsHz8APem/ZFrHbJspD3VI=
@@ -22,10 +55,53 @@ IMAGEKIT_ENDPOINT_URL: https://ik.imagekit.io/tipbk
 type EnvConfig struct {
 	AccessTokenSecret  string
 	RefreshTokenSecret string
+	CursorSecret       string
 	MongodbUsername    string
 	MongodbPassword    string
 	DatabaseName       string
-	MetadataEndpoint   string
+	ReactionEmojis     []string
+	// link previews are fetched by the service itself unless an external endpoint is set, see service.NewMetadataFetcher
+	MetadataEndpoint       string
+	MetadataTimeoutSeconds int
+	MetadataMaxBytes       int64
+	MetadataMaxRedirects   int
+	MetadataAllowedPorts   []int
+	// previews are cached per canonical url, failed ones only briefly
+	MetadataCacheTtlHours        int
+	MetadataCacheRefreshMinutes  int
+	MetadataCacheNegativeSeconds int
+	// trending compares the recent window against the baseline before it
+	TrendingWindowMinutes   int
+	TrendingBaselineHours   int
+	TrendingIntervalMinutes int
+	TrendingMinUsers        int
+	// how often the leader replica publishes due scheduled posts
+	PostSchedulerIntervalSeconds int
+	MediaMaxUploadBytes          int64
+	// videos and gifs are checked with ffprobe and ffmpeg by the media worker
+	MediaMaxVideoBytes         int64
+	MediaMaxVideoSeconds       int
+	MediaWorkerIntervalSeconds int
+	FfmpegPath                 string
+	FfprobePath                string
+	// unused uploads and unreferenced files are only removed once they are older than the grace period
+	MediaGcIntervalMinutes int
+	MediaGcGraceHours      int
+	// how often the like and comment counters on posts are recounted
+	CounterReconcileIntervalMinutes int
+	// accounts with more followers than this are merged into timelines when read instead of fanned out
+	TimelineFanoutMaxFollowers int
+	TimelineBackfillPosts      int
+	// where uploaded media is stored, see service.NewStorageDriver
+	StorageDriver       string
+	LocalStorageDir     string
+	LocalStorageBaseUrl string
+	S3Endpoint          string
+	S3Region            string
+	S3Bucket            string
+	S3AccessKeyID       string
+	S3SecretAccessKey   string
+	S3PublicUrl         string
 }
 
 func GetEnvConfig() *EnvConfig {
@@ -34,9 +110,98 @@ func GetEnvConfig() *EnvConfig {
 	return &EnvConfig{
 		AccessTokenSecret:  os.Getenv("ACCESS_TOKEN_SECRET"),
 		RefreshTokenSecret: os.Getenv("REFRESH_TOKEN_SECRET"),
+		CursorSecret:       getEnvString("CURSOR_SECRET", os.Getenv("ACCESS_TOKEN_SECRET")),
 		MongodbUsername:    os.Getenv("MONGODB_USERNAME"),
 		MongodbPassword:    os.Getenv("MONGODB_PASSWORD"),
 		DatabaseName:       os.Getenv("DATABASE_NAME"),
-		MetadataEndpoint:   os.Getenv("METADATA_SERVICE_ENDPOINT_URL"),
+		ReactionEmojis:     getReactionEmojis(),
+
+		MetadataEndpoint:       os.Getenv("METADATA_SERVICE_ENDPOINT_URL"),
+		MetadataTimeoutSeconds: getEnvInt("METADATA_TIMEOUT_SECONDS", 5),
+		MetadataMaxBytes:       int64(getEnvInt("METADATA_MAX_BYTES", 1024*1024)),
+		MetadataMaxRedirects:   getEnvInt("METADATA_MAX_REDIRECTS", 5),
+		MetadataAllowedPorts:   getEnvInts("METADATA_ALLOWED_PORTS", []int{80, 443}),
+
+		MetadataCacheTtlHours:        getEnvInt("METADATA_CACHE_TTL_HOURS", 24),
+		MetadataCacheRefreshMinutes:  getEnvInt("METADATA_CACHE_REFRESH_MINUTES", 60),
+		MetadataCacheNegativeSeconds: getEnvInt("METADATA_CACHE_NEGATIVE_SECONDS", 300),
+
+		TrendingWindowMinutes:   getEnvInt("TRENDING_WINDOW_MINUTES", 60),
+		TrendingBaselineHours:   getEnvInt("TRENDING_BASELINE_HOURS", 24),
+		TrendingIntervalMinutes: getEnvInt("TRENDING_INTERVAL_MINUTES", 5),
+		TrendingMinUsers:        getEnvInt("TRENDING_MIN_USERS", 3),
+
+		PostSchedulerIntervalSeconds: getEnvInt("POST_SCHEDULER_INTERVAL_SECONDS", 15),
+		MediaMaxUploadBytes:          int64(getEnvInt("MEDIA_MAX_UPLOAD_BYTES", 10*1024*1024)),
+		MediaMaxVideoBytes:           int64(getEnvInt("MEDIA_MAX_VIDEO_BYTES", 50*1024*1024)),
+		MediaMaxVideoSeconds:         getEnvInt("MEDIA_MAX_VIDEO_SECONDS", 140),
+		MediaWorkerIntervalSeconds:   getEnvInt("MEDIA_WORKER_INTERVAL_SECONDS", 5),
+		FfmpegPath:                   getEnvString("FFMPEG_PATH", "ffmpeg"),
+		FfprobePath:                  getEnvString("FFPROBE_PATH", "ffprobe"),
+		MediaGcIntervalMinutes:       getEnvInt("MEDIA_GC_INTERVAL_MINUTES", 60),
+		MediaGcGraceHours:            getEnvInt("MEDIA_GC_GRACE_HOURS", 24),
+
+		CounterReconcileIntervalMinutes: getEnvInt("COUNTER_RECONCILE_INTERVAL_MINUTES", 60),
+
+		TimelineFanoutMaxFollowers: getEnvInt("TIMELINE_FANOUT_MAX_FOLLOWERS", 10000),
+		TimelineBackfillPosts:      getEnvInt("TIMELINE_BACKFILL_POSTS", 200),
+
+		StorageDriver:       getEnvString("STORAGE_DRIVER", "imagekit"),
+		LocalStorageDir:     getEnvString("LOCAL_STORAGE_DIR", "./uploads"),
+		LocalStorageBaseUrl: getEnvString("LOCAL_STORAGE_BASE_URL", "/uploads"),
+		S3Endpoint:          os.Getenv("S3_ENDPOINT"),
+		S3Region:            getEnvString("S3_REGION", "us-east-1"),
+		S3Bucket:            os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:       os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:   os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3PublicUrl:         os.Getenv("S3_PUBLIC_URL"),
+	}
+}
+
+func getEnvString(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvInts reads a comma separated list, falling back to the default when nothing valid is set
+func getEnvInts(key string, defaultValue []int) []int {
+	values := []int{}
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(item))
+		if err == nil && value > 0 {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+// heart is always allowed because likes are exposed as the heart reaction
+func getReactionEmojis() []string {
+	value := os.Getenv("REACTION_EMOJIS")
+	if value == "" {
+		value = "heart,thumbsup,laugh,wow,sad,fire"
+	}
+	emojis := []string{"heart"}
+	for _, emoji := range strings.Split(value, ",") {
+		emoji = strings.TrimSpace(emoji)
+		if emoji == "" || emoji == "heart" {
+			continue
+		}
+		emojis = append(emojis, emoji)
 	}
+	return emojis
 }
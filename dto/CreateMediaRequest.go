@@ -0,0 +1,8 @@
+package dto
+
+// CreateMediaRequest takes either a mediaID from POST /media or an inline imageBase64
+type CreateMediaRequest struct {
+	MediaID     string `json:"mediaID"`
+	ImageBase64 string `json:"imageBase64"`
+	AltText     string `json:"altText"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+import "time"
+
+type CreatePollRequest struct {
+	Options   []string   `json:"options"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
@@ -1,11 +1,13 @@
 package dto
 
+import "time"
+
+// CreatePostRequest has no og fields, the link preview is fetched by the server from the first link in Content
 type CreatePostRequest struct {
-	Content       string  `json:"content"`
-	ImageBase64   *string `json:"imageBase64"`
-	OgTitle       *string `json:"ogTitle"`
-	OgDescription *string `json:"ogDescription"`
-	OgLink        *string `json:"ogLink"`
-	OgImage       *string `json:"ogImage"`
-	OgDomain      *string `json:"ogDomain"`
+	Content     string               `json:"content"`
+	ImageBase64 *string              `json:"imageBase64"`
+	QuotePostID *string              `json:"quotePostID"`
+	Poll        *CreatePollRequest   `json:"poll"`
+	PublishAt   *time.Time           `json:"publishAt"`
+	Media       []CreateMediaRequest `json:"media"`
 }
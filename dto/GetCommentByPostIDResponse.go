@@ -1,13 +1,27 @@
 package dto
 
-import "time"
+import (
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/model"
+)
 
 type GetCommentByPostIDResponse struct {
-	Content         string     `json:"content"`
-	CreatedDatetime *time.Time `json:"createdDatetime"`
-	UserID          string     `json:"userID"`
-	Username        string     `json:"username"`
-	DisplayName     string     `json:"displayName"`
-	ProfileImage    string     `json:"profileImage"`
-	CommentID       string     `json:"commentID"`
+	Content         string                `json:"content"`
+	CreatedDatetime *time.Time            `json:"createdDatetime"`
+	UpdatedDatetime *time.Time            `json:"updatedDatetime"`
+	UserID          string                `json:"userID"`
+	Username        string                `json:"username"`
+	DisplayName     string                `json:"displayName"`
+	ProfileImage    string                `json:"profileImage"`
+	CommentID       string                `json:"commentID"`
+	IsDeleted       bool                  `json:"isDeleted"`
+	TotalLikes      int                   `json:"totalLikes"`
+	IsLike          bool                  `json:"isLike"`
+	Mentions        []model.MentionEntity `json:"mentions"`
+}
+
+type GetCommentsByPostIDResponse struct {
+	Pagination model.Pagination             `json:"pagination"`
+	Comments   []GetCommentByPostIDResponse `json:"comments"`
 }
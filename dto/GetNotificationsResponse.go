@@ -0,0 +1,8 @@
+package dto
+
+import "github.com/tipbk/sneakfeed-service/model"
+
+type GetNotificationsResponse struct {
+	Pagination    model.Pagination     `json:"pagination"`
+	Notifications []model.Notification `json:"notifications"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+import "time"
+
+type ReschedulePostRequest struct {
+	PublishAt *time.Time `json:"publishAt"`
+}
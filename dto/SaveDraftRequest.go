@@ -0,0 +1,7 @@
+package dto
+
+type SaveDraftRequest struct {
+	Content     string  `json:"content"`
+	ImageBase64 *string `json:"imageBase64"`
+	RemoveImage bool    `json:"removeImage"`
+}
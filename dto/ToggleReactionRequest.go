@@ -0,0 +1,5 @@
+package dto
+
+type ToggleReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
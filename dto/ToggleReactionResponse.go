@@ -0,0 +1,6 @@
+package dto
+
+type ToggleReactionResponse struct {
+	Emoji     string `json:"emoji"`
+	IsReacted bool   `json:"isReacted"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type ToggleRepostResponse struct {
+	IsRepost bool `json:"isRepost"`
+}
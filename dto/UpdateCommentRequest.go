@@ -0,0 +1,5 @@
+package dto
+
+type UpdateCommentRequest struct {
+	Content string `json:"content"`
+}
@@ -2,5 +2,7 @@ package dto
 
 type UpdateUserProfileRequest struct {
 	ImageBase64 string `json:"imageBase64"`
-	DisplayName string `json:"displayName"`
+	// ProfileImageMediaID references an upload from POST /media and wins over imageBase64
+	ProfileImageMediaID string `json:"profileImageMediaID"`
+	DisplayName         string `json:"displayName"`
 }
@@ -0,0 +1,5 @@
+package dto
+
+type VotePollRequest struct {
+	OptionIndex *int `json:"optionIndex"`
+}
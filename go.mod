@@ -46,3 +46,8 @@ require (
 	gopkg.in/validator.v2 v2.0.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+require (
+	github.com/buckket/go-blurhash v1.1.0
+	golang.org/x/image v0.15.0
+)
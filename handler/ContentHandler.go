@@ -1,8 +1,8 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tipbk/sneakfeed-service/dto"
@@ -16,22 +16,33 @@ type ContentHandler interface {
 	AddComment(c *gin.Context)
 	GetPosts(c *gin.Context)
 	GetPostByID(c *gin.Context)
+	GetPostsByHashtag(c *gin.Context)
 	GetCommentByPostID(c *gin.Context)
 	ToggleLikePostByID(c *gin.Context)
+	LikePostByID(c *gin.Context)
+	UnlikePostByID(c *gin.Context)
 	GetMetadata(c *gin.Context)
+	UpdateComment(c *gin.Context)
+	DeleteComment(c *gin.Context)
+	ToggleLikeCommentByID(c *gin.Context)
+	ToggleReactionPostByID(c *gin.Context)
+	ToggleRepostPostByID(c *gin.Context)
+	VotePoll(c *gin.Context)
+	GetScheduledPosts(c *gin.Context)
+	ReschedulePost(c *gin.Context)
+	CancelScheduledPost(c *gin.Context)
+	GetReactionEmojis(c *gin.Context)
 }
 
 type contentHandler struct {
-	contentService     service.ContentService
-	userService        service.UserService
-	imageUploadService service.ImageUploaderService
+	contentService service.ContentService
+	userService    service.UserService
 }
 
-func NewContentHandler(contentService service.ContentService, userService service.UserService, imageUploadService service.ImageUploaderService) ContentHandler {
+func NewContentHandler(contentService service.ContentService, userService service.UserService) ContentHandler {
 	return &contentHandler{
-		contentService:     contentService,
-		userService:        userService,
-		imageUploadService: imageUploadService,
+		contentService: contentService,
+		userService:    userService,
 	}
 }
 
@@ -46,29 +57,43 @@ func (h *contentHandler) CreatePost(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
 		return
 	}
-	if createPostRequest.Content == "" {
-		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("content cannot be empty"))
-		return
+
+	var poll *model.Poll
+	if createPostRequest.Poll != nil {
+		poll = &model.Poll{
+			Options:         createPostRequest.Poll.Options,
+			ExpiresDatetime: createPostRequest.Poll.ExpiresAt,
+		}
 	}
 
-	var imageUrl *string
+	// the single imageBase64 field is treated as the first gallery image
+	mediaRequests := []dto.CreateMediaRequest{}
 	if createPostRequest.ImageBase64 != nil {
-		uploadResponse, err := h.imageUploadService.UploadImage(*createPostRequest.ImageBase64)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
-			return
-		}
-		imageUrl = &uploadResponse.Data.Url
+		mediaRequests = append(mediaRequests, dto.CreateMediaRequest{ImageBase64: *createPostRequest.ImageBase64})
 	}
-	postID, err := h.contentService.CreatePost(user.ID.Hex(), createPostRequest.Content, imageUrl, createPostRequest.OgTitle, createPostRequest.OgDescription, createPostRequest.OgLink, createPostRequest.OgImage, createPostRequest.OgDomain)
+	mediaRequests = append(mediaRequests, createPostRequest.Media...)
+	postID, err := h.contentService.CreatePost(user.ID.Hex(), createPostRequest.Content, nil, createPostRequest.QuotePostID, poll, createPostRequest.PublishAt, mediaRequests)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		c.JSON(createPostErrorStatus(err), util.GenerateFailedResponse(err.Error()))
 		return
 	}
 
 	c.JSON(http.StatusOK, util.GenerateSuccessResponse(postID))
 }
 
+// createPostErrorStatus tells the client's mistakes in a new post apart from failures on our side
+func createPostErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrEmptyContent), errors.Is(err, service.ErrInvalidPost):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrMediaTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrUnsupportedMimeType):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
 // comment on post
 func (h *contentHandler) AddComment(c *gin.Context) {
 	postID := c.Param("postID")
@@ -107,27 +132,7 @@ func (h *contentHandler) GetPosts(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
 		return
 	}
-	timeFromString := c.Query("from")
-	var timeFrom *time.Time
-
-	if timeFromString != "" {
-		t, err := util.ParseStringToTime(timeFromString)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
-			return
-		}
-		addedTime := t.Add(time.Millisecond * -1)
-		timeFrom = &addedTime
-	}
-
-	limitString := c.Query("limit")
-	limit := 5
-	if limitString != "" {
-		limit, err = util.ConvertStringToInt(limitString)
-		if err != nil {
-			limit = 5
-		}
-	}
+	cursor, limit := parsePaging(c, 5)
 
 	var posts *model.PostDetailPagination
 	filter := c.Query("filter")
@@ -138,7 +143,11 @@ func (h *contentHandler) GetPosts(c *gin.Context) {
 		return
 	}
 
-	posts, err = h.contentService.GetPosts(user.ID.Hex(), limit, timeFrom, filter, username)
+	posts, err = h.contentService.GetPosts(user.ID.Hex(), limit, cursor, filter, username)
+	if errors.Is(err, util.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
 		return
@@ -147,6 +156,46 @@ func (h *contentHandler) GetPosts(c *gin.Context) {
 	c.JSON(http.StatusOK, util.GenerateSuccessResponse(posts))
 }
 
+func (h *contentHandler) GetPostsByHashtag(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	cursor, limit := parsePaging(c, 5)
+	tag := util.NormalizeHashtag(c.Param("tag"))
+	if tag == "" {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("tag cannot be empty"))
+		return
+	}
+
+	posts, err := h.contentService.GetPostsByHashtag(user.ID.Hex(), limit, cursor, tag)
+	if errors.Is(err, util.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(posts))
+}
+
+const maxPageLimit = 100
+
+// parsePaging reads the cursor and limit query used by every list, the cursor is checked by the service
+func parsePaging(c *gin.Context, defaultLimit int) (string, int) {
+	limit, err := util.ConvertStringToInt(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return c.Query("cursor"), limit
+}
+
 func (h *contentHandler) GetPostByID(c *gin.Context) {
 	user, err := util.GetUserFromContext(c)
 	if err != nil {
@@ -164,40 +213,146 @@ func (h *contentHandler) GetPostByID(c *gin.Context) {
 }
 
 func (h *contentHandler) GetCommentByPostID(c *gin.Context) {
+	currentUser, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
 	postID := c.Param("postID")
-	comments, err := h.contentService.GetCommentFromPostID(postID)
+	cursor, limit := parsePaging(c, 20)
+	comments, pagination, err := h.contentService.GetCommentFromPostID(postID, limit, cursor)
+	if errors.Is(err, util.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
 		return
 	}
 	// get user profile
 	userIDs := []string{}
+	commentIDs := []string{}
 	for _, comment := range comments {
 		userIDs = append(userIDs, comment.UserID)
+		commentIDs = append(commentIDs, comment.ID.Hex())
 	}
 	users, err := h.userService.GetUsersByIDList(userIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
 		return
 	}
+	likeSummaryMap, err := h.contentService.GetCommentLikeSummaries(currentUser.ID.Hex(), commentIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
 	userMap := make(map[string]model.User)
 	for _, user := range users {
 		userMap[user.ID.Hex()] = user
 	}
 	responses := []dto.GetCommentByPostIDResponse{}
 	for _, comment := range comments {
+		// keep deleted comments in the thread as a placeholder without exposing the author
+		if comment.IsDeleted {
+			responses = append(responses, dto.GetCommentByPostIDResponse{
+				Content:         "[deleted]",
+				CreatedDatetime: comment.CreatedDatetime,
+				CommentID:       comment.ID.Hex(),
+				IsDeleted:       true,
+			})
+			continue
+		}
 		responses = append(responses, dto.GetCommentByPostIDResponse{
 			Content:         comment.Content,
 			CreatedDatetime: comment.CreatedDatetime,
+			UpdatedDatetime: comment.UpdatedDatetime,
 			UserID:          comment.UserID,
 			Username:        userMap[comment.UserID].Username,
 			DisplayName:     userMap[comment.UserID].DisplayName,
 			ProfileImage:    userMap[comment.UserID].ProfileImage,
 			CommentID:       comment.ID.Hex(),
+			TotalLikes:      likeSummaryMap[comment.ID.Hex()].TotalLikes,
+			IsLike:          likeSummaryMap[comment.ID.Hex()].IsLike,
+			Mentions:        comment.Mentions,
 		})
 
 	}
-	c.JSON(http.StatusOK, util.GenerateSuccessResponse(responses))
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.GetCommentsByPostIDResponse{
+		Pagination: *pagination,
+		Comments:   responses,
+	}))
+}
+
+// only the comment author can edit a comment
+func (h *contentHandler) UpdateComment(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	postID := c.Param("postID")
+	commentID := c.Param("commentID")
+	var request dto.UpdateCommentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("body parse error: invalid json"))
+		return
+	}
+	if request.Content == "" {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("content cannot be empty"))
+		return
+	}
+
+	comment, err := h.contentService.FindComment(commentID)
+	if err != nil || comment.PostID != postID || comment.IsDeleted {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse("comment doesn't exist"))
+		return
+	}
+	if comment.UserID != user.ID.Hex() {
+		c.JSON(http.StatusForbidden, util.GenerateFailedResponse("you cannot edit this comment"))
+		return
+	}
+
+	err = h.contentService.UpdateComment(commentID, request.Content)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(commentID))
+}
+
+// comment author or post author can delete a comment
+func (h *contentHandler) DeleteComment(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	postID := c.Param("postID")
+	commentID := c.Param("commentID")
+
+	comment, err := h.contentService.FindComment(commentID)
+	if err != nil || comment.PostID != postID || comment.IsDeleted {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse("comment doesn't exist"))
+		return
+	}
+	post, err := h.contentService.FindPost(postID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse("post doesn't exist"))
+		return
+	}
+	if comment.UserID != user.ID.Hex() && post.UserID != user.ID.Hex() {
+		c.JSON(http.StatusForbidden, util.GenerateFailedResponse("you cannot delete this comment"))
+		return
+	}
+
+	err = h.contentService.DeleteComment(commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse("deleted"))
 }
 
 func (h *contentHandler) ToggleLikePostByID(c *gin.Context) {
@@ -220,6 +375,193 @@ func (h *contentHandler) ToggleLikePostByID(c *gin.Context) {
 	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.ToggleLikeResponse{IsLike: isLike}))
 }
 
+// LikePostByID and UnlikePostByID set the like instead of flipping it, so double taps and retries are safe
+func (h *contentHandler) LikePostByID(c *gin.Context) {
+	h.setLikeOnPost(c, true)
+}
+
+func (h *contentHandler) UnlikePostByID(c *gin.Context) {
+	h.setLikeOnPost(c, false)
+}
+
+func (h *contentHandler) setLikeOnPost(c *gin.Context, isLike bool) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	postID := c.Param("postID")
+	_, err = h.contentService.FindPost(postID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse("post doesn't exist"))
+		return
+	}
+	if isLike {
+		err = h.contentService.LikePost(user.ID.Hex(), postID)
+	} else {
+		err = h.contentService.UnlikePost(user.ID.Hex(), postID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.ToggleLikeResponse{IsLike: isLike}))
+}
+
+func (h *contentHandler) ToggleLikeCommentByID(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	postID := c.Param("postID")
+	commentID := c.Param("commentID")
+	comment, err := h.contentService.FindComment(commentID)
+	if err != nil || comment.PostID != postID || comment.IsDeleted {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse("comment doesn't exist"))
+		return
+	}
+	isLike, err := h.contentService.ToggleLikeOnComment(user.ID.Hex(), postID, commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.ToggleLikeResponse{IsLike: isLike}))
+}
+
+func (h *contentHandler) ToggleReactionPostByID(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	var request dto.ToggleReactionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	if request.Emoji == "" {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("emoji cannot be empty"))
+		return
+	}
+	postID := c.Param("postID")
+	_, err = h.contentService.FindPost(postID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	isReacted, err := h.contentService.ToggleReactionOnPost(user.ID.Hex(), postID, request.Emoji)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.ToggleReactionResponse{Emoji: request.Emoji, IsReacted: isReacted}))
+}
+
+func (h *contentHandler) ToggleRepostPostByID(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	postID := c.Param("postID")
+	_, err = h.contentService.FindPost(postID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	isRepost, err := h.contentService.ToggleRepostOnPost(user.ID.Hex(), postID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.ToggleRepostResponse{IsRepost: isRepost}))
+}
+
+func (h *contentHandler) VotePoll(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	var request dto.VotePollRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	if request.OptionIndex == nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("optionIndex cannot be empty"))
+		return
+	}
+	postID := c.Param("postID")
+	pollResult, err := h.contentService.VotePoll(user.ID.Hex(), postID, *request.OptionIndex)
+	if err != nil {
+		if err == service.ErrPollAlreadyVoted {
+			c.JSON(http.StatusConflict, util.GenerateFailedResponse(err.Error()))
+			return
+		}
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(pollResult))
+}
+
+func (h *contentHandler) GetScheduledPosts(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	posts, err := h.contentService.GetScheduledPosts(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(posts))
+}
+
+func (h *contentHandler) ReschedulePost(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	var request dto.ReschedulePostRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	if request.PublishAt == nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("publishAt cannot be empty"))
+		return
+	}
+	postID := c.Param("postID")
+	err = h.contentService.ReschedulePost(user.ID.Hex(), postID, *request.PublishAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(postID))
+}
+
+func (h *contentHandler) CancelScheduledPost(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	postID := c.Param("postID")
+	if err := h.contentService.CancelScheduledPost(user.ID.Hex(), postID); err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse("cancelled"))
+}
+
+func (h *contentHandler) GetReactionEmojis(c *gin.Context) {
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(h.contentService.GetReactionEmojis()))
+}
+
 func (h *contentHandler) GetMetadata(c *gin.Context) {
 	var request dto.MetadataRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -231,8 +573,12 @@ func (h *contentHandler) GetMetadata(c *gin.Context) {
 		return
 	}
 	resp, err := h.contentService.GetMetadata(request.Url)
+	if errors.Is(err, service.ErrInvalidMetadataUrl) || errors.Is(err, service.ErrBlockedUrl) {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		c.JSON(http.StatusBadGateway, util.GenerateFailedResponse(err.Error()))
 		return
 	}
 
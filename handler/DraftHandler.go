@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tipbk/sneakfeed-service/dto"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/service"
+	"github.com/tipbk/sneakfeed-service/util"
+)
+
+type DraftHandler interface {
+	CreateDraft(c *gin.Context)
+	GetDrafts(c *gin.Context)
+	UpdateDraft(c *gin.Context)
+	DeleteDraft(c *gin.Context)
+	PublishDraft(c *gin.Context)
+}
+
+type draftHandler struct {
+	draftService service.DraftService
+}
+
+func NewDraftHandler(draftService service.DraftService) DraftHandler {
+	return &draftHandler{
+		draftService: draftService,
+	}
+}
+
+func (h *draftHandler) CreateDraft(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	var request dto.SaveDraftRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	draft := &model.Draft{UserID: user.ID.Hex(), Content: request.Content}
+	draftID, err := h.draftService.CreateDraft(draft, request.ImageBase64)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(draftID))
+}
+
+func (h *draftHandler) GetDrafts(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	drafts, err := h.draftService.GetDrafts(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(drafts))
+}
+
+func (h *draftHandler) UpdateDraft(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	var request dto.SaveDraftRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	draftID := c.Param("draftID")
+	draft, err := h.draftService.FindDraft(user.ID.Hex(), draftID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	draft.Content = request.Content
+	err = h.draftService.UpdateDraft(draft, request.ImageBase64, request.RemoveImage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(draft))
+}
+
+func (h *draftHandler) DeleteDraft(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	err = h.draftService.DeleteDraft(user.ID.Hex(), c.Param("draftID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse("deleted"))
+}
+
+func (h *draftHandler) PublishDraft(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	draft, err := h.draftService.FindDraft(user.ID.Hex(), c.Param("draftID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	postID, err := h.draftService.PublishDraft(draft)
+	if err != nil {
+		c.JSON(createPostErrorStatus(err), util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(postID))
+}
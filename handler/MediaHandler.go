@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/service"
+	"github.com/tipbk/sneakfeed-service/util"
+)
+
+// room for the multipart boundaries and headers around the file part
+const multipartOverheadBytes = 64 * 1024
+
+type MediaHandler interface {
+	UploadMedia(c *gin.Context)
+	GetMedia(c *gin.Context)
+}
+
+type mediaHandler struct {
+	envConfig    *config.EnvConfig
+	mediaService service.MediaService
+}
+
+func NewMediaHandler(envConfig *config.EnvConfig, mediaService service.MediaService) MediaHandler {
+	return &mediaHandler{
+		envConfig:    envConfig,
+		mediaService: mediaService,
+	}
+}
+
+// UploadMedia reads the "file" part of a multipart/form-data body as a stream
+func (h *mediaHandler) UploadMedia(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	maxBytes := h.envConfig.MediaMaxUploadBytes
+	if h.envConfig.MediaMaxVideoBytes > maxBytes {
+		maxBytes = h.envConfig.MediaMaxVideoBytes
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+multipartOverheadBytes)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("body must be multipart/form-data"))
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("file cannot be empty"))
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		media, err := h.mediaService.UploadMedia(user.ID.Hex(), part)
+		part.Close()
+		if err != nil {
+			if errors.Is(err, service.ErrMediaTooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, util.GenerateFailedResponse(err.Error()))
+				return
+			}
+			if errors.Is(err, service.ErrUnsupportedMimeType) {
+				c.JSON(http.StatusUnsupportedMediaType, util.GenerateFailedResponse(err.Error()))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, util.GenerateSuccessResponse(media))
+		return
+	}
+}
+
+// GetMedia lets the uploader poll a video or gif until it is READY or FAILED
+func (h *mediaHandler) GetMedia(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	media, err := h.mediaService.FindUserMedia(user.ID.Hex(), c.Param("mediaID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(media))
+}
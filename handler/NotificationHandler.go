@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tipbk/sneakfeed-service/dto"
+	"github.com/tipbk/sneakfeed-service/service"
+	"github.com/tipbk/sneakfeed-service/util"
+)
+
+type NotificationHandler interface {
+	GetNotifications(c *gin.Context)
+	MarkNotificationsRead(c *gin.Context)
+}
+
+type notificationHandler struct {
+	notificationService service.NotificationService
+}
+
+func NewNotificationHandler(notificationService service.NotificationService) NotificationHandler {
+	return &notificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+func (h *notificationHandler) GetNotifications(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	cursor, limit := parsePaging(c, 20)
+	notifications, pagination, err := h.notificationService.GetNotifications(user.ID.Hex(), limit, cursor)
+	if errors.Is(err, util.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.GetNotificationsResponse{
+		Pagination:    *pagination,
+		Notifications: notifications,
+	}))
+}
+
+func (h *notificationHandler) MarkNotificationsRead(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	err = h.notificationService.MarkNotificationsRead(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse("updated"))
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tipbk/sneakfeed-service/service"
+	"github.com/tipbk/sneakfeed-service/util"
+)
+
+type TrendingHandler interface {
+	GetTrending(c *gin.Context)
+}
+
+type trendingHandler struct {
+	trendingService service.TrendingService
+}
+
+func NewTrendingHandler(trendingService service.TrendingService) TrendingHandler {
+	return &trendingHandler{
+		trendingService: trendingService,
+	}
+}
+
+func (h *trendingHandler) GetTrending(c *gin.Context) {
+	trending, err := h.trendingService.GetTrending()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(trending))
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -21,19 +22,19 @@ type UserHandler interface {
 	UpdateUserProfile(c *gin.Context)
 	GetUserByOthers(c *gin.Context)
 	ToggleFollowUser(c *gin.Context)
+	FollowUser(c *gin.Context)
+	UnfollowUser(c *gin.Context)
 }
 
 type userHandler struct {
-	envConfig            *config.EnvConfig
-	userService          service.UserService
-	imageUploaderService service.ImageUploaderService
+	envConfig   *config.EnvConfig
+	userService service.UserService
 }
 
-func NewUserHandler(envConfig *config.EnvConfig, userService service.UserService, imageUploaderService service.ImageUploaderService) UserHandler {
+func NewUserHandler(envConfig *config.EnvConfig, userService service.UserService) UserHandler {
 	return &userHandler{
-		envConfig:            envConfig,
-		userService:          userService,
-		imageUploaderService: imageUploaderService,
+		envConfig:   envConfig,
+		userService: userService,
 	}
 }
 
@@ -186,27 +187,12 @@ func (h *userHandler) UpdateUserProfile(c *gin.Context) {
 		return
 	}
 
-	imageUrl := ""
-
-	if request.ImageBase64 != "" {
-		uploadResponse, err := h.imageUploaderService.UploadImage(request.ImageBase64)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+	err = h.userService.UpdateProfile(currentUser, request.DisplayName, request.ImageBase64, request.ProfileImageMediaID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidProfileImage) {
+			c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
 			return
 		}
-		imageUrl = uploadResponse.Data.Url
-	}
-
-	if imageUrl != "" {
-		currentUser.ProfileImage = imageUrl
-	}
-
-	if request.DisplayName != "" {
-		currentUser.DisplayName = request.DisplayName
-	}
-
-	err = h.userService.UpdateProfile(currentUser.ID.Hex(), currentUser)
-	if err != nil {
 		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
 		return
 	}
@@ -245,3 +231,42 @@ func (h *userHandler) ToggleFollowUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.ToggleFollowUserResponse{IsFollowed: isFollowed}))
 }
+
+// FollowUser and UnfollowUser set the follow instead of flipping it, so double taps and retries are safe
+func (h *userHandler) FollowUser(c *gin.Context) {
+	h.setFollowOnUser(c, true)
+}
+
+func (h *userHandler) UnfollowUser(c *gin.Context) {
+	h.setFollowOnUser(c, false)
+}
+
+func (h *userHandler) setFollowOnUser(c *gin.Context, isFollowed bool) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+
+	followUserID := c.Param("userID")
+	if followUserID == user.ID.Hex() {
+		c.JSON(http.StatusBadRequest, util.GenerateFailedResponse("you cannot follow yourself"))
+		return
+	}
+
+	if isFollowed {
+		if _, err := h.userService.FindUserWithUserID(followUserID); err != nil {
+			c.JSON(http.StatusNotFound, util.GenerateFailedResponse("user doesn't exist"))
+			return
+		}
+		err = h.userService.FollowUser(user.ID.Hex(), followUserID)
+	} else {
+		err = h.userService.UnfollowUser(user.ID.Hex(), followUserID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, util.GenerateFailedResponse(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, util.GenerateSuccessResponse(dto.ToggleFollowUserResponse{IsFollowed: isFollowed}))
+}
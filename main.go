@@ -25,15 +25,62 @@ func main() {
 		// take service down
 		panic(err)
 	}
+	if err := repository.RunMigrations(envConfig, mongoClient); err != nil {
+		panic(err)
+	}
+	if err := repository.EnsureIndexes(envConfig, mongoClient); err != nil {
+		panic(err)
+	}
 
-	imageUploaderService := service.NewImageUploaderService()
-	userRepository := repository.NewUserRepository(envConfig, mongoClient)
-	userService := service.NewUserService(userRepository)
-	userHandler := handler.NewUserHandler(envConfig, userService, imageUploaderService)
+	storageDriver, err := service.NewStorageDriver(envConfig)
+	if err != nil {
+		panic(err)
+	}
+	mediaObjectRepository := repository.NewMediaObjectRepository(envConfig, mongoClient)
+	imageUploaderService := service.NewImageUploaderService(storageDriver, mediaObjectRepository)
 	contentRepository := repository.NewContentReepository(envConfig, mongoClient)
-	contentService := service.NewContentService(envConfig, contentRepository)
-	contentHandler := handler.NewContentHandler(contentService, userService, imageUploaderService)
+	notificationRepository := repository.NewNotificationRepository(envConfig, mongoClient)
+	notificationService := service.NewNotificationService(envConfig, notificationRepository)
+	notificationHandler := handler.NewNotificationHandler(notificationService)
+	mediaRepository := repository.NewMediaRepository(envConfig, mongoClient)
+	mediaProcessingService := service.NewMediaProcessingService(envConfig, mediaRepository, contentRepository, storageDriver, imageUploaderService, notificationService)
+	mediaService := service.NewMediaService(envConfig, mediaRepository, imageUploaderService, storageDriver, mediaProcessingService)
+	mediaHandler := handler.NewMediaHandler(envConfig, mediaService)
+	userRepository := repository.NewUserRepository(envConfig, mongoClient)
+	timelineRepository := repository.NewTimelineRepository(envConfig, mongoClient)
+	timelineService := service.NewTimelineService(envConfig, timelineRepository)
+	userService := service.NewUserService(userRepository, timelineService, mediaService, imageUploaderService)
+	userHandler := handler.NewUserHandler(envConfig, userService)
+	metadataFetcher := service.NewMetadataFetcher(envConfig, service.NewUrlPolicy(envConfig))
+	linkPreviewRepository := repository.NewLinkPreviewRepository(envConfig, mongoClient)
+	linkPreviewService := service.NewLinkPreviewService(envConfig, linkPreviewRepository, metadataFetcher)
+	postPreviewService := service.NewPostPreviewService(contentRepository, linkPreviewService)
+	lockRepository := repository.NewLockRepository(envConfig, mongoClient)
+	trendingRepository := repository.NewTrendingRepository(envConfig, mongoClient)
+	trendingService := service.NewTrendingService(envConfig, trendingRepository, lockRepository)
+	feedRankingRepository := repository.NewFeedRankingRepository(envConfig, mongoClient)
+	feedRankingService := service.NewFeedRankingService(feedRankingRepository, timelineRepository, trendingService)
+	contentService := service.NewContentService(envConfig, contentRepository, userService, notificationService, linkPreviewService, postPreviewService, timelineService, feedRankingService, mediaService, imageUploaderService)
+	contentHandler := handler.NewContentHandler(contentService, userService)
 	authMiddleware := middleware.NewAuthMiddleware(envConfig, userService)
+	trendingHandler := handler.NewTrendingHandler(trendingService)
+
+	draftRepository := repository.NewDraftRepository(envConfig, mongoClient)
+	draftService := service.NewDraftService(draftRepository, contentService, imageUploaderService, linkPreviewService)
+	draftHandler := handler.NewDraftHandler(draftService)
+
+	postSchedulerService := service.NewPostSchedulerService(envConfig, contentRepository, lockRepository, notificationService, timelineService)
+	mediaGarbageCollectorService := service.NewMediaGarbageCollectorService(envConfig, mediaRepository, mediaObjectRepository, lockRepository, imageUploaderService, storageDriver)
+	counterRepository := repository.NewCounterRepository(envConfig, mongoClient)
+	counterReconcilerService := service.NewCounterReconcilerService(envConfig, counterRepository, lockRepository)
+
+	trendingService.Start()
+	postSchedulerService.Start()
+	mediaProcessingService.Start()
+	mediaGarbageCollectorService.Start()
+	postPreviewService.Start()
+	timelineService.Start()
+	counterReconcilerService.Start()
 
 	r.GET("/ping")
 	r.POST("/register", userHandler.Register)
@@ -45,18 +92,52 @@ func main() {
 	{
 		authorized.GET("/posts", contentHandler.GetPosts)
 		authorized.GET("/posts/:postID", contentHandler.GetPostByID)
+		authorized.GET("/hashtags/:tag/posts", contentHandler.GetPostsByHashtag)
+		authorized.GET("/trending", trendingHandler.GetTrending)
+		authorized.GET("/notifications", notificationHandler.GetNotifications)
+		authorized.POST("/notifications/read", notificationHandler.MarkNotificationsRead)
 		authorized.GET("/posts/:postID/comments", contentHandler.GetCommentByPostID)
 		authorized.POST("/posts", contentHandler.CreatePost)
+		authorized.POST("/media", mediaHandler.UploadMedia)
+		authorized.GET("/media/:mediaID", mediaHandler.GetMedia)
 		authorized.POST("/posts/:postID/comments", contentHandler.AddComment)
+		authorized.PATCH("/posts/:postID/comments/:commentID", contentHandler.UpdateComment)
+		authorized.DELETE("/posts/:postID/comments/:commentID", contentHandler.DeleteComment)
 		// profile for user
 		authorized.GET("/profiles", userHandler.GetProfile)
 		authorized.PATCH("/profiles", userHandler.UpdateUserProfile)
 		// user for see other users
 		authorized.GET("/users/:username", userHandler.GetUserByOthers)
 		authorized.POST("/users/toggle-follow", userHandler.ToggleFollowUser)
+		authorized.PUT("/users/:userID/follow", userHandler.FollowUser)
+		authorized.DELETE("/users/:userID/follow", userHandler.UnfollowUser)
 		authorized.POST("/posts/:postID/like", contentHandler.ToggleLikePostByID)
+		authorized.PUT("/posts/:postID/like", contentHandler.LikePostByID)
+		authorized.DELETE("/posts/:postID/like", contentHandler.UnlikePostByID)
+		authorized.POST("/posts/:postID/comments/:commentID/like", contentHandler.ToggleLikeCommentByID)
+		authorized.POST("/posts/:postID/reactions", contentHandler.ToggleReactionPostByID)
+		authorized.POST("/posts/:postID/repost", contentHandler.ToggleRepostPostByID)
+		authorized.POST("/posts/:postID/poll/vote", contentHandler.VotePoll)
+		authorized.GET("/scheduled-posts", contentHandler.GetScheduledPosts)
+		authorized.PATCH("/scheduled-posts/:postID", contentHandler.ReschedulePost)
+		authorized.DELETE("/scheduled-posts/:postID", contentHandler.CancelScheduledPost)
+		authorized.GET("/drafts", draftHandler.GetDrafts)
+		authorized.POST("/drafts", draftHandler.CreateDraft)
+		authorized.PATCH("/drafts/:draftID", draftHandler.UpdateDraft)
+		authorized.DELETE("/drafts/:draftID", draftHandler.DeleteDraft)
+		authorized.POST("/drafts/:draftID/publish", draftHandler.PublishDraft)
+		authorized.GET("/reactions", contentHandler.GetReactionEmojis)
 		authorized.POST("/metadata", contentHandler.GetMetadata)
 	}
 
+	// the local driver has nothing else serving its files
+	if envConfig.StorageDriver == service.StorageDriverLocal {
+		route, err := service.LocalStorageRoute(envConfig.LocalStorageBaseUrl)
+		if err != nil {
+			panic(err)
+		}
+		r.Static(route, envConfig.LocalStorageDir)
+	}
+
 	r.Run()
 }
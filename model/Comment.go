@@ -7,9 +7,13 @@ import (
 )
 
 type Comment struct {
-	ID              primitive.ObjectID `json:"-" bson:"_id"`
-	UserID          string             `json:"userID" bson:"userID"`
-	PostID          string             `json:"postID" bson:"postID"`
-	Content         string             `json:"content" bson:"content"`
-	CreatedDatetime *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+	ID               primitive.ObjectID `json:"-" bson:"_id"`
+	UserID           string             `json:"userID" bson:"userID"`
+	PostID           string             `json:"postID" bson:"postID"`
+	Content          string             `json:"content" bson:"content"`
+	CreatedDatetime  *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+	UpdatedDatetime  *time.Time         `json:"updatedDatetime" bson:"updatedDatetime,omitempty"`
+	IsDeleted        bool               `json:"isDeleted" bson:"isDeleted"`
+	Mentions         []MentionEntity    `json:"mentions" bson:"mentions"`
+	MentionedUserIDs []string           `json:"mentionedUserIDs" bson:"mentionedUserIDs"`
 }
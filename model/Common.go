@@ -1,6 +1,21 @@
 package model
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NextCursor is only set when HasMore is true, pass it back as the cursor query to get the next page
 type Pagination struct {
-	Total int `json:"total"`
-	Limit int `json:"limit"`
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// Cursor is the position after the last item of a page, the id breaks ties between equal datetimes
+type Cursor struct {
+	Datetime time.Time
+	ID       primitive.ObjectID
 }
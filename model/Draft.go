@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Draft is an unpublished post kept on the server so it can be finished on another device
+type Draft struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	UserID   string             `json:"userID" bson:"userID"`
+	Content  string             `json:"content" bson:"content"`
+	ImageUrl *string            `json:"imageUrl" bson:"imageUrl"`
+	// the og fields are the preview of the first link in the content, filled in when the draft is saved
+	OgTitle         *string    `json:"ogTitle" bson:"ogTitle"`
+	OgDescription   *string    `json:"ogDescription" bson:"ogDescription"`
+	OgLink          *string    `json:"ogLink" bson:"ogLink"`
+	OgImage         *string    `json:"ogImage" bson:"ogImage"`
+	OgDomain        *string    `json:"ogDomain" bson:"ogDomain"`
+	CreatedDatetime *time.Time `json:"createdDatetime" bson:"createdDatetime"`
+	UpdatedDatetime *time.Time `json:"updatedDatetime" bson:"updatedDatetime"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// HashtagEntity points at a hashtag inside post content. Start and End are character (rune) offsets, End is exclusive.
+type HashtagEntity struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// MentionEntity points at a resolved @username inside post or comment content
+type MentionEntity struct {
+	UserID   string `json:"userID" bson:"userID"`
+	Username string `json:"username" bson:"username"`
+	Start    int    `json:"start" bson:"start"`
+	End      int    `json:"end" bson:"end"`
+}
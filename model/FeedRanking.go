@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FeedRankingWeights tunes the FOR_YOU feed. They are read from the feed_ranking collection
+// so they can be changed without a deploy, fields left out of the document keep their defaults.
+type FeedRankingWeights struct {
+	// a post loses half its score every RecencyHalfLifeHours, candidates older than CandidateHours are not ranked
+	RecencyHalfLifeHours float64 `json:"recencyHalfLifeHours" bson:"recencyHalfLifeHours"`
+	CandidateHours       float64 `json:"candidateHours" bson:"candidateHours"`
+	CandidatesPerSource  int     `json:"candidatesPerSource" bson:"candidatesPerSource"`
+	// where a candidate came from, a post found through several sources takes the highest
+	FollowingWeight    float64 `json:"followingWeight" bson:"followingWeight"`
+	SecondDegreeWeight float64 `json:"secondDegreeWeight" bson:"secondDegreeWeight"`
+	TrendingWeight     float64 `json:"trendingWeight" bson:"trendingWeight"`
+	// engagement is the log of the weighted likes, comments and reposts
+	EngagementWeight float64 `json:"engagementWeight" bson:"engagementWeight"`
+	LikeWeight       float64 `json:"likeWeight" bson:"likeWeight"`
+	CommentWeight    float64 `json:"commentWeight" bson:"commentWeight"`
+	RepostWeight     float64 `json:"repostWeight" bson:"repostWeight"`
+	// affinity is the log of how often the reader liked, commented on or reposted the author within AffinityDays
+	AffinityWeight float64 `json:"affinityWeight" bson:"affinityWeight"`
+	AffinityDays   int     `json:"affinityDays" bson:"affinityDays"`
+	// every further post of an author is multiplied by AuthorRepeatPenalty, at most MaxPostsPerAuthor are kept
+	AuthorRepeatPenalty float64 `json:"authorRepeatPenalty" bson:"authorRepeatPenalty"`
+	MaxPostsPerAuthor   int     `json:"maxPostsPerAuthor" bson:"maxPostsPerAuthor"`
+}
+
+func DefaultFeedRankingWeights() FeedRankingWeights {
+	return FeedRankingWeights{
+		RecencyHalfLifeHours: 12,
+		CandidateHours:       72,
+		CandidatesPerSource:  200,
+		FollowingWeight:      1,
+		SecondDegreeWeight:   0.5,
+		TrendingWeight:       0.3,
+		EngagementWeight:     0.5,
+		LikeWeight:           1,
+		CommentWeight:        2,
+		RepostWeight:         3,
+		AffinityWeight:       0.5,
+		AffinityDays:         30,
+		AuthorRepeatPenalty:  0.5,
+		MaxPostsPerAuthor:    3,
+	}
+}
+
+// ForYouRanking keeps the order of a ranked FOR_YOU feed so its later pages follow it.
+// The TTL index drops it once ExpiresDatetime has passed.
+type ForYouRanking struct {
+	ID              primitive.ObjectID   `json:"-" bson:"_id,omitempty"`
+	UserID          string               `json:"userID" bson:"userID"`
+	RankedDatetime  *time.Time           `json:"rankedDatetime" bson:"rankedDatetime"`
+	PostIDs         []primitive.ObjectID `json:"postIDs" bson:"postIDs"`
+	ExpiresDatetime *time.Time           `json:"expiresDatetime" bson:"expiresDatetime"`
+}
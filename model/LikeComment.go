@@ -0,0 +1,16 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type LikeComment struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id"`
+	UserID    string             `json:"userID" bson:"userID"`
+	PostID    string             `json:"postID" bson:"postID"`
+	CommentID string             `json:"commentID" bson:"commentID"`
+}
+
+type CommentLikeSummary struct {
+	CommentID  string `bson:"_id"`
+	TotalLikes int    `bson:"totalLikes"`
+	IsLike     bool   `bson:"isLike"`
+}
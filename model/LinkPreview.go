@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// LinkPreview caches the metadata of a link keyed by its canonical url.
+// A failed fetch is cached too with Error set, only for a short while.
+type LinkPreview struct {
+	ID              string     `json:"id" bson:"_id"`
+	OgTitle         string     `json:"ogTitle" bson:"ogTitle"`
+	OgDescription   string     `json:"ogDescription" bson:"ogDescription"`
+	Domain          string     `json:"domain" bson:"domain"`
+	FullURL         string     `json:"fullUrl" bson:"fullUrl"`
+	Image           string     `json:"image" bson:"image"`
+	Error           string     `json:"error,omitempty" bson:"error,omitempty"`
+	FetchedDatetime *time.Time `json:"fetchedDatetime" bson:"fetchedDatetime"`
+	// RefreshDatetime is when a hit starts refreshing it in the background, ExpiresDatetime is when the TTL index drops it
+	RefreshDatetime *time.Time `json:"refreshDatetime" bson:"refreshDatetime"`
+	ExpiresDatetime *time.Time `json:"expiresDatetime" bson:"expiresDatetime"`
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MediaTypeImage = "image"
+	MediaTypeVideo = "video"
+	MediaTypeGif   = "gif"
+
+	MediaStatusProcessing = "PROCESSING"
+	MediaStatusReady      = "READY"
+	MediaStatusFailed     = "FAILED"
+)
+
+// Media is a file uploaded through POST /media which posts and profiles reference by id
+type Media struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	UserID          string             `json:"userID" bson:"userID"`
+	Url             string             `json:"url" bson:"url"`
+	FileID          string             `json:"-" bson:"fileID"`
+	MimeType        string             `json:"mimeType" bson:"mimeType"`
+	Size            int64              `json:"size" bson:"size"`
+	Width           int                `json:"width" bson:"width"`
+	Height          int                `json:"height" bson:"height"`
+	Blurhash        string             `json:"blurhash" bson:"blurhash"`
+	Variants        []ImageVariant     `json:"variants" bson:"variants"`
+	CreatedDatetime *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+	// MimeType and Size describe the original upload. Videos and gifs are processed
+	// in the background, images are ready straight away.
+	Type          string     `json:"type" bson:"type"`
+	Status        string     `json:"status" bson:"status"`
+	FailureReason string     `json:"failureReason,omitempty" bson:"failureReason,omitempty"`
+	Duration      float64    `json:"duration,omitempty" bson:"duration,omitempty"`
+	PosterUrl     string     `json:"posterUrl,omitempty" bson:"posterUrl,omitempty"`
+	OriginalKey   string     `json:"-" bson:"originalKey,omitempty"`
+	Attempts      int        `json:"-" bson:"attempts"`
+	ClaimedUntil  *time.Time `json:"-" bson:"claimedUntil,omitempty"`
+}
+
+// MediaAttachment is one image, video or gif in a post gallery
+type MediaAttachment struct {
+	Url      string `json:"url" bson:"url"`
+	FileID   string `json:"-" bson:"fileID"`
+	AltText  string `json:"altText" bson:"altText"`
+	Width    int    `json:"width" bson:"width"`
+	Height   int    `json:"height" bson:"height"`
+	Blurhash string `json:"blurhash" bson:"blurhash"`
+	// Url and the size above are the display variant, every stored size is listed here.
+	// For videos and gifs Url is the clip and the variants belong to the poster frame.
+	Variants []ImageVariant `json:"variants" bson:"variants"`
+	MediaID  string         `json:"mediaID,omitempty" bson:"mediaID,omitempty"`
+	// Type tells clients how to render the attachment: image, video or gif
+	Type      string  `json:"type" bson:"type"`
+	Status    string  `json:"status" bson:"status"`
+	Duration  float64 `json:"duration,omitempty" bson:"duration,omitempty"`
+	PosterUrl string  `json:"posterUrl,omitempty" bson:"posterUrl,omitempty"`
+}
+
+// ImageVariant is one resized copy of an upload (avatar, thumbnail or display)
+type ImageVariant struct {
+	Name   string `json:"name" bson:"name"`
+	Url    string `json:"url" bson:"url"`
+	Key    string `json:"-" bson:"key"`
+	Width  int    `json:"width" bson:"width"`
+	Height int    `json:"height" bson:"height"`
+}
+
+// Variant returns the url of the named variant, falling back to the main url
+func (m *MediaAttachment) Variant(name string) string {
+	for _, variant := range m.Variants {
+		if variant.Name == name {
+			return variant.Url
+		}
+	}
+	return m.Url
+}
+
+// Attachment turns an uploaded media into an attachment for a post
+func (m *Media) Attachment(altText string) MediaAttachment {
+	return MediaAttachment{
+		Url:       m.Url,
+		FileID:    m.FileID,
+		AltText:   altText,
+		Width:     m.Width,
+		Height:    m.Height,
+		Blurhash:  m.Blurhash,
+		Variants:  m.Variants,
+		MediaID:   m.ID.Hex(),
+		Type:      m.Type,
+		Status:    m.Status,
+		Duration:  m.Duration,
+		PosterUrl: m.PosterUrl,
+	}
+}
+
+// MediaObject is one stored file (with its variants) shared by every upload of the same content.
+// The id is the sha256 of the uploaded bytes.
+type MediaObject struct {
+	ID              string          `json:"id" bson:"_id"`
+	Attachment      MediaAttachment `json:"attachment" bson:"attachment"`
+	Keys            []string        `json:"-" bson:"keys"`
+	Urls            []string        `json:"-" bson:"urls"`
+	RefCount        int             `json:"refCount" bson:"refCount"`
+	CreatedDatetime *time.Time      `json:"createdDatetime" bson:"createdDatetime"`
+	UpdatedDatetime *time.Time      `json:"updatedDatetime" bson:"updatedDatetime"`
+}
+
+// StorageKeys lists every stored file of an attachment, the clip or image itself and its variants
+func (m *MediaAttachment) StorageKeys() []string {
+	keys := []string{}
+	if m.FileID != "" {
+		keys = append(keys, m.FileID)
+	}
+	for _, variant := range m.Variants {
+		if variant.Key != "" && variant.Key != m.FileID {
+			keys = append(keys, variant.Key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	NotificationTypeMention = "MENTION"
+)
+
+type Notification struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	UserID          string             `json:"userID" bson:"userID"`
+	ActorUserID     string             `json:"actorUserID" bson:"actorUserID"`
+	Type            string             `json:"type" bson:"type"`
+	PostID          string             `json:"postID" bson:"postID"`
+	CommentID       string             `json:"commentID,omitempty" bson:"commentID,omitempty"`
+	IsRead          bool               `json:"isRead" bson:"isRead"`
+	CreatedDatetime *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Poll struct {
+	Options         []string   `json:"options" bson:"options"`
+	ExpiresDatetime *time.Time `json:"expiresDatetime" bson:"expiresDatetime"`
+}
+
+type PollVote struct {
+	ID              primitive.ObjectID `json:"-" bson:"_id"`
+	PostID          string             `json:"postID" bson:"postID"`
+	UserID          string             `json:"userID" bson:"userID"`
+	OptionIndex     int                `json:"optionIndex" bson:"optionIndex"`
+	CreatedDatetime *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+}
+
+// PollResult is what the viewer sees of a poll. Vote counts are only set after the viewer voted or the poll closed.
+type PollResult struct {
+	Options         []PollOptionResult `json:"options"`
+	TotalVotes      *int               `json:"totalVotes"`
+	ExpiresDatetime *time.Time         `json:"expiresDatetime"`
+	IsClosed        bool               `json:"isClosed"`
+	MyVote          *int               `json:"myVote"`
+}
+
+type PollOptionResult struct {
+	Text       string   `json:"text"`
+	VoteCount  *int     `json:"voteCount"`
+	Percentage *float64 `json:"percentage"`
+}
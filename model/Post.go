@@ -6,6 +6,15 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	PostStatusPending   = "PENDING"
+	PostStatusPublished = "PUBLISHED"
+
+	PreviewStatusPending = "PENDING"
+	PreviewStatusReady   = "READY"
+	PreviewStatusFailed  = "FAILED"
+)
+
 type Post struct {
 	ID              primitive.ObjectID `json:"-" bson:"_id"`
 	UserID          string             `json:"userID" bson:"userID"`
@@ -17,6 +26,43 @@ type Post struct {
 	OgLink          *string            `json:"ogLink" bson:"ogLink"`
 	OgImage         *string            `json:"ogImage" bson:"ogImage"`
 	OgDomain        *string            `json:"ogDoamin" bson:"ogDomain"`
+	QuotePostID     *string            `json:"quotePostID" bson:"quotePostID"`
+	Hashtags        []string           `json:"hashtags" bson:"hashtags"`
+	Mentions        []MentionEntity    `json:"mentions" bson:"mentions"`
+	// MentionedUserIDs is kept next to Mentions so the mention feed can use an index
+	MentionedUserIDs []string `json:"mentionedUserIDs" bson:"mentionedUserIDs"`
+	Poll             *Poll    `json:"poll" bson:"poll,omitempty"`
+	// posts without a status were created before scheduling and count as published
+	Status    string     `json:"status" bson:"status,omitempty"`
+	PublishAt *time.Time `json:"publishAt" bson:"publishAt,omitempty"`
+	// ImageUrl stays the first media url so older clients still see an image
+	Media []MediaAttachment `json:"media" bson:"media,omitempty"`
+	// MediaStatus is PROCESSING while a video or gif is still being processed
+	MediaStatus string `json:"mediaStatus,omitempty" bson:"mediaStatus,omitempty"`
+	// the og fields are filled in the background from the first link in the content, never by the client
+	PreviewUrl    string `json:"-" bson:"previewUrl,omitempty"`
+	PreviewStatus string `json:"-" bson:"previewStatus,omitempty"`
+	// LikeCount and CommentCount change in the same transaction as the like or comment, the counter reconciler repairs drift
+	LikeCount    int64 `json:"likeCount" bson:"likeCount"`
+	CommentCount int64 `json:"commentCount" bson:"commentCount"`
+	// FanoutStatus is PENDING until the post has been written to its followers' timelines
+	FanoutStatus string `json:"-" bson:"fanoutStatus,omitempty"`
+}
+
+// PostCounters are the stored counters of a post, nil when the post predates them
+type PostCounters struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	LikeCount    *int64             `bson:"likeCount"`
+	CommentCount *int64             `bson:"commentCount"`
+}
+
+func (p *Post) IsPending() bool {
+	return p.Status == PostStatusPending
+}
+
+// IsHidden is true while only the author may see the post
+func (p *Post) IsHidden() bool {
+	return p.IsPending() || p.MediaStatus == MediaStatusProcessing || p.MediaStatus == MediaStatusFailed
 }
 
 type PostDetail struct {
@@ -37,6 +83,37 @@ type PostDetail struct {
 	OgLink          *string            `json:"ogLink"`
 	OgImage         *string            `json:"ogImage"`
 	OgDomain        *string            `json:"ogDomain"`
+	Reactions       []ReactionCount    `json:"reactions" bson:"reactions"`
+	MyReactions     []string           `json:"myReactions" bson:"myReactions"`
+	TotalReposts    int                `json:"totalReposts" bson:"totalReposts"`
+	IsRepost        bool               `json:"isRepost" bson:"isRepost"`
+	QuotePostID     *string            `json:"quotePostID" bson:"quotePostID"`
+	QuotedPost      *QuotedPost        `json:"quotedPost" bson:"quotedPost"`
+	RepostedBy      *RepostedBy        `json:"repostedBy" bson:"repostedBy"`
+	FeedDatetime    *time.Time         `json:"feedDatetime" bson:"feedDatetime"`
+	HashtagEntities []HashtagEntity    `json:"hashtagEntities" bson:"-"`
+	Mentions        []MentionEntity    `json:"mentions" bson:"mentions"`
+	Poll            *Poll              `json:"-" bson:"poll"`
+	PollVoteCounts  []int              `json:"-" bson:"pollVoteCounts"`
+	MyPollVote      *int               `json:"-" bson:"myPollVote"`
+	PollResult      *PollResult        `json:"poll" bson:"-"`
+	Status          string             `json:"status,omitempty" bson:"status"`
+	PublishAt       *time.Time         `json:"publishAt,omitempty" bson:"publishAt"`
+	Media           []MediaAttachment  `json:"media" bson:"media"`
+	MediaStatus     string             `json:"mediaStatus,omitempty" bson:"mediaStatus"`
+}
+
+// QuotedPost is the post embedded in a quote post
+type QuotedPost struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	UserID          string             `json:"userID" bson:"userID"`
+	Content         string             `json:"content" bson:"content"`
+	CreatedDatetime *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+	ImageUrl        *string            `json:"imageUrl" bson:"imageUrl"`
+	Media           []MediaAttachment  `json:"media" bson:"media"`
+	Username        string             `json:"username" bson:"username"`
+	DisplayName     string             `json:"displayName" bson:"displayName"`
+	ProfileImage    string             `json:"profileImage" bson:"profileImage"`
 }
 type PostDetailPagination struct {
 	Pagination Pagination   `json:"pagination" bson:"pagination"`
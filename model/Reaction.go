@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Reaction struct {
+	ID              primitive.ObjectID `json:"-" bson:"_id"`
+	UserID          string             `json:"userID" bson:"userID"`
+	PostID          string             `json:"postID" bson:"postID"`
+	Emoji           string             `json:"emoji" bson:"emoji"`
+	CreatedDatetime *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+}
+
+type ReactionCount struct {
+	Emoji string `json:"emoji" bson:"emoji"`
+	Count int    `json:"count" bson:"count"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Repost struct {
+	ID              primitive.ObjectID `json:"-" bson:"_id"`
+	UserID          string             `json:"userID" bson:"userID"`
+	PostID          string             `json:"postID" bson:"postID"`
+	CreatedDatetime *time.Time         `json:"createdDatetime" bson:"createdDatetime"`
+}
+
+// RepostedBy is the latest followed user who reposted a post in the following feed
+type RepostedBy struct {
+	UserID          string     `json:"userID" bson:"userID"`
+	Username        string     `json:"username" bson:"username"`
+	DisplayName     string     `json:"displayName" bson:"displayName"`
+	CreatedDatetime *time.Time `json:"createdDatetime" bson:"createdDatetime"`
+	TotalReposters  int        `json:"totalReposters" bson:"totalReposters"`
+}
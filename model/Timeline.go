@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const FanoutStatusPending = "PENDING"
+
+// TimelineEntry puts a post on a user's home timeline. A post is on a timeline once,
+// a later repost moves it up by raising FeedDatetime.
+type TimelineEntry struct {
+	ID     primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID string             `json:"userID" bson:"userID"`
+	PostID primitive.ObjectID `json:"postID" bson:"postID"`
+	// SourceUserIDs is the set of followed users, and the owner, who posted or reposted the post.
+	// Unfollowing removes the user from it and the entry goes once nobody is left.
+	SourceUserIDs []string `json:"sourceUserIDs" bson:"sourceUserIDs"`
+	// Reposts holds when each source reposted the post, keyed by user id
+	Reposts      map[string]time.Time `json:"reposts,omitempty" bson:"reposts,omitempty"`
+	FeedDatetime *time.Time           `json:"feedDatetime" bson:"feedDatetime"`
+}
+
+// TimelineAccount keeps the timeline state of a user apart from the user document,
+// which is replaced as a whole when the profile is updated
+type TimelineAccount struct {
+	ID string `json:"id" bson:"_id"`
+	// FanoutOnRead users have too many followers to fan out to, their posts are merged in when timelines are read
+	FanoutOnRead bool `json:"fanoutOnRead" bson:"fanoutOnRead"`
+	// BuiltDatetime is unset until the user's timeline has been backfilled once
+	BuiltDatetime *time.Time `json:"builtDatetime" bson:"builtDatetime,omitempty"`
+}
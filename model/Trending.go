@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// TermUsage is how many distinct users used a hashtag or domain in the recent window and in the baseline before it
+type TermUsage struct {
+	Name          string `bson:"name"`
+	RecentUsers   int    `bson:"recentUsers"`
+	BaselineUsers int    `bson:"baselineUsers"`
+}
+
+type TrendingItem struct {
+	Name          string  `json:"name" bson:"name"`
+	RecentUsers   int     `json:"recentUsers" bson:"recentUsers"`
+	BaselineUsers int     `json:"baselineUsers" bson:"baselineUsers"`
+	Score         float64 `json:"score" bson:"score"`
+}
+
+type Trending struct {
+	ID               string         `json:"-" bson:"_id"`
+	Hashtags         []TrendingItem `json:"hashtags" bson:"hashtags"`
+	Domains          []TrendingItem `json:"domains" bson:"domains"`
+	ComputedDatetime *time.Time     `json:"computedDatetime" bson:"computedDatetime"`
+}
@@ -24,3 +24,319 @@ func CreateMongoConnection(envConfig *config.EnvConfig) (*mongo.Client, error) {
 	fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
 	return client, nil
 }
+
+// withTransaction runs fn in a transaction, it is retried as a whole on transient errors
+func withTransaction(client *mongo.Client, fn func(ctx mongo.SessionContext) (interface{}, error)) (interface{}, error) {
+	session, err := client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(context.Background())
+	return session.WithTransaction(context.Background(), fn)
+}
+
+// EnsureIndexes creates the indexes the repositories rely on. It is safe to call on every start.
+func EnsureIndexes(envConfig *config.EnvConfig, client *mongo.Client) error {
+	database := client.Database(envConfig.DatabaseName)
+
+	// a user can like a comment only once, even when toggles race each other
+	_, err := database.Collection("comment_like").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"userID", 1}, {"commentID", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("reaction").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"userID", 1}, {"postID", 1}, {"emoji", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("repost").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"userID", 1}, {"postID", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// hashtag feeds read newest first
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"hashtags", 1}, {"createdDatetime", -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"mentionedUserIDs", 1}, {"createdDatetime", -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the post scheduler looks for pending posts which are due
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"status", 1}, {"publishAt", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("poll_vote").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"postID", 1}, {"userID", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("notification").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"createdDatetime", -1}, {"_id", -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("media").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("media").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"status", 1}, {"claimedUntil", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"media.mediaID", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("draft").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"updatedDatetime", -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("media").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"createdDatetime", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("media").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"variants.key", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("media_object").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"keys", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("media_object").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"urls", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("media_object").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"refCount", 1}, {"updatedDatetime", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"media.fileID", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"imageUrl", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("user").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"profileImage", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("draft").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"imageUrl", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// previews drop themselves once expiresDatetime has passed
+	_, err = database.Collection("link_preview").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"expiresDatetime", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"previewStatus", 1}, {"createdDatetime", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("comment").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"postID", 1}, {"createdDatetime", 1}, {"_id", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// one entry per post on a timeline, read newest first
+	_, err = database.Collection("timeline").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"userID", 1}, {"postID", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("timeline").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"feedDatetime", -1}, {"postID", -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("timeline").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"sourceUserIDs", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// an undone repost is taken off every timeline holding the post
+	_, err = database.Collection("timeline").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"postID", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// FOR_YOU rankings are read back by user and ranked time and drop themselves once expiresDatetime has passed
+	_, err = database.Collection("for_you_ranking").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"userID", 1}, {"rankedDatetime", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = database.Collection("for_you_ranking").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"expiresDatetime", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("follow").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"followUserID", 1}, {"_id", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("follow").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"createdDatetime", -1}, {"_id", -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("post").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"fanoutStatus", 1}, {"createdDatetime", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the FOR_YOU feed counts a reader's recent likes and comments per author
+	_, err = database.Collection("like").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"_id", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("comment").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"_id", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// likes are counted per post when counters are reconciled
+	_, err = database.Collection("like").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"postID", 1}, {"userID", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("comment").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"postID", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// likes and follows duplicated by racing toggles are removed by a migration before the unique indexes are built
+	_, err = database.Collection("like").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"userID", 1}, {"postID", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("follow").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{"userID", 1}, {"followUserID", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
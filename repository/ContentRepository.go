@@ -11,19 +11,49 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// errNothingDeleted aborts a transaction whose delete matched nothing
+var errNothingDeleted = errors.New("nothing was deleted")
+
 type ContentRepository interface {
-	CreatePost(userID string, content string, imageUrl *string, ogTitle *string, ogDescription *string, ogLink *string, ogImage *string, ogDomain *string) (string, error)
-	AddComment(userID string, postID string, content string) (string, error)
+	CreatePost(post *model.Post) (string, error)
+	AddComment(userID string, postID string, content string, mentions []model.MentionEntity) (string, error)
 	FindPost(postID string) (*model.Post, error)
-	GetPosts(userID string, limit int, timeFrom *time.Time, postFilter, username string) (*model.PostDetailPagination, error)
+	GetPosts(userID string, limit int, after *model.Cursor, postFilter, username, hashtag string) (*model.PostDetailPagination, error)
+	GetPostsByIDs(userID string, postIDs []primitive.ObjectID) ([]model.PostDetail, error)
 	GetPostByID(userID, postID string) (*model.PostDetail, error)
-	GetCommentFromPostID(postID string) ([]model.Comment, error)
+	GetCommentFromPostID(postID string, limit int, after *model.Cursor) ([]model.Comment, *model.Pagination, error)
 	IsPostLikeByUserID(userID string, postID string) (bool, error)
-	LikePost(userID string, postID string) (string, error)
-	UnlikePost(userID string, postID string) error
+	LikePost(userID string, postID string) (bool, error)
+	UnlikePost(userID string, postID string) (bool, error)
 	CountLikeAndCommentOnPost(postID string) (int64, int64, error)
+	FindComment(commentID string) (*model.Comment, error)
+	UpdateComment(commentID string, content string, mentions []model.MentionEntity) error
+	DeleteComment(commentID string) error
+	IsCommentLikeByUserID(userID string, commentID string) (bool, error)
+	LikeComment(userID string, postID string, commentID string) error
+	UnlikeComment(userID string, commentID string) error
+	GetCommentLikeSummaries(userID string, commentIDs []string) ([]model.CommentLikeSummary, error)
+	VotePoll(userID string, postID string, optionIndex int) error
+	GetPendingPosts(userID string) ([]model.Post, error)
+	GetDuePendingPosts(now time.Time, limit int) ([]model.Post, error)
+	PublishPendingPost(postID string, now time.Time) (bool, error)
+	ReschedulePendingPost(postID string, publishAt time.Time) error
+	DeletePendingPost(postID string) error
+	UpdatePostMedia(mediaID string, attachment model.MediaAttachment) (int64, error)
+	GetProcessingPostsByMediaID(mediaID string) ([]model.Post, error)
+	GetStaleProcessingPosts(createdBefore time.Time, limit int) ([]model.Post, error)
+	GetPendingPreviewPosts(createdBefore time.Time, limit int) ([]model.Post, error)
+	UpdatePostPreview(postID string, previewUrl string, preview *model.Post) (bool, error)
+	FinishPostMediaProcessing(postID string, mediaStatus string) (bool, error)
+	IsPostRepostedByUserID(userID string, postID string) (bool, error)
+	RepostPost(userID string, postID string) error
+	UnrepostPost(userID string, postID string) error
+	IsPostReactedByUserID(userID string, postID string, emoji string) (bool, error)
+	AddReaction(userID string, postID string, emoji string) error
+	RemoveReaction(userID string, postID string, emoji string) error
 }
 
 type contentRepository struct {
@@ -38,20 +68,11 @@ func NewContentReepository(envConfig *config.EnvConfig, mongoClient *mongo.Clien
 	}
 }
 
-func (r *contentRepository) CreatePost(userID string, content string, imageUrl *string, ogTitle *string, ogDescription *string, ogLink *string, ogImage *string, ogDomain *string) (string, error) {
+func (r *contentRepository) CreatePost(newPost *model.Post) (string, error) {
 	now := time.Now()
-	newPost := model.Post{
-		ID:              primitive.NewObjectID(),
-		UserID:          userID,
-		Content:         content,
-		CreatedDatetime: &now,
-		ImageUrl:        imageUrl,
-		OgTitle:         ogTitle,
-		OgLink:          ogLink,
-		OgDescription:   ogDescription,
-		OgDomain:        ogDomain,
-		OgImage:         ogImage,
-	}
+	newPost.ID = primitive.NewObjectID()
+	newPost.CreatedDatetime = &now
+	newPost.MentionedUserIDs = mentionedUserIDs(newPost.Mentions)
 	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
 	result, err := collection.InsertOne(context.Background(), newPost)
 	if err != nil {
@@ -77,16 +98,21 @@ func (r *contentRepository) FindPost(postID string) (*model.Post, error) {
 	return &existingPost, err
 }
 
-func (r *contentRepository) GetCommentFromPostID(postID string) ([]model.Comment, error) {
+// GetCommentFromPostID returns a page of comments oldest first, total counts every comment after the cursor like post feeds do
+func (r *contentRepository) GetCommentFromPostID(postID string, limit int, after *model.Cursor) ([]model.Comment, *model.Pagination, error) {
 	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment")
 	query := bson.M{"postID": postID}
-	cursor, err := collection.Find(context.Background(), query)
+	if after != nil {
+		query = bson.M{"$and": bson.A{query, afterCursorFilter("createdDatetime", after, 1)}}
+	}
+	findOptions := options.Find().SetSort(bson.D{{"createdDatetime", 1}, {"_id", 1}}).SetLimit(int64(limit + 1))
+	cursor, err := collection.Find(context.Background(), query, findOptions)
 	if err != nil {
 		fmt.Println("Error finding comment with postID:", err)
-		return nil, err
+		return nil, nil, err
 	}
 	defer cursor.Close(context.Background())
-	var comments []model.Comment
+	comments := []model.Comment{}
 	for cursor.Next(context.Background()) {
 		var comment model.Comment
 		err := cursor.Decode(&comment)
@@ -98,32 +124,182 @@ func (r *contentRepository) GetCommentFromPostID(postID string) ([]model.Comment
 	}
 	if err := cursor.Err(); err != nil {
 		fmt.Println("Error iterating cursor:", err)
-		return nil, err
+		return nil, nil, err
+	}
+	total, err := collection.CountDocuments(context.Background(), query)
+	if err != nil {
+		fmt.Println("Error counting comments:", err)
+		return nil, nil, err
 	}
-	return comments, nil
+	pagination := &model.Pagination{Total: int(total), Limit: limit}
+	if len(comments) > limit {
+		pagination.HasMore = true
+		comments = comments[:limit]
+	}
+	return comments, pagination, nil
 }
 
-func (r *contentRepository) AddComment(userID string, postID string, content string) (string, error) {
+func (r *contentRepository) AddComment(userID string, postID string, content string, mentions []model.MentionEntity) (string, error) {
 	now := time.Now()
 	newComment := model.Comment{
-		ID:              primitive.NewObjectID(),
-		UserID:          userID,
-		PostID:          postID,
-		Content:         content,
-		CreatedDatetime: &now,
+		ID:               primitive.NewObjectID(),
+		UserID:           userID,
+		PostID:           postID,
+		Content:          content,
+		CreatedDatetime:  &now,
+		Mentions:         mentions,
+		MentionedUserIDs: mentionedUserIDs(mentions),
 	}
-	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment")
-	result, err := collection.InsertOne(context.Background(), newComment)
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return "", errors.New("couldn't find a post")
+	}
+	database := r.mongoClient.Database(r.envConfig.DatabaseName)
+	_, err = withTransaction(r.mongoClient, func(ctx mongo.SessionContext) (interface{}, error) {
+		if _, err := database.Collection("comment").InsertOne(ctx, newComment); err != nil {
+			return nil, err
+		}
+		return database.Collection("post").UpdateOne(ctx, bson.M{"_id": postHex}, bson.M{"$inc": bson.M{"commentCount": 1}})
+	})
 	if err != nil {
 		fmt.Println(err.Error())
 		return "", errors.New("failed to add new comment")
 	}
+	return newComment.ID.Hex(), nil
+}
 
-	// converting primitive object to string
-	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
-		return oid.Hex(), nil
+func (r *contentRepository) FindComment(commentID string) (*model.Comment, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment")
+
+	commentHex, err := primitive.ObjectIDFromHex(commentID)
+	if err != nil {
+		return nil, errors.New("couldn't find a comment")
+	}
+	var existingComment model.Comment
+	err = collection.FindOne(context.Background(), bson.M{"_id": commentHex}).Decode(&existingComment)
+	return &existingComment, err
+}
+
+func (r *contentRepository) UpdateComment(commentID string, content string, mentions []model.MentionEntity) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment")
+	commentHex, err := primitive.ObjectIDFromHex(commentID)
+	if err != nil {
+		return errors.New("couldn't find a comment")
+	}
+	now := time.Now()
+	filter := bson.M{"_id": commentHex, "isDeleted": bson.M{"$ne": true}}
+	update := bson.M{"$set": bson.M{"content": content, "updatedDatetime": &now, "mentions": mentions, "mentionedUserIDs": mentionedUserIDs(mentions)}}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		fmt.Println("Error updating comment:", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("couldn't find a comment")
+	}
+	return nil
+}
+
+// comments are soft deleted so the thread can keep a placeholder in its place
+func (r *contentRepository) DeleteComment(commentID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment")
+	commentHex, err := primitive.ObjectIDFromHex(commentID)
+	if err != nil {
+		return errors.New("couldn't find a comment")
+	}
+	now := time.Now()
+	filter := bson.M{"_id": commentHex, "isDeleted": bson.M{"$ne": true}}
+	update := bson.M{"$set": bson.M{"content": "", "isDeleted": true, "updatedDatetime": &now, "mentions": bson.A{}, "mentionedUserIDs": bson.A{}}}
+	postCollection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	_, err = withTransaction(r.mongoClient, func(ctx mongo.SessionContext) (interface{}, error) {
+		var comment model.Comment
+		if err := collection.FindOneAndUpdate(ctx, filter, update).Decode(&comment); err != nil {
+			return nil, err
+		}
+		postHex, err := primitive.ObjectIDFromHex(comment.PostID)
+		if err != nil {
+			return nil, nil
+		}
+		return postCollection.UpdateOne(ctx, bson.M{"_id": postHex}, bson.M{"$inc": bson.M{"commentCount": -1}})
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return errors.New("couldn't find a comment")
+	}
+	if err != nil {
+		fmt.Println("Error deleting comment:", err)
+		return err
 	}
-	return "", errors.New("there are some errors when adding a new comment")
+	return nil
+}
+
+func (r *contentRepository) IsCommentLikeByUserID(userID string, commentID string) (bool, error) {
+	filter := bson.M{"userID": userID, "commentID": commentID}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment_like")
+	var likeComment model.LikeComment
+	err := collection.FindOne(context.Background(), filter).Decode(&likeComment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		} else {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// the unique index on (userID, commentID) rejects a second like, so a racing insert is treated as already liked
+func (r *contentRepository) LikeComment(userID string, postID string, commentID string) error {
+	likeComment := model.LikeComment{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		PostID:    postID,
+		CommentID: commentID,
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment_like")
+	_, err := collection.InsertOne(context.Background(), likeComment)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *contentRepository) UnlikeComment(userID string, commentID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment_like")
+	filter := bson.M{"userID": userID, "commentID": commentID}
+	_, err := collection.DeleteOne(context.Background(), filter)
+	if err != nil {
+		fmt.Println("Error deleting document:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *contentRepository) GetCommentLikeSummaries(userID string, commentIDs []string) ([]model.CommentLikeSummary, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment_like")
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", bson.D{{"commentID", bson.D{{"$in", commentIDs}}}}}},
+		bson.D{
+			{"$group",
+				bson.D{
+					{"_id", "$commentID"},
+					{"totalLikes", bson.D{{"$sum", 1}}},
+					{"isLike", bson.D{{"$max", bson.D{{"$eq", bson.A{"$userID", userID}}}}}},
+				},
+			},
+		},
+	}
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error creating cursor:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var results []model.CommentLikeSummary
+	if err = cursor.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
 func (r *contentRepository) IsPostLikeByUserID(userID string, postID string) (bool, error) {
@@ -141,148 +317,527 @@ func (r *contentRepository) IsPostLikeByUserID(userID string, postID string) (bo
 	return true, nil
 }
 
-func (r *contentRepository) LikePost(userID string, postID string) (string, error) {
+// LikePost is idempotent, false means the post was already liked and nothing changed
+func (r *contentRepository) LikePost(userID string, postID string) (bool, error) {
 	likePost := model.LikePost{
 		ID:     primitive.NewObjectID(),
 		UserID: userID,
 		PostID: postID,
 	}
-	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("like")
-	result, err := collection.InsertOne(context.Background(), likePost)
+	postHex, err := primitive.ObjectIDFromHex(postID)
 	if err != nil {
-		return "", err
+		return false, errors.New("couldn't find a post")
 	}
-	oid, ok := result.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return "", errors.New("there are some errors when liking a post")
+	database := r.mongoClient.Database(r.envConfig.DatabaseName)
+	_, err = withTransaction(r.mongoClient, func(ctx mongo.SessionContext) (interface{}, error) {
+		if _, err := database.Collection("like").InsertOne(ctx, likePost); err != nil {
+			return nil, err
+		}
+		return database.Collection("post").UpdateOne(ctx, bson.M{"_id": postHex}, bson.M{"$inc": bson.M{"likeCount": 1}})
+	})
+	// the unique index on (userID, postID) rejects a second like
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
 	}
-
-	return oid.Hex(), nil
+	if err != nil {
+		fmt.Println("Error liking post:", err)
+		return false, err
+	}
+	return true, nil
 }
 
-func (r *contentRepository) UnlikePost(userID string, postID string) error {
-	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("like")
+// UnlikePost is idempotent, false means the post wasn't liked and nothing changed
+func (r *contentRepository) UnlikePost(userID string, postID string) (bool, error) {
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return false, errors.New("couldn't find a post")
+	}
+	database := r.mongoClient.Database(r.envConfig.DatabaseName)
 	filter := bson.M{"userID": userID, "postID": postID}
-	result, err := collection.DeleteOne(context.Background(), filter)
+	_, err = withTransaction(r.mongoClient, func(ctx mongo.SessionContext) (interface{}, error) {
+		result, err := database.Collection("like").DeleteOne(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if result.DeletedCount == 0 {
+			return nil, errNothingDeleted
+		}
+		return database.Collection("post").UpdateOne(ctx, bson.M{"_id": postHex}, bson.M{"$inc": bson.M{"likeCount": -1}})
+	})
+	if errors.Is(err, errNothingDeleted) {
+		return false, nil
+	}
 	if err != nil {
-		fmt.Println("Error deleting document:", err)
+		fmt.Println("Error unliking post:", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *contentRepository) GetPendingPosts(userID string) ([]model.Post, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	findOptions := options.Find().SetSort(bson.D{{"publishAt", 1}})
+	cursor, err := collection.Find(context.Background(), bson.M{"userID": userID, "status": model.PostStatusPending}, findOptions)
+	if err != nil {
+		fmt.Println("Error finding pending posts:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	posts := []model.Post{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *contentRepository) GetDuePendingPosts(now time.Time, limit int) ([]model.Post, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	filter := bson.M{"status": model.PostStatusPending, "publishAt": bson.M{"$lte": now}}
+	findOptions := options.Find().SetSort(bson.D{{"publishAt", 1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		fmt.Println("Error finding due posts:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	posts := []model.Post{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// PublishPendingPost reports false when the post was already published or cancelled by someone else
+func (r *contentRepository) PublishPendingPost(postID string, now time.Time) (bool, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return false, errors.New("couldn't find a post")
+	}
+	filter := bson.M{"_id": postHex, "status": model.PostStatusPending, "publishAt": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"status": model.PostStatusPublished, "createdDatetime": &now, "fanoutStatus": model.FanoutStatusPending}}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		fmt.Println("Error publishing post:", err)
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *contentRepository) ReschedulePendingPost(postID string, publishAt time.Time) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return errors.New("couldn't find a post")
+	}
+	filter := bson.M{"_id": postHex, "status": model.PostStatusPending}
+	result, err := collection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"publishAt": &publishAt}})
+	if err != nil {
+		fmt.Println("Error rescheduling post:", err)
 		return err
 	}
-	if result.DeletedCount == 1 {
-		fmt.Println("Successfully deleted one document")
-		return nil
+	if result.MatchedCount == 0 {
+		return errors.New("couldn't find a scheduled post")
 	}
-	return errors.New("no documents were deleted")
+	return nil
 }
 
-func (r *contentRepository) CountLikeAndCommentOnPost(postID string) (int64, int64, error) {
-	likeCollection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("like")
-	filter := bson.M{"postID": postID}
+func (r *contentRepository) DeletePendingPost(postID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return errors.New("couldn't find a post")
+	}
+	result, err := collection.DeleteOne(context.Background(), bson.M{"_id": postHex, "status": model.PostStatusPending})
+	if err != nil {
+		fmt.Println("Error deleting post:", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("couldn't find a scheduled post")
+	}
+	return nil
+}
 
-	likeCount, err := likeCollection.CountDocuments(context.Background(), filter)
+// UpdatePostMedia copies the processed media onto every post still waiting for it, alt text is kept per post.
+// It returns how many posts were updated so each one can take a reference on the stored files.
+func (r *contentRepository) UpdatePostMedia(mediaID string, attachment model.MediaAttachment) (int64, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	update := bson.M{"$set": bson.M{
+		"media.$[m].url":       attachment.Url,
+		"media.$[m].fileID":    attachment.FileID,
+		"media.$[m].width":     attachment.Width,
+		"media.$[m].height":    attachment.Height,
+		"media.$[m].blurhash":  attachment.Blurhash,
+		"media.$[m].variants":  attachment.Variants,
+		"media.$[m].type":      attachment.Type,
+		"media.$[m].status":    attachment.Status,
+		"media.$[m].duration":  attachment.Duration,
+		"media.$[m].posterUrl": attachment.PosterUrl,
+	}}
+	updateOptions := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"m.mediaID": mediaID, "m.status": model.MediaStatusProcessing}},
+	})
+	filter := bson.M{"media": bson.M{"$elemMatch": bson.M{"mediaID": mediaID, "status": model.MediaStatusProcessing}}}
+	result, err := collection.UpdateMany(context.Background(), filter, update, updateOptions)
 	if err != nil {
-		return 0, 0, err
+		fmt.Println("Error updating post media:", err)
+		return 0, err
 	}
+	return result.ModifiedCount, nil
+}
 
-	commentCollection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("comment")
-	commentCount, err := commentCollection.CountDocuments(context.Background(), filter)
+func (r *contentRepository) GetProcessingPostsByMediaID(mediaID string) ([]model.Post, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	cursor, err := collection.Find(context.Background(), bson.M{"media.mediaID": mediaID, "mediaStatus": model.MediaStatusProcessing})
 	if err != nil {
-		return 0, 0, err
+		fmt.Println("Error finding processing posts:", err)
+		return nil, err
 	}
+	defer cursor.Close(context.Background())
 
-	return likeCount, commentCount, nil
+	posts := []model.Post{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		fmt.Println("Error decoding processing posts:", err)
+		return nil, err
+	}
+	return posts, nil
 }
 
-func (r *contentRepository) GetPosts(userID string, limit int, timeFrom *time.Time, postFilter, username string) (*model.PostDetailPagination, error) {
-	fmt.Println(postFilter)
-	fmt.Println(username)
-	fmt.Println(timeFrom)
+func (r *contentRepository) GetStaleProcessingPosts(createdBefore time.Time, limit int) ([]model.Post, error) {
 	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
-	// for following posts
-	projectCurrentUserAsString := bson.D{
-		{"$project",
-			bson.D{
-				{"userID", "$userID"},
-				{"title", "$title"},
-				{"content", "$content"},
-				{"imageUrl", "$imageUrl"},
-				{"createdDatetime", "$createdDatetime"},
-				{"currentUserID", userID},
-				{"ogTitle", "$ogTitle"},
-				{"ogDescription", "$ogDescription"},
-				{"ogLink", "$ogLink"},
-				{"ogImage", "$ogImage"},
-				{"ogDomain", "$ogDomain"},
-			},
-		},
+	filter := bson.M{"mediaStatus": model.MediaStatusProcessing, "createdDatetime": bson.M{"$lt": createdBefore}}
+	cursor, err := collection.Find(context.Background(), filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		fmt.Println("Error finding stale processing posts:", err)
+		return nil, err
 	}
-	mergingFollowStage := bson.D{
-		{"$lookup",
-			bson.D{
-				{"from", "follow"},
-				{"localField", "currentUserID"},
-				{"foreignField", "userID"},
-				{"as", "results"},
-			},
-		},
+	defer cursor.Close(context.Background())
+
+	posts := []model.Post{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		fmt.Println("Error decoding stale processing posts:", err)
+		return nil, err
 	}
+	return posts, nil
+}
 
-	getFollowingListStage := bson.D{
-		{"$project",
-			bson.D{
-				{"userID", "$userID"},
-				{"title", "$title"},
-				{"content", "$content"},
-				{"imageUrl", "$imageUrl"},
-				{"createdDatetime", "$createdDatetime"},
-				{"currentUserID", "$currentUserID"},
-				{"followUserList", "$results.followUserID"},
-				{"ogTitle", "$ogTitle"},
-				{"ogDescription", "$ogDescription"},
-				{"ogLink", "$ogLink"},
-				{"ogImage", "$ogImage"},
-				{"ogDomain", "$ogDomain"},
-			},
-		},
+// FinishPostMediaProcessing moves a post out of PROCESSING, false means another worker got there first
+func (r *contentRepository) FinishPostMediaProcessing(postID string, mediaStatus string) (bool, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return false, errors.New("couldn't find a post")
 	}
+	filter := bson.M{"_id": postHex, "mediaStatus": model.MediaStatusProcessing}
+	result, err := collection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"mediaStatus": mediaStatus}})
+	if err != nil {
+		fmt.Println("Error finishing post media processing:", err)
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// the unique index on (postID, userID) makes a second vote fail even when two requests race
+func (r *contentRepository) VotePoll(userID string, postID string, optionIndex int) error {
+	now := time.Now()
+	vote := model.PollVote{
+		ID:              primitive.NewObjectID(),
+		PostID:          postID,
+		UserID:          userID,
+		OptionIndex:     optionIndex,
+		CreatedDatetime: &now,
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("poll_vote")
+	_, err := collection.InsertOne(context.Background(), vote)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *contentRepository) IsPostRepostedByUserID(userID string, postID string) (bool, error) {
+	filter := bson.M{"userID": userID, "postID": postID}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("repost")
+	var repost model.Repost
+	err := collection.FindOne(context.Background(), filter).Decode(&repost)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		} else {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (r *contentRepository) RepostPost(userID string, postID string) error {
+	now := time.Now()
+	repost := model.Repost{
+		ID:              primitive.NewObjectID(),
+		UserID:          userID,
+		PostID:          postID,
+		CreatedDatetime: &now,
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("repost")
+	_, err := collection.InsertOne(context.Background(), repost)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *contentRepository) UnrepostPost(userID string, postID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("repost")
+	filter := bson.M{"userID": userID, "postID": postID}
+	_, err := collection.DeleteOne(context.Background(), filter)
+	if err != nil {
+		fmt.Println("Error deleting document:", err)
+		return err
+	}
+	return nil
+}
 
-	getMatchingPostStage := bson.D{
-		{"$match",
+func (r *contentRepository) IsPostReactedByUserID(userID string, postID string, emoji string) (bool, error) {
+	filter := bson.M{"userID": userID, "postID": postID, "emoji": emoji}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("reaction")
+	var reaction model.Reaction
+	err := collection.FindOne(context.Background(), filter).Decode(&reaction)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		} else {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (r *contentRepository) AddReaction(userID string, postID string, emoji string) error {
+	now := time.Now()
+	reaction := model.Reaction{
+		ID:              primitive.NewObjectID(),
+		UserID:          userID,
+		PostID:          postID,
+		Emoji:           emoji,
+		CreatedDatetime: &now,
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("reaction")
+	_, err := collection.InsertOne(context.Background(), reaction)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *contentRepository) RemoveReaction(userID string, postID string, emoji string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("reaction")
+	filter := bson.M{"userID": userID, "postID": postID, "emoji": emoji}
+	_, err := collection.DeleteOne(context.Background(), filter)
+	if err != nil {
+		fmt.Println("Error deleting document:", err)
+		return err
+	}
+	return nil
+}
+
+// CountLikeAndCommentOnPost reads the counters kept on the post
+func (r *contentRepository) CountLikeAndCommentOnPost(postID string) (int64, int64, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return 0, 0, errors.New("couldn't find a post")
+	}
+	var counters model.PostCounters
+	opts := options.FindOne().SetProjection(bson.M{"likeCount": 1, "commentCount": 1})
+	err = collection.FindOne(context.Background(), bson.M{"_id": postHex}, opts).Decode(&counters)
+	if err != nil {
+		return 0, 0, err
+	}
+	var likeCount, commentCount int64
+	if counters.LikeCount != nil {
+		likeCount = *counters.LikeCount
+	}
+	if counters.CommentCount != nil {
+		commentCount = *counters.CommentCount
+	}
+	return likeCount, commentCount, nil
+}
+
+func (r *contentRepository) GetPosts(userID string, limit int, after *model.Cursor, postFilter, username, hashtag string) (*model.PostDetailPagination, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	// the following feed is read from timelines, see GetPostsByIDs
+	sortField := "createdDatetime"
+	sortingStage := bson.D{{"$sort", bson.D{{sortField, -1}, {"_id", -1}}}}
+
+	paginationQueryStage := bson.D{
+		{"$facet",
 			bson.D{
-				{"$or",
+				{"pagination",
 					bson.A{
+						bson.D{{"$count", "total"}},
 						bson.D{
-							{"$expr",
+							{"$addFields",
 								bson.D{
-									{"$in",
-										bson.A{
-											"$userID",
-											"$followUserList",
-										},
-									},
+									{"limit", limit},
 								},
 							},
 						},
-						bson.D{
-							{"$expr",
-								bson.D{
-									{"$eq",
-										bson.A{
-											"$currentUserID",
-											"$userID",
-										},
-									},
-								},
+					},
+				},
+				// one extra post tells whether there is another page
+				{"data",
+					bson.A{
+						bson.D{{"$limit", limit + 1}},
+					},
+				},
+			},
+		},
+	}
+
+	paginationExtractingstage := bson.D{
+		{"$project",
+			bson.D{
+				{"pagination",
+					bson.D{
+						{"$arrayElemAt",
+							bson.A{
+								"$pagination",
+								0,
 							},
 						},
 					},
 				},
+				{"posts", "$data"},
 			},
 		},
 	}
 
-	// end for following posts
-	sortingStage := bson.D{{"$sort", bson.D{{"createdDatetime", -1}}}}
+	matchUserStage := bson.D{{"$match", bson.D{{"username", username}}}}
+	matchHashtagStage := bson.D{{"$match", bson.D{{"hashtags", hashtag}}}}
+	matchMentionStage := bson.D{{"$match", bson.D{{"mentionedUserIDs", userID}}}}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", visiblePostFilter(userID)}},
+	}
+	if postFilter == "USER" && username == "" {
+		return nil, errors.New("username cannot be empty")
+	} else if postFilter == "HASHTAG" {
+		if hashtag == "" {
+			return nil, errors.New("hashtag cannot be empty")
+		}
+		pipeline = append(pipeline, matchHashtagStage)
+	} else if postFilter == "MENTION" {
+		pipeline = append(pipeline, matchMentionStage)
+	}
+	if after != nil {
+		pipeline = append(pipeline, bson.D{{"$match", afterCursorFilter(sortField, after, -1)}})
+	}
+	pipeline = append(pipeline, sortingStage)
+	pipeline = append(pipeline, postDetailStages(userID)...)
+	if postFilter == "USER" {
+		pipeline = append(pipeline, matchUserStage)
+	}
+	pipeline = append(pipeline, paginationQueryStage, paginationExtractingstage)
+
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error creating cursor:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var results []model.PostDetailPagination
+	if err = cursor.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+
+	if len(results) <= 0 {
+		return nil, errors.New("couldn't find a post")
+	}
+	page := &results[0]
+	page.Pagination.Limit = limit
+	if len(page.Posts) > limit {
+		page.Pagination.HasMore = true
+		page.Posts = page.Posts[:limit]
+	}
+	return page, nil
+}
+
+// afterCursorFilter matches what comes after the cursor in a list sorted by (field, _id),
+// direction is -1 for newest first and 1 for oldest first
+func afterCursorFilter(field string, after *model.Cursor, direction int) bson.M {
+	operator := "$lt"
+	if direction > 0 {
+		operator = "$gt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{operator: after.Datetime}},
+		bson.M{field: after.Datetime, "_id": bson.M{operator: after.ID}},
+	}}
+}
+
+// GetPostsByIDs loads the visible posts of a feed page, the caller puts them back in feed order.
+// The following feed fills in repostedBy and feedDatetime from the timeline entries.
+func (r *contentRepository) GetPostsByIDs(userID string, postIDs []primitive.ObjectID) ([]model.PostDetail, error) {
+	if len(postIDs) == 0 {
+		return []model.PostDetail{}, nil
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", bson.D{{"_id", bson.D{{"$in", postIDs}}}}}},
+		bson.D{{"$match", visiblePostFilter(userID)}},
+	}
+	pipeline = append(pipeline, postDetailStages(userID)...)
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error finding posts by ids:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	posts := []model.PostDetail{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *contentRepository) GetPostByID(userID, postID string) (*model.PostDetail, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return nil, errors.New("couldn't find a post")
+	}
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", bson.D{{"_id", postHex}}}},
+		bson.D{{"$match", visiblePostFilter(userID)}},
+	}
+	pipeline = append(pipeline, postDetailStages(userID)...)
+
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error creating cursor:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var results []model.PostDetail
+	if err = cursor.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+	if len(results) <= 0 {
+		return nil, errors.New("couldn't find a post")
+	}
+	return &results[0], nil
+}
+
+// postDetailStages turns post documents into model.PostDetail shaped documents
+// with author, like and comment information for the given viewer
+func postDetailStages(userID string) mongo.Pipeline {
 	projectConversionForSearchingStage := bson.D{
 		{"$project",
 			bson.D{
@@ -298,16 +853,36 @@ func (r *contentRepository) GetPosts(userID string, limit int, timeFrom *time.Ti
 				{"ogLink", "$ogLink"},
 				{"ogImage", "$ogImage"},
 				{"ogDomain", "$ogDomain"},
+				{"mediaStatus", "$mediaStatus"},
+				{"media", "$media"},
+				{"status", "$status"},
+				{"publishAt", "$publishAt"},
+				{"poll", "$poll"},
+				{"mentions", "$mentions"},
+				{"quotePostID", "$quotePostID"},
+				{"repostedBy", "$repostedBy"},
+				{"feedDatetime", bson.D{{"$ifNull", bson.A{"$feedDatetime", "$createdDatetime"}}}},
+				{"likeCount", "$likeCount"},
+				{"commentCount", "$commentCount"},
 			},
 		},
 	}
-	timeAfterStage := bson.D{{"$match", bson.D{{"createdDatetime", bson.D{{"$lte", timeFrom}}}}}}
+
+	// totals come from the counters on the post, the lookups only find the current user's own like and comment
 	likeMergingStage := bson.D{
 		{"$lookup",
 			bson.D{
 				{"from", "like"},
-				{"localField", "stringPostID"},
-				{"foreignField", "postID"},
+				{"let", bson.D{{"postID", "$stringPostID"}}},
+				{"pipeline",
+					bson.A{
+						bson.D{{"$match", bson.D{
+							{"userID", userID},
+							{"$expr", bson.D{{"$eq", bson.A{"$postID", "$$postID"}}}},
+						}}},
+						bson.D{{"$limit", 1}},
+					},
+				},
 				{"as", "likeResult"},
 			},
 		},
@@ -323,12 +898,22 @@ func (r *contentRepository) GetPosts(userID string, limit int, timeFrom *time.Ti
 				{"imageUrl", "$imageUrl"},
 				{"objectUserID", "$objectUserID"},
 				{"stringPostID", "$stringPostID"},
-				{"totalLikes", bson.D{{"$size", "$likeResult"}}},
+				{"totalLikes", bson.D{{"$ifNull", bson.A{"$likeCount", 0}}}},
+				{"commentCount", "$commentCount"},
 				{"ogTitle", "$ogTitle"},
 				{"ogDescription", "$ogDescription"},
 				{"ogLink", "$ogLink"},
 				{"ogImage", "$ogImage"},
 				{"ogDomain", "$ogDomain"},
+				{"mediaStatus", "$mediaStatus"},
+				{"media", "$media"},
+				{"status", "$status"},
+				{"publishAt", "$publishAt"},
+				{"poll", "$poll"},
+				{"mentions", "$mentions"},
+				{"quotePostID", "$quotePostID"},
+				{"repostedBy", "$repostedBy"},
+				{"feedDatetime", "$feedDatetime"},
 				{"isLike",
 					bson.D{
 						{"$ifNull",
@@ -350,12 +935,22 @@ func (r *contentRepository) GetPosts(userID string, limit int, timeFrom *time.Ti
 		},
 	}
 
+	// deleted comments stay in the collection as placeholders, so only live ones count
 	commentMergingStage := bson.D{
 		{"$lookup",
 			bson.D{
 				{"from", "comment"},
-				{"localField", "stringPostID"},
-				{"foreignField", "postID"},
+				{"let", bson.D{{"postID", "$stringPostID"}}},
+				{"pipeline",
+					bson.A{
+						bson.D{{"$match", bson.D{
+							{"userID", userID},
+							{"isDeleted", bson.D{{"$ne", true}}},
+							{"$expr", bson.D{{"$eq", bson.A{"$postID", "$$postID"}}}},
+						}}},
+						bson.D{{"$limit", 1}},
+					},
+				},
 				{"as", "commentResult"},
 			},
 		},
@@ -372,13 +967,22 @@ func (r *contentRepository) GetPosts(userID string, limit int, timeFrom *time.Ti
 				{"objectUserID", "$objectUserID"},
 				{"stringPostID", "$stringPostID"},
 				{"totalLikes", "$totalLikes"},
-				{"totalComments", bson.D{{"$size", "$commentResult"}}},
+				{"totalComments", bson.D{{"$ifNull", bson.A{"$commentCount", 0}}}},
 				{"isLike", "$isLike"},
 				{"ogTitle", "$ogTitle"},
 				{"ogDescription", "$ogDescription"},
 				{"ogLink", "$ogLink"},
 				{"ogImage", "$ogImage"},
 				{"ogDomain", "$ogDomain"},
+				{"mediaStatus", "$mediaStatus"},
+				{"media", "$media"},
+				{"status", "$status"},
+				{"publishAt", "$publishAt"},
+				{"poll", "$poll"},
+				{"mentions", "$mentions"},
+				{"quotePostID", "$quotePostID"},
+				{"repostedBy", "$repostedBy"},
+				{"feedDatetime", "$feedDatetime"},
 				{"isComment",
 					bson.D{
 						{"$ifNull",
@@ -400,337 +1004,156 @@ func (r *contentRepository) GetPosts(userID string, limit int, timeFrom *time.Ti
 		},
 	}
 
-	userMergingStage := bson.D{
+	// heart reactions live in the like collection and are merged in by the service
+	reactionMergingStage := bson.D{
 		{"$lookup",
 			bson.D{
-				{"from", "user"},
-				{"localField", "objectUserID"},
-				{"foreignField", "_id"},
-				{"as", "userResult"},
-			},
-		},
-	}
-
-	projectUserMappingStage := bson.D{
-		{"$project",
-			bson.D{
-				{"_id", "$_id"},
-				{"content", "$content"},
-				{"userID", "$userID"},
-				{"createdDatetime", "$createdDatetime"},
-				{"imageUrl", "$imageUrl"},
-				{"objectUserID", "$objectUserID"},
-				{"stringPostID", "$stringPostID"},
-				{"totalLikes", "$totalLikes"},
-				{"totalComments", "$totalComments"},
-				{"username", bson.D{{"$first", "$userResult.username"}}},
-				{"displayName", bson.D{{"$first", "$userResult.displayName"}}},
-				{"profileImage", bson.D{{"$first", "$userResult.profileImage"}}},
-				{"isLike", "$isLike"},
-				{"isComment", "$isComment"},
-				{"ogTitle", "$ogTitle"},
-				{"ogDescription", "$ogDescription"},
-				{"ogLink", "$ogLink"},
-				{"ogImage", "$ogImage"},
-				{"ogDomain", "$ogDomain"},
+				{"from", "reaction"},
+				{"localField", "stringPostID"},
+				{"foreignField", "postID"},
+				{"as", "reactionResult"},
 			},
 		},
 	}
 
-	paginationQueryStage := bson.D{
-		{"$facet",
+	projectCountingReactionStage := bson.D{
+		{"$addFields",
 			bson.D{
-				{"pagination",
-					bson.A{
-						bson.D{{"$count", "total"}},
-						bson.D{
-							{"$addFields",
-								bson.D{
-									{"limit", limit},
+				{"reactions",
+					bson.D{
+						{"$map",
+							bson.D{
+								{"input", bson.D{{"$setUnion", bson.A{"$reactionResult.emoji"}}}},
+								{"as", "emoji"},
+								{"in",
+									bson.D{
+										{"emoji", "$$emoji"},
+										{"count",
+											bson.D{
+												{"$size",
+													bson.D{
+														{"$filter",
+															bson.D{
+																{"input", "$reactionResult"},
+																{"as", "reaction"},
+																{"cond", bson.D{{"$eq", bson.A{"$$reaction.emoji", "$$emoji"}}}},
+															},
+														},
+													},
+												},
+											},
+										},
+									},
 								},
 							},
 						},
 					},
 				},
-				{"data",
-					bson.A{
-						bson.D{{"$limit", limit}},
-					},
-				},
-			},
-		},
-	}
-
-	paginationExtractingstage := bson.D{
-		{"$project",
-			bson.D{
-				{"pagination",
+				{"myReactions",
 					bson.D{
-						{"$arrayElemAt",
-							bson.A{
-								"$pagination",
-								0,
+						{"$map",
+							bson.D{
+								{"input",
+									bson.D{
+										{"$filter",
+											bson.D{
+												{"input", "$reactionResult"},
+												{"as", "reaction"},
+												{"cond", bson.D{{"$eq", bson.A{"$$reaction.userID", userID}}}},
+											},
+										},
+									},
+								},
+								{"as", "reaction"},
+								{"in", "$$reaction.emoji"},
 							},
 						},
 					},
 				},
-				{"posts", "$data"},
 			},
 		},
 	}
 
-	matchUserStage := bson.D{{"$match", bson.D{{"username", username}}}}
-
-	// DEFAULT FILTER (GLOBAL FEEDS)
-	pipeline := mongo.Pipeline{
-		sortingStage,
-		projectConversionForSearchingStage,
-		likeMergingStage,
-		projectCountingLikeStage,
-		commentMergingStage,
-		projectCountingCommentStage,
-		userMergingStage,
-		projectUserMappingStage,
-		paginationQueryStage,
-		paginationExtractingstage,
-	}
-
-	if timeFrom != nil {
-		pipeline = mongo.Pipeline{
-			sortingStage,
-			timeAfterStage,
-			projectConversionForSearchingStage,
-			likeMergingStage,
-			projectCountingLikeStage,
-			commentMergingStage,
-			projectCountingCommentStage,
-			userMergingStage,
-			projectUserMappingStage,
-			paginationQueryStage,
-			paginationExtractingstage,
-		}
-	}
-
-	// FOLLOWING FEED FILTER
-	if postFilter == "FOLLOWING_POST" {
-		pipeline = mongo.Pipeline{
-			projectCurrentUserAsString,
-			mergingFollowStage,
-			getFollowingListStage,
-			getMatchingPostStage,
-			sortingStage,
-			projectConversionForSearchingStage,
-			likeMergingStage,
-			projectCountingLikeStage,
-			commentMergingStage,
-			projectCountingCommentStage,
-			userMergingStage,
-			projectUserMappingStage,
-			paginationQueryStage,
-			paginationExtractingstage,
-		}
-		if timeFrom != nil {
-			pipeline = mongo.Pipeline{
-				projectCurrentUserAsString,
-				mergingFollowStage,
-				getFollowingListStage,
-				getMatchingPostStage,
-				sortingStage,
-				timeAfterStage,
-				projectConversionForSearchingStage,
-				likeMergingStage,
-				projectCountingLikeStage,
-				commentMergingStage,
-				projectCountingCommentStage,
-				userMergingStage,
-				projectUserMappingStage,
-				paginationQueryStage,
-				paginationExtractingstage,
-			}
-		}
-	} else if postFilter == "USER" {
-		if username == "" {
-			return nil, errors.New("username cannot be empty")
-		}
-		pipeline = mongo.Pipeline{
-			sortingStage,
-			projectConversionForSearchingStage,
-			likeMergingStage,
-			projectCountingLikeStage,
-			commentMergingStage,
-			projectCountingCommentStage,
-			userMergingStage,
-			projectUserMappingStage,
-			matchUserStage,
-			paginationQueryStage,
-			paginationExtractingstage,
-		}
-
-		if timeFrom != nil {
-			pipeline = mongo.Pipeline{
-				sortingStage,
-				timeAfterStage,
-				projectConversionForSearchingStage,
-				likeMergingStage,
-				projectCountingLikeStage,
-				commentMergingStage,
-				projectCountingCommentStage,
-				userMergingStage,
-				projectUserMappingStage,
-				matchUserStage,
-				paginationQueryStage,
-				paginationExtractingstage,
-			}
-		}
-	}
-
-	cursor, err := collection.Aggregate(context.Background(), pipeline)
-	if err != nil {
-		fmt.Println("Error creating cursor:", err)
-		return nil, err
-	}
-	defer cursor.Close(context.Background())
-
-	var results []model.PostDetailPagination
-	if err = cursor.All(context.Background(), &results); err != nil {
-		return nil, err
-	}
-
-	if len(results) <= 0 {
-		return nil, errors.New("couldn't find a post")
-	}
-	fmt.Println(results)
-
-	return &results[0], nil
-}
-
-func (r *contentRepository) GetPostByID(userID, postID string) (*model.PostDetail, error) {
-	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
-
-	pipeline := mongo.Pipeline{
-		bson.D{
-			{"$project",
-				bson.D{
-					{"stringPostId", bson.D{{"$toString", "$_id"}}},
-					{"_id", "$_id"},
-					{"content", "$content"},
-					{"userID", "$userID"},
-					{"imageUrl", "$imageUrl"},
-					{"createdDatetime", "$createdDatetime"},
-					{"ogTitle", "$ogTitle"},
-					{"ogDescription", "$ogDescription"},
-					{"ogLink", "$ogLink"},
-					{"ogImage", "$ogImage"},
-					{"ogDomain", "$ogDomain"},
-				},
+	repostMergingStage := bson.D{
+		{"$lookup",
+			bson.D{
+				{"from", "repost"},
+				{"localField", "stringPostID"},
+				{"foreignField", "postID"},
+				{"as", "repostResult"},
 			},
 		},
-		bson.D{{"$match", bson.D{{"stringPostId", postID}}}},
-		bson.D{
-			{"$project",
-				bson.D{
-					{"_id", "$_id"},
-					{"content", "$content"},
-					{"userID", "$userID"},
-					{"createdDatetime", "$createdDatetime"},
-					{"imageUrl", "$imageUrl"},
-					{"stringPostID", bson.D{{"$toString", "$_id"}}},
-					{"objectUserID", bson.D{{"$toObjectId", "$userID"}}},
-					{"ogTitle", "$ogTitle"},
-					{"ogDescription", "$ogDescription"},
-					{"ogLink", "$ogLink"},
-					{"ogImage", "$ogImage"},
-					{"ogDomain", "$ogDomain"},
-				},
+	}
+
+	projectCountingRepostStage := bson.D{
+		{"$addFields",
+			bson.D{
+				{"totalReposts", bson.D{{"$size", "$repostResult"}}},
+				{"isRepost", bson.D{{"$in", bson.A{userID, "$repostResult.userID"}}}},
 			},
 		},
-		bson.D{
-			{"$lookup",
-				bson.D{
-					{"from", "like"},
-					{"localField", "stringPostID"},
-					{"foreignField", "postID"},
-					{"as", "likeResult"},
-				},
+	}
+
+	pollVoteMergingStage := bson.D{
+		{"$lookup",
+			bson.D{
+				{"from", "poll_vote"},
+				{"localField", "stringPostID"},
+				{"foreignField", "postID"},
+				{"as", "pollVoteResult"},
 			},
 		},
-		bson.D{
-			{"$project",
-				bson.D{
-					{"_id", "$_id"},
-					{"content", "$content"},
-					{"userID", "$userID"},
-					{"createdDatetime", "$createdDatetime"},
-					{"imageUrl", "$imageUrl"},
-					{"objectUserID", "$objectUserID"},
-					{"stringPostID", "$stringPostID"},
-					{"totalLikes", bson.D{{"$size", "$likeResult"}}},
-					{"ogTitle", "$ogTitle"},
-					{"ogDescription", "$ogDescription"},
-					{"ogLink", "$ogLink"},
-					{"ogImage", "$ogImage"},
-					{"ogDomain", "$ogDomain"},
-					{"isLike",
-						bson.D{
-							{"$ifNull",
-								bson.A{
+	}
+
+	// count votes per option index and find the viewer's own vote
+	projectCountingPollStage := bson.D{
+		{"$addFields",
+			bson.D{
+				{"pollVoteCounts",
+					bson.D{
+						{"$map",
+							bson.D{
+								{"input", bson.D{{"$range", bson.A{0, bson.D{{"$size", bson.D{{"$ifNull", bson.A{"$poll.options", bson.A{}}}}}}}}}},
+								{"as", "optionIndex"},
+								{"in",
 									bson.D{
-										{"$in",
-											bson.A{
-												userID,
-												"$likeResult.userID",
+										{"$size",
+											bson.D{
+												{"$filter",
+													bson.D{
+														{"input", "$pollVoteResult"},
+														{"as", "vote"},
+														{"cond", bson.D{{"$eq", bson.A{"$$vote.optionIndex", "$$optionIndex"}}}},
+													},
+												},
 											},
 										},
 									},
-									false,
 								},
 							},
 						},
 					},
 				},
-			},
-		},
-		bson.D{
-			{"$lookup",
-				bson.D{
-					{"from", "comment"},
-					{"localField", "stringPostID"},
-					{"foreignField", "postID"},
-					{"as", "commentResult"},
-				},
-			},
-		},
-		bson.D{
-			{"$project",
-				bson.D{
-					{"_id", "$_id"},
-					{"content", "$content"},
-					{"userID", "$userID"},
-					{"createdDatetime", "$createdDatetime"},
-					{"imageUrl", "$imageUrl"},
-					{"objectUserID", "$objectUserID"},
-					{"stringPostID", "$stringPostID"},
-					{"totalLikes", "$totalLikes"},
-					{"totalComments", bson.D{{"$size", "$commentResult"}}},
-					{"isLike", "$isLike"},
-					{"ogTitle", "$ogTitle"},
-					{"ogDescription", "$ogDescription"},
-					{"ogLink", "$ogLink"},
-					{"ogImage", "$ogImage"},
-					{"ogDomain", "$ogDomain"},
-					{"isComment",
-						bson.D{
-							{"$ifNull",
-								bson.A{
+				{"myPollVote",
+					bson.D{
+						{"$first",
+							bson.D{
+								{"$map",
 									bson.D{
-										{"$in",
-											bson.A{
-												userID,
-												"$commentResult.userID",
+										{"input",
+											bson.D{
+												{"$filter",
+													bson.D{
+														{"input", "$pollVoteResult"},
+														{"as", "vote"},
+														{"cond", bson.D{{"$eq", bson.A{"$$vote.userID", userID}}}},
+													},
+												},
 											},
 										},
+										{"as", "vote"},
+										{"in", "$$vote.optionIndex"},
 									},
-									false,
 								},
 							},
 						},
@@ -738,55 +1161,186 @@ func (r *contentRepository) GetPostByID(userID, postID string) (*model.PostDetai
 				},
 			},
 		},
-		bson.D{
-			{"$lookup",
-				bson.D{
-					{"from", "user"},
-					{"localField", "objectUserID"},
-					{"foreignField", "_id"},
-					{"as", "userResult"},
+	}
+
+	// embed the quoted post together with its author
+	quoteMergingStage := bson.D{
+		{"$lookup",
+			bson.D{
+				{"from", "post"},
+				{"let", bson.D{{"quotePostID", "$quotePostID"}}},
+				{"pipeline",
+					bson.A{
+						bson.D{{"$match", bson.D{{"$expr", bson.D{{"$eq", bson.A{"$_id", bson.D{{"$toObjectId", "$$quotePostID"}}}}}}}}},
+						bson.D{{"$addFields", bson.D{{"objectUserID", bson.D{{"$toObjectId", "$userID"}}}}}},
+						bson.D{
+							{"$lookup",
+								bson.D{
+									{"from", "user"},
+									{"localField", "objectUserID"},
+									{"foreignField", "_id"},
+									{"as", "userResult"},
+								},
+							},
+						},
+						bson.D{
+							{"$project",
+								bson.D{
+									{"_id", "$_id"},
+									{"userID", "$userID"},
+									{"content", "$content"},
+									{"createdDatetime", "$createdDatetime"},
+									{"imageUrl", "$imageUrl"},
+									{"media", "$media"},
+									{"username", bson.D{{"$first", "$userResult.username"}}},
+									{"displayName", bson.D{{"$first", "$userResult.displayName"}}},
+									{"profileImage", bson.D{{"$first", "$userResult.profileImage"}}},
+								},
+							},
+						},
+					},
 				},
+				{"as", "quoteResult"},
 			},
 		},
-		bson.D{
-			{"$project",
+	}
+
+	projectQuoteStage := bson.D{{"$addFields", bson.D{{"quotedPost", bson.D{{"$first", "$quoteResult"}}}}}}
+
+	userMergingStage := bson.D{
+		{"$lookup",
+			bson.D{
+				{"from", "user"},
+				{"localField", "objectUserID"},
+				{"foreignField", "_id"},
+				{"as", "userResult"},
+			},
+		},
+	}
+
+	projectUserMappingStage := bson.D{
+		{"$project",
+			bson.D{
+				{"_id", "$_id"},
+				{"content", "$content"},
+				{"userID", "$userID"},
+				{"createdDatetime", "$createdDatetime"},
+				{"imageUrl", "$imageUrl"},
+				{"objectUserID", "$objectUserID"},
+				{"stringPostID", "$stringPostID"},
+				{"totalLikes", "$totalLikes"},
+				{"totalComments", "$totalComments"},
+				{"username", bson.D{{"$first", "$userResult.username"}}},
+				{"displayName", bson.D{{"$first", "$userResult.displayName"}}},
+				{"profileImage", bson.D{{"$first", "$userResult.profileImage"}}},
+				{"isLike", "$isLike"},
+				{"isComment", "$isComment"},
+				{"ogTitle", "$ogTitle"},
+				{"ogDescription", "$ogDescription"},
+				{"ogLink", "$ogLink"},
+				{"ogImage", "$ogImage"},
+				{"ogDomain", "$ogDomain"},
+				{"mediaStatus", "$mediaStatus"},
+				{"media", "$media"},
+				{"status", "$status"},
+				{"publishAt", "$publishAt"},
+				{"poll", "$poll"},
+				{"pollVoteCounts", "$pollVoteCounts"},
+				{"myPollVote", "$myPollVote"},
+				{"mentions", "$mentions"},
+				{"quotePostID", "$quotePostID"},
+				{"repostedBy", "$repostedBy"},
+				{"feedDatetime", "$feedDatetime"},
+				{"quotedPost", "$quotedPost"},
+				{"totalReposts", "$totalReposts"},
+				{"isRepost", "$isRepost"},
+				{"reactions", "$reactions"},
+				{"myReactions", "$myReactions"},
+			},
+		},
+	}
+
+	return mongo.Pipeline{
+		projectConversionForSearchingStage,
+		likeMergingStage,
+		projectCountingLikeStage,
+		commentMergingStage,
+		projectCountingCommentStage,
+		reactionMergingStage,
+		projectCountingReactionStage,
+		repostMergingStage,
+		projectCountingRepostStage,
+		pollVoteMergingStage,
+		projectCountingPollStage,
+		quoteMergingStage,
+		projectQuoteStage,
+		userMergingStage,
+		projectUserMappingStage,
+	}
+}
+
+func mentionedUserIDs(mentions []model.MentionEntity) []string {
+	userIDs := []string{}
+	for _, mention := range mentions {
+		userIDs = append(userIDs, mention.UserID)
+	}
+	return userIDs
+}
+
+// pending scheduled posts are only visible to their author
+func visiblePostFilter(userID string) bson.D {
+	return bson.D{
+		{"$or",
+			bson.A{
 				bson.D{
-					{"_id", "$_id"},
-					{"content", "$content"},
-					{"userID", "$userID"},
-					{"createdDatetime", "$createdDatetime"},
-					{"imageUrl", "$imageUrl"},
-					{"objectUserID", "$objectUserID"},
-					{"stringPostID", "$stringPostID"},
-					{"totalLikes", "$totalLikes"},
-					{"totalComments", "$totalComments"},
-					{"username", bson.D{{"$first", "$userResult.username"}}},
-					{"displayName", bson.D{{"$first", "$userResult.displayName"}}},
-					{"profileImage", bson.D{{"$first", "$userResult.profileImage"}}},
-					{"isLike", "$isLike"},
-					{"isComment", "$isComment"},
-					{"ogTitle", "$ogTitle"},
-					{"ogDescription", "$ogDescription"},
-					{"ogLink", "$ogLink"},
-					{"ogImage", "$ogImage"},
-					{"ogDomain", "$ogDomain"},
+					{"status", bson.D{{"$ne", model.PostStatusPending}}},
+					{"mediaStatus", bson.D{{"$nin", bson.A{model.MediaStatusProcessing, model.MediaStatusFailed}}}},
 				},
+				bson.D{{"userID", userID}},
 			},
 		},
 	}
-	cursor, err := collection.Aggregate(context.Background(), pipeline)
+}
+
+func (r *contentRepository) GetPendingPreviewPosts(createdBefore time.Time, limit int) ([]model.Post, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	filter := bson.M{"previewStatus": model.PreviewStatusPending, "createdDatetime": bson.M{"$lt": createdBefore}}
+	cursor, err := collection.Find(context.Background(), filter, options.Find().SetLimit(int64(limit)))
 	if err != nil {
-		fmt.Println("Error creating cursor:", err)
+		fmt.Println("Error finding pending preview posts:", err)
 		return nil, err
 	}
 	defer cursor.Close(context.Background())
 
-	var results []model.PostDetail
-	if err = cursor.All(context.Background(), &results); err != nil {
+	posts := []model.Post{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		fmt.Println("Error decoding pending preview posts:", err)
 		return nil, err
 	}
-	if len(results) <= 0 {
-		return nil, errors.New("couldn't find a post")
+	return posts, nil
+}
+
+// UpdatePostPreview copies the og fields and preview status of preview onto a post still waiting for previewUrl,
+// false means it was already done
+func (r *contentRepository) UpdatePostPreview(postID string, previewUrl string, preview *model.Post) (bool, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return false, errors.New("couldn't find a post")
 	}
-	return &results[0], nil
+	filter := bson.M{"_id": postHex, "previewUrl": previewUrl, "previewStatus": model.PreviewStatusPending}
+	update := bson.M{"$set": bson.M{
+		"ogTitle":       preview.OgTitle,
+		"ogDescription": preview.OgDescription,
+		"ogLink":        preview.OgLink,
+		"ogImage":       preview.OgImage,
+		"ogDomain":      preview.OgDomain,
+		"previewStatus": preview.PreviewStatus,
+	}}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		fmt.Println("Error updating post preview:", err)
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
 }
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CounterRepository interface {
+	GetPostCounters(afterPostID *primitive.ObjectID, limit int) ([]model.PostCounters, error)
+	CountPostLikes(postIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error)
+	CountPostComments(postIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error)
+	RepairPostCounters(seen model.PostCounters, likeCount int64, commentCount int64) (bool, error)
+}
+
+type counterRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewCounterRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) CounterRepository {
+	return &counterRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+// GetPostCounters pages through the counters of every post in id order
+func (r *counterRepository) GetPostCounters(afterPostID *primitive.ObjectID, limit int) ([]model.PostCounters, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	filter := bson.M{}
+	if afterPostID != nil {
+		filter["_id"] = bson.M{"$gt": *afterPostID}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{"_id", 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"likeCount": 1, "commentCount": 1})
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		fmt.Println("Error finding post counters:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	counters := []model.PostCounters{}
+	if err = cursor.All(context.Background(), &counters); err != nil {
+		fmt.Println("Error decoding post counters:", err)
+		return nil, err
+	}
+	return counters, nil
+}
+
+func (r *counterRepository) CountPostLikes(postIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	return r.countByPost("like", bson.D{}, postIDs)
+}
+
+// CountPostComments leaves out deleted comments, they stay in the collection as placeholders
+func (r *counterRepository) CountPostComments(postIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	return r.countByPost("comment", bson.D{{"isDeleted", bson.D{{"$ne", true}}}}, postIDs)
+}
+
+func (r *counterRepository) countByPost(collectionName string, filter bson.D, postIDs []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	counts := make(map[primitive.ObjectID]int64)
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+	stringPostIDs := bson.A{}
+	for _, postID := range postIDs {
+		stringPostIDs = append(stringPostIDs, postID.Hex())
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection(collectionName)
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", append(bson.D{{"postID", bson.D{{"$in", stringPostIDs}}}}, filter...)}},
+		bson.D{{"$group", bson.D{
+			{"_id", "$postID"},
+			{"count", bson.D{{"$sum", 1}}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error counting "+collectionName+":", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var results []struct {
+		PostID string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err = cursor.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		postID, err := primitive.ObjectIDFromHex(result.PostID)
+		if err != nil {
+			continue
+		}
+		counts[postID] = result.Count
+	}
+	return counts, nil
+}
+
+// RepairPostCounters only writes when the counters still hold the values seen before counting,
+// so a like or comment that lands in between is not overwritten, it is checked again on the next run
+func (r *counterRepository) RepairPostCounters(seen model.PostCounters, likeCount int64, commentCount int64) (bool, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	filter := bson.M{"_id": seen.ID, "likeCount": seen.LikeCount, "commentCount": seen.CommentCount}
+	update := bson.M{"$set": bson.M{"likeCount": likeCount, "commentCount": commentCount}}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		fmt.Println("Error repairing post counters:", err)
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
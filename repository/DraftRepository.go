@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DraftRepository interface {
+	CreateDraft(draft *model.Draft) (string, error)
+	GetDrafts(userID string) ([]model.Draft, error)
+	FindDraft(userID string, draftID string) (*model.Draft, error)
+	UpdateDraft(draft *model.Draft) error
+	DeleteDraft(userID string, draftID string) error
+}
+
+type draftRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewDraftRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) DraftRepository {
+	return &draftRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+func (r *draftRepository) CreateDraft(draft *model.Draft) (string, error) {
+	now := time.Now()
+	draft.ID = primitive.NewObjectID()
+	draft.CreatedDatetime = &now
+	draft.UpdatedDatetime = &now
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("draft")
+	_, err := collection.InsertOne(context.Background(), draft)
+	if err != nil {
+		fmt.Println("Error creating draft:", err)
+		return "", errors.New("failed to create new draft")
+	}
+	return draft.ID.Hex(), nil
+}
+
+func (r *draftRepository) GetDrafts(userID string) ([]model.Draft, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("draft")
+	findOptions := options.Find().SetSort(bson.D{{"updatedDatetime", -1}})
+	cursor, err := collection.Find(context.Background(), bson.M{"userID": userID}, findOptions)
+	if err != nil {
+		fmt.Println("Error finding drafts:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	drafts := []model.Draft{}
+	if err = cursor.All(context.Background(), &drafts); err != nil {
+		fmt.Println("Error decoding drafts:", err)
+		return nil, err
+	}
+	return drafts, nil
+}
+
+// drafts are always looked up together with their owner so nobody can read someone else's draft
+func (r *draftRepository) FindDraft(userID string, draftID string) (*model.Draft, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("draft")
+	draftHex, err := primitive.ObjectIDFromHex(draftID)
+	if err != nil {
+		return nil, errors.New("couldn't find a draft")
+	}
+	var draft model.Draft
+	err = collection.FindOne(context.Background(), bson.M{"_id": draftHex, "userID": userID}).Decode(&draft)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("couldn't find a draft")
+		}
+		return nil, err
+	}
+	return &draft, nil
+}
+
+func (r *draftRepository) UpdateDraft(draft *model.Draft) error {
+	now := time.Now()
+	draft.UpdatedDatetime = &now
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("draft")
+	filter := bson.M{"_id": draft.ID, "userID": draft.UserID}
+	update := bson.M{"$set": bson.M{
+		"content":         draft.Content,
+		"imageUrl":        draft.ImageUrl,
+		"ogTitle":         draft.OgTitle,
+		"ogDescription":   draft.OgDescription,
+		"ogLink":          draft.OgLink,
+		"ogImage":         draft.OgImage,
+		"ogDomain":        draft.OgDomain,
+		"updatedDatetime": draft.UpdatedDatetime,
+	}}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		fmt.Println("Error updating draft:", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("couldn't find a draft")
+	}
+	return nil
+}
+
+func (r *draftRepository) DeleteDraft(userID string, draftID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("draft")
+	draftHex, err := primitive.ObjectIDFromHex(draftID)
+	if err != nil {
+		return errors.New("couldn't find a draft")
+	}
+	result, err := collection.DeleteOne(context.Background(), bson.M{"_id": draftHex, "userID": userID})
+	if err != nil {
+		fmt.Println("Error deleting draft:", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("couldn't find a draft")
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const currentFeedRankingID = "current"
+
+// interactions the FOR_YOU feed counts towards author affinity
+var affinityCollections = []string{"like", "comment", "repost"}
+
+type FeedRankingRepository interface {
+	GetFeedRankingWeights(defaults model.FeedRankingWeights) (*model.FeedRankingWeights, error)
+	GetSecondDegreeUserIDs(userID string, followingIDs []string, limit int) ([]string, error)
+	GetCandidatePostsByAuthors(userID string, authorIDs []string, from, until time.Time, limit int) ([]model.PostDetail, error)
+	GetCandidatePostsByTerms(userID string, hashtags []string, domains []string, from, until time.Time, limit int) ([]model.PostDetail, error)
+	GetAuthorAffinities(userID string, since time.Time) (map[string]int, error)
+	SaveForYouRanking(ranking *model.ForYouRanking) error
+	GetForYouRanking(userID string, rankedDatetime time.Time) (*model.ForYouRanking, error)
+}
+
+type feedRankingRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewFeedRankingRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) FeedRankingRepository {
+	return &feedRankingRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+// GetFeedRankingWeights decodes the stored weights over the defaults, so a partial document only overrides what it sets.
+// Values the ranking can't work with fall back to their defaults.
+func (r *feedRankingRepository) GetFeedRankingWeights(defaults model.FeedRankingWeights) (*model.FeedRankingWeights, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("feed_ranking")
+	weights := defaults
+	err := collection.FindOne(context.Background(), bson.M{"_id": currentFeedRankingID}).Decode(&weights)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &defaults, nil
+		}
+		fmt.Println("Error finding feed ranking weights:", err)
+		return nil, err
+	}
+	if weights.CandidatesPerSource <= 0 {
+		weights.CandidatesPerSource = defaults.CandidatesPerSource
+	}
+	if weights.CandidateHours <= 0 {
+		weights.CandidateHours = defaults.CandidateHours
+	}
+	if weights.RecencyHalfLifeHours < 0 {
+		weights.RecencyHalfLifeHours = defaults.RecencyHalfLifeHours
+	}
+	if weights.AffinityDays < 0 {
+		weights.AffinityDays = defaults.AffinityDays
+	}
+	if weights.AuthorRepeatPenalty < 0 {
+		weights.AuthorRepeatPenalty = defaults.AuthorRepeatPenalty
+	}
+	if weights.MaxPostsPerAuthor < 0 {
+		weights.MaxPostsPerAuthor = defaults.MaxPostsPerAuthor
+	}
+	return &weights, nil
+}
+
+// GetSecondDegreeUserIDs returns the accounts most followed by the users the reader follows,
+// leaving out the reader and accounts they already follow
+func (r *feedRankingRepository) GetSecondDegreeUserIDs(userID string, followingIDs []string, limit int) ([]string, error) {
+	if len(followingIDs) == 0 {
+		return []string{}, nil
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("follow")
+	excludedIDs := append([]string{userID}, followingIDs...)
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", bson.D{
+			{"userID", bson.D{{"$in", followingIDs}}},
+			{"followUserID", bson.D{{"$nin", excludedIDs}}},
+		}}},
+		bson.D{{"$group", bson.D{
+			{"_id", "$followUserID"},
+			{"followedBy", bson.D{{"$sum", 1}}},
+		}}},
+		bson.D{{"$sort", bson.D{{"followedBy", -1}, {"_id", 1}}}},
+		bson.D{{"$limit", limit}},
+	}
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error finding second degree users:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var results []struct {
+		ID string `bson:"_id"`
+	}
+	if err = cursor.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+	userIDs := []string{}
+	for _, result := range results {
+		userIDs = append(userIDs, result.ID)
+	}
+	return userIDs, nil
+}
+
+func (r *feedRankingRepository) GetCandidatePostsByAuthors(userID string, authorIDs []string, from, until time.Time, limit int) ([]model.PostDetail, error) {
+	if len(authorIDs) == 0 {
+		return []model.PostDetail{}, nil
+	}
+	return r.getCandidatePosts(userID, bson.D{{"userID", bson.D{{"$in", authorIDs}}}}, from, until, limit)
+}
+
+// GetCandidatePostsByTerms finds posts using a trending hashtag or linking a trending domain
+func (r *feedRankingRepository) GetCandidatePostsByTerms(userID string, hashtags []string, domains []string, from, until time.Time, limit int) ([]model.PostDetail, error) {
+	if len(hashtags) == 0 && len(domains) == 0 {
+		return []model.PostDetail{}, nil
+	}
+	filter := bson.D{{"$or", bson.A{
+		bson.D{{"hashtags", bson.D{{"$in", hashtags}}}},
+		bson.D{{"ogDomain", bson.D{{"$in", domains}}}},
+	}}}
+	return r.getCandidatePosts(userID, filter, from, until, limit)
+}
+
+// getCandidatePosts returns the newest visible posts created in [from, until] which the reader didn't write
+func (r *feedRankingRepository) getCandidatePosts(userID string, filter bson.D, from, until time.Time, limit int) ([]model.PostDetail, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", filter}},
+		bson.D{{"$match", bson.D{
+			{"userID", bson.D{{"$ne", userID}}},
+			{"createdDatetime", bson.D{{"$gte", from}, {"$lte", until}}},
+			{"status", bson.D{{"$ne", model.PostStatusPending}}},
+			{"mediaStatus", bson.D{{"$nin", bson.A{model.MediaStatusProcessing, model.MediaStatusFailed}}}},
+		}}},
+		bson.D{{"$sort", bson.D{{"createdDatetime", -1}, {"_id", -1}}}},
+		bson.D{{"$limit", limit}},
+	}
+	pipeline = append(pipeline, postDetailStages(userID)...)
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error finding candidate posts:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	posts := []model.PostDetail{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// GetAuthorAffinities counts the likes, comments and reposts the reader gave each author since then.
+// The time is taken from the ids so it works for likes, which have no createdDatetime.
+func (r *feedRankingRepository) GetAuthorAffinities(userID string, since time.Time) (map[string]int, error) {
+	affinities := make(map[string]int)
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", bson.D{
+			{"userID", userID},
+			{"_id", bson.D{{"$gte", primitive.NewObjectIDFromTimestamp(since)}}},
+		}}},
+		bson.D{{"$group", bson.D{
+			{"_id", "$postID"},
+			{"interactions", bson.D{{"$sum", 1}}},
+		}}},
+		bson.D{{"$lookup", bson.D{
+			{"from", "post"},
+			{"let", bson.D{{"postID", bson.D{{"$toObjectId", "$_id"}}}}},
+			{"pipeline", bson.A{
+				bson.D{{"$match", bson.D{{"$expr", bson.D{{"$eq", bson.A{"$_id", "$$postID"}}}}}}},
+				bson.D{{"$project", bson.D{{"userID", 1}}}},
+			}},
+			{"as", "post"},
+		}}},
+		bson.D{{"$unwind", "$post"}},
+		bson.D{{"$group", bson.D{
+			{"_id", "$post.userID"},
+			{"interactions", bson.D{{"$sum", "$interactions"}}},
+		}}},
+	}
+	for _, collectionName := range affinityCollections {
+		collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection(collectionName)
+		cursor, err := collection.Aggregate(context.Background(), pipeline, options.Aggregate().SetAllowDiskUse(true))
+		if err != nil {
+			fmt.Println("Error counting author affinities:", err)
+			return nil, err
+		}
+		var results []struct {
+			AuthorID     string `bson:"_id"`
+			Interactions int    `bson:"interactions"`
+		}
+		err = cursor.All(context.Background(), &results)
+		cursor.Close(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			if result.AuthorID != userID {
+				affinities[result.AuthorID] += result.Interactions
+			}
+		}
+	}
+	return affinities, nil
+}
+
+// SaveForYouRanking keeps one ranking per user and ranked time, saving it again replaces it
+func (r *feedRankingRepository) SaveForYouRanking(ranking *model.ForYouRanking) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("for_you_ranking")
+	_, err := collection.ReplaceOne(context.Background(),
+		bson.M{"userID": ranking.UserID, "rankedDatetime": ranking.RankedDatetime},
+		ranking,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		fmt.Println("Error saving for you ranking:", err)
+		return err
+	}
+	return nil
+}
+
+// GetForYouRanking returns nil when the ranking was never saved or has expired
+func (r *feedRankingRepository) GetForYouRanking(userID string, rankedDatetime time.Time) (*model.ForYouRanking, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("for_you_ranking")
+	var ranking model.ForYouRanking
+	err := collection.FindOne(context.Background(), bson.M{
+		"userID":          userID,
+		"rankedDatetime":  rankedDatetime,
+		"expiresDatetime": bson.M{"$gt": time.Now()},
+	}).Decode(&ranking)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		fmt.Println("Error finding for you ranking:", err)
+		return nil, err
+	}
+	return &ranking, nil
+}
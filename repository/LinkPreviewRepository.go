@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LinkPreviewRepository interface {
+	FindLinkPreview(canonicalUrl string) (*model.LinkPreview, error)
+	SaveLinkPreview(preview *model.LinkPreview) error
+}
+
+type linkPreviewRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewLinkPreviewRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) LinkPreviewRepository {
+	return &linkPreviewRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+// FindLinkPreview returns nil when the link was never cached or its entry has been dropped
+func (r *linkPreviewRepository) FindLinkPreview(canonicalUrl string) (*model.LinkPreview, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("link_preview")
+	var preview model.LinkPreview
+	err := collection.FindOne(context.Background(), bson.M{"_id": canonicalUrl}).Decode(&preview)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		fmt.Println("Error finding link preview:", err)
+		return nil, err
+	}
+	return &preview, nil
+}
+
+func (r *linkPreviewRepository) SaveLinkPreview(preview *model.LinkPreview) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("link_preview")
+	_, err := collection.ReplaceOne(context.Background(), bson.M{"_id": preview.ID}, preview, options.Replace().SetUpsert(true))
+	if err != nil {
+		fmt.Println("Error saving link preview:", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LockRepository keeps leases in the lock collection so only one replica runs a background job at a time
+type LockRepository interface {
+	AcquireLock(name string, owner string, ttl time.Duration) (bool, error)
+}
+
+type lockRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewLockRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) LockRepository {
+	return &lockRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+// AcquireLock takes or renews the lease when it is free, expired or already ours.
+// When another owner holds a live lease the upsert collides on _id and we report false.
+func (r *lockRepository) AcquireLock(name string, owner string, ttl time.Duration) (bool, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("lock")
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expiresDatetime": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresDatetime": now.Add(ttl)}}
+	_, err := collection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		fmt.Println("Error acquiring lock:", err)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrMediaObjectExists = errors.New("media object already exists")
+
+// MediaObjectRepository keeps content addressed media with reference counts in the media_object collection.
+// Counts only decide when an object is looked at by the garbage collector, which still checks that nothing
+// refers to it before deleting, so a missed release leaks a file instead of breaking a post.
+type MediaObjectRepository interface {
+	AcquireObject(hash string) (*model.MediaObject, error)
+	CreateObject(object *model.MediaObject) error
+	AcquireObjectsByKeys(keys []string, count int) error
+	ReleaseObjectsByKeys(keys []string) error
+	ReleaseObjectByUrl(url string) error
+	GetObjectsByKeys(keys []string) ([]model.MediaObject, error)
+	GetOrphanedObjects(updatedBefore time.Time, limit int) ([]model.MediaObject, error)
+	IsObjectReferenced(object *model.MediaObject) (bool, error)
+	DeleteOrphanedObject(hash string) (bool, error)
+}
+
+type mediaObjectRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewMediaObjectRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) MediaObjectRepository {
+	return &mediaObjectRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+// AcquireObject takes a reference on an existing object, it returns nil when the content was never stored
+func (r *mediaObjectRepository) AcquireObject(hash string) (*model.MediaObject, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media_object")
+	update := bson.M{"$inc": bson.M{"refCount": 1}, "$set": bson.M{"updatedDatetime": time.Now()}}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var object model.MediaObject
+	err := collection.FindOneAndUpdate(context.Background(), bson.M{"_id": hash}, update, findOptions).Decode(&object)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		fmt.Println("Error acquiring media object:", err)
+		return nil, err
+	}
+	return &object, nil
+}
+
+// CreateObject stores a new object holding one reference, ErrMediaObjectExists means someone stored it first
+func (r *mediaObjectRepository) CreateObject(object *model.MediaObject) error {
+	now := time.Now()
+	object.RefCount = 1
+	object.CreatedDatetime = &now
+	object.UpdatedDatetime = &now
+	object.Keys = object.Attachment.StorageKeys()
+	object.Urls = []string{}
+	if object.Attachment.Url != "" {
+		object.Urls = append(object.Urls, object.Attachment.Url)
+	}
+	for _, variant := range object.Attachment.Variants {
+		object.Urls = append(object.Urls, variant.Url)
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media_object")
+	_, err := collection.InsertOne(context.Background(), object)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrMediaObjectExists
+		}
+		fmt.Println("Error creating media object:", err)
+		return err
+	}
+	return nil
+}
+
+// AcquireObjectsByKeys adds count references to every object owning one of the keys
+func (r *mediaObjectRepository) AcquireObjectsByKeys(keys []string, count int) error {
+	if len(keys) == 0 || count == 0 {
+		return nil
+	}
+	return r.updateRefCount(bson.M{"keys": bson.M{"$in": keys}}, count)
+}
+
+func (r *mediaObjectRepository) ReleaseObjectsByKeys(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.updateRefCount(bson.M{"keys": bson.M{"$in": keys}}, -1)
+}
+
+// ReleaseObjectByUrl is for holders that only kept a url, like profile images and drafts
+func (r *mediaObjectRepository) ReleaseObjectByUrl(url string) error {
+	if url == "" {
+		return nil
+	}
+	return r.updateRefCount(bson.M{"urls": url}, -1)
+}
+
+func (r *mediaObjectRepository) updateRefCount(filter bson.M, count int) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media_object")
+	update := bson.M{"$inc": bson.M{"refCount": count}, "$set": bson.M{"updatedDatetime": time.Now()}}
+	_, err := collection.UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		fmt.Println("Error updating media object references:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *mediaObjectRepository) GetObjectsByKeys(keys []string) ([]model.MediaObject, error) {
+	if len(keys) == 0 {
+		return []model.MediaObject{}, nil
+	}
+	return r.findObjects(bson.M{"keys": bson.M{"$in": keys}}, options.Find())
+}
+
+func (r *mediaObjectRepository) GetOrphanedObjects(updatedBefore time.Time, limit int) ([]model.MediaObject, error) {
+	filter := bson.M{"refCount": bson.M{"$lte": 0}, "updatedDatetime": bson.M{"$lt": updatedBefore}}
+	return r.findObjects(filter, options.Find().SetLimit(int64(limit)))
+}
+
+func (r *mediaObjectRepository) findObjects(filter bson.M, findOptions *options.FindOptions) ([]model.MediaObject, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media_object")
+	cursor, err := collection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		fmt.Println("Error finding media objects:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	objects := []model.MediaObject{}
+	if err = cursor.All(context.Background(), &objects); err != nil {
+		fmt.Println("Error decoding media objects:", err)
+		return nil, err
+	}
+	return objects, nil
+}
+
+// IsObjectReferenced checks every place a stored file can be used: posts, profiles, drafts and uploads
+func (r *mediaObjectRepository) IsObjectReferenced(object *model.MediaObject) (bool, error) {
+	database := r.mongoClient.Database(r.envConfig.DatabaseName)
+	checks := []struct {
+		collection string
+		filter     bson.M
+	}{
+		{"post", bson.M{"$or": bson.A{
+			bson.M{"media.fileID": bson.M{"$in": object.Keys}},
+			bson.M{"imageUrl": bson.M{"$in": object.Urls}},
+		}}},
+		{"user", bson.M{"profileImage": bson.M{"$in": object.Urls}}},
+		{"draft", bson.M{"imageUrl": bson.M{"$in": object.Urls}}},
+		{"media", bson.M{"$or": bson.A{
+			bson.M{"fileID": bson.M{"$in": object.Keys}},
+			bson.M{"variants.key": bson.M{"$in": object.Keys}},
+		}}},
+	}
+	for _, check := range checks {
+		count, err := database.Collection(check.collection).CountDocuments(context.Background(), check.filter, options.Count().SetLimit(1))
+		if err != nil {
+			fmt.Println("Error checking media object references:", err)
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteOrphanedObject removes the object only if nobody acquired it in the meantime
+func (r *mediaObjectRepository) DeleteOrphanedObject(hash string) (bool, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media_object")
+	result, err := collection.DeleteOne(context.Background(), bson.M{"_id": hash, "refCount": bson.M{"$lte": 0}})
+	if err != nil {
+		fmt.Println("Error deleting media object:", err)
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
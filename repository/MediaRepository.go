@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MediaRepository interface {
+	CreateMedia(media *model.Media) (string, error)
+	GetUserMedia(userID string, mediaIDs []string) ([]model.Media, error)
+	FindMedia(mediaID string) (*model.Media, error)
+	ClaimProcessingMedia(now time.Time, lease time.Duration) (*model.Media, error)
+	CompleteMedia(media *model.Media) error
+	FailMedia(mediaID string, reason string) error
+	GetExpiredMedia(createdBefore time.Time, limit int) ([]model.Media, error)
+	DeleteMedia(mediaID string) error
+}
+
+type mediaRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewMediaRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) MediaRepository {
+	return &mediaRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+func (r *mediaRepository) CreateMedia(media *model.Media) (string, error) {
+	now := time.Now()
+	media.ID = primitive.NewObjectID()
+	media.CreatedDatetime = &now
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	_, err := collection.InsertOne(context.Background(), media)
+	if err != nil {
+		fmt.Println("Error creating media:", err)
+		return "", errors.New("failed to save media")
+	}
+	return media.ID.Hex(), nil
+}
+
+// GetUserMedia returns the media in the order of mediaIDs, all of them must belong to userID
+func (r *mediaRepository) GetUserMedia(userID string, mediaIDs []string) ([]model.Media, error) {
+	mediaHexes := []primitive.ObjectID{}
+	for _, mediaID := range mediaIDs {
+		mediaHex, err := primitive.ObjectIDFromHex(mediaID)
+		if err != nil {
+			return nil, errors.New("couldn't find media " + mediaID)
+		}
+		mediaHexes = append(mediaHexes, mediaHex)
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	cursor, err := collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": mediaHexes}, "userID": userID})
+	if err != nil {
+		fmt.Println("Error finding media:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	found := []model.Media{}
+	if err = cursor.All(context.Background(), &found); err != nil {
+		fmt.Println("Error decoding media:", err)
+		return nil, err
+	}
+	mediaByID := map[string]model.Media{}
+	for _, media := range found {
+		mediaByID[media.ID.Hex()] = media
+	}
+	result := []model.Media{}
+	for _, mediaID := range mediaIDs {
+		media, ok := mediaByID[mediaID]
+		if !ok {
+			return nil, errors.New("couldn't find media " + mediaID)
+		}
+		result = append(result, media)
+	}
+	return result, nil
+}
+
+func (r *mediaRepository) FindMedia(mediaID string) (*model.Media, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	mediaHex, err := primitive.ObjectIDFromHex(mediaID)
+	if err != nil {
+		return nil, errors.New("couldn't find media " + mediaID)
+	}
+	var media model.Media
+	err = collection.FindOne(context.Background(), bson.M{"_id": mediaHex}).Decode(&media)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("couldn't find media " + mediaID)
+		}
+		return nil, err
+	}
+	return &media, nil
+}
+
+// ClaimProcessingMedia leases one processing media to the caller so replicas never work on the same file.
+// A lease that runs out (crashed worker) makes the media claimable again. Returns nil when there is nothing to do.
+func (r *mediaRepository) ClaimProcessingMedia(now time.Time, lease time.Duration) (*model.Media, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	filter := bson.M{
+		"status": model.MediaStatusProcessing,
+		"$or": bson.A{
+			bson.M{"claimedUntil": bson.M{"$exists": false}},
+			bson.M{"claimedUntil": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"claimedUntil": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	findOptions := options.FindOneAndUpdate().SetSort(bson.D{{"createdDatetime", 1}}).SetReturnDocument(options.After)
+	var media model.Media
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, findOptions).Decode(&media)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		fmt.Println("Error claiming media:", err)
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (r *mediaRepository) CompleteMedia(media *model.Media) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	update := bson.M{
+		"$set": bson.M{
+			"url":       media.Url,
+			"fileID":    media.FileID,
+			"width":     media.Width,
+			"height":    media.Height,
+			"blurhash":  media.Blurhash,
+			"variants":  media.Variants,
+			"type":      media.Type,
+			"status":    model.MediaStatusReady,
+			"duration":  media.Duration,
+			"posterUrl": media.PosterUrl,
+		},
+		"$unset": bson.M{"claimedUntil": "", "originalKey": ""},
+	}
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": media.ID}, update)
+	if err != nil {
+		fmt.Println("Error completing media:", err)
+		return err
+	}
+	media.Status = model.MediaStatusReady
+	return nil
+}
+
+func (r *mediaRepository) FailMedia(mediaID string, reason string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	mediaHex, err := primitive.ObjectIDFromHex(mediaID)
+	if err != nil {
+		return errors.New("couldn't find media " + mediaID)
+	}
+	update := bson.M{
+		"$set":   bson.M{"status": model.MediaStatusFailed, "failureReason": reason},
+		"$unset": bson.M{"claimedUntil": ""},
+	}
+	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": mediaHex}, update)
+	if err != nil {
+		fmt.Println("Error failing media:", err)
+		return err
+	}
+	return nil
+}
+
+// GetExpiredMedia returns uploads old enough to stop holding their files, processing ones are left to the worker
+func (r *mediaRepository) GetExpiredMedia(createdBefore time.Time, limit int) ([]model.Media, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	filter := bson.M{"createdDatetime": bson.M{"$lt": createdBefore}, "status": bson.M{"$ne": model.MediaStatusProcessing}}
+	cursor, err := collection.Find(context.Background(), filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		fmt.Println("Error finding expired media:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	media := []model.Media{}
+	if err = cursor.All(context.Background(), &media); err != nil {
+		fmt.Println("Error decoding expired media:", err)
+		return nil, err
+	}
+	return media, nil
+}
+
+func (r *mediaRepository) DeleteMedia(mediaID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("media")
+	mediaHex, err := primitive.ObjectIDFromHex(mediaID)
+	if err != nil {
+		return errors.New("couldn't find media " + mediaID)
+	}
+	_, err = collection.DeleteOne(context.Background(), bson.M{"_id": mediaHex})
+	if err != nil {
+		fmt.Println("Error deleting media:", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const migrationBatchSize = 1000
+
+// returned when dropping an index that is already gone, or from a collection that was never created
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+)
+
+type migration struct {
+	name string
+	run  func(database *mongo.Database) error
+}
+
+// migrations run in order, each once per database. Replicas starting together can run the same one,
+// so every migration has to be safe to run again.
+var migrations = []migration{
+	{"timeline_source_sets", migrateTimelineSources},
+	{"unique_likes_and_follows", removeDuplicateLikesAndFollows},
+}
+
+// RunMigrations runs the migrations not recorded in the migration collection yet and records them
+func RunMigrations(envConfig *config.EnvConfig, client *mongo.Client) error {
+	database := client.Database(envConfig.DatabaseName)
+	collection := database.Collection("migration")
+	for _, m := range migrations {
+		err := collection.FindOne(context.Background(), bson.M{"_id": m.name}).Err()
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		fmt.Println("Running migration:", m.name)
+		if err := m.run(database); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		_, err = collection.UpdateOne(context.Background(),
+			bson.M{"_id": m.name},
+			bson.M{"$set": bson.M{"completedDatetime": time.Now()}},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTimelineSources moves timeline entries from a single sourceUserID to the sourceUserIDs set.
+// A source other than the post's author brought the post in with a repost, at the entry's feedDatetime.
+func migrateTimelineSources(database *mongo.Database) error {
+	timeline := database.Collection("timeline")
+	for {
+		opts := options.Find().
+			SetLimit(migrationBatchSize).
+			SetProjection(bson.M{"postID": 1, "sourceUserID": 1, "feedDatetime": 1})
+		cursor, err := timeline.Find(context.Background(), bson.M{"sourceUserID": bson.M{"$exists": true}}, opts)
+		if err != nil {
+			return err
+		}
+		var entries []struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			PostID       primitive.ObjectID `bson:"postID"`
+			SourceUserID string             `bson:"sourceUserID"`
+			FeedDatetime *time.Time         `bson:"feedDatetime"`
+		}
+		if err := cursor.All(context.Background(), &entries); err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		postIDs := []primitive.ObjectID{}
+		for _, entry := range entries {
+			postIDs = append(postIDs, entry.PostID)
+		}
+		cursor, err = database.Collection("post").Find(context.Background(),
+			bson.M{"_id": bson.M{"$in": postIDs}},
+			options.Find().SetProjection(bson.M{"userID": 1}))
+		if err != nil {
+			return err
+		}
+		var posts []struct {
+			ID     primitive.ObjectID `bson:"_id"`
+			UserID string             `bson:"userID"`
+		}
+		if err := cursor.All(context.Background(), &posts); err != nil {
+			return err
+		}
+		authorByPostID := map[primitive.ObjectID]string{}
+		for _, post := range posts {
+			authorByPostID[post.ID] = post.UserID
+		}
+
+		writes := []mongo.WriteModel{}
+		for _, entry := range entries {
+			update := bson.M{
+				"$addToSet": bson.M{"sourceUserIDs": entry.SourceUserID},
+				"$unset":    bson.M{"sourceUserID": ""},
+			}
+			author, ok := authorByPostID[entry.PostID]
+			if ok && author != entry.SourceUserID && entry.FeedDatetime != nil {
+				update["$max"] = bson.M{"reposts." + entry.SourceUserID: entry.FeedDatetime}
+			}
+			writes = append(writes, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": entry.ID}).SetUpdate(update))
+		}
+		if _, err := timeline.BulkWrite(context.Background(), writes); err != nil {
+			return err
+		}
+	}
+
+	// entries are looked up by the set now
+	_, err := timeline.Indexes().DropOne(context.Background(), "userID_1_sourceUserID_1")
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && (commandErr.Code == indexNotFoundCode || commandErr.Code == namespaceNotFoundCode) {
+		return nil
+	}
+	return err
+}
+
+// removeDuplicateLikesAndFollows clears the duplicates racing toggles left behind, so the unique indexes can be built
+func removeDuplicateLikesAndFollows(database *mongo.Database) error {
+	if err := removeDuplicates(database.Collection("like"), "userID", "postID"); err != nil {
+		return err
+	}
+	return removeDuplicates(database.Collection("follow"), "userID", "followUserID")
+}
+
+// removeDuplicates keeps the oldest document of every group sharing the same values for fields and deletes the rest
+func removeDuplicates(collection *mongo.Collection, fields ...string) error {
+	groupID := bson.D{}
+	for _, field := range fields {
+		groupID = append(groupID, bson.E{field, "$" + field})
+	}
+	pipeline := mongo.Pipeline{
+		bson.D{{"$sort", bson.D{{"_id", 1}}}},
+		bson.D{{"$group", bson.D{
+			{"_id", groupID},
+			{"ids", bson.D{{"$push", "$_id"}}},
+			{"count", bson.D{{"$sum", 1}}},
+		}}},
+		bson.D{{"$match", bson.D{{"count", bson.D{{"$gt", 1}}}}}},
+	}
+	cursor, err := collection.Aggregate(context.Background(), pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var group struct {
+			IDs []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		result, err := collection.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": group.IDs[1:]}})
+		if err != nil {
+			return err
+		}
+		fmt.Println("Removed duplicates from", collection.Name()+":", result.DeletedCount)
+	}
+	return cursor.Err()
+}
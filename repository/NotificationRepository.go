@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NotificationRepository interface {
+	CreateNotifications(notifications []model.Notification) error
+	GetNotifications(userID string, limit int, after *model.Cursor) ([]model.Notification, *model.Pagination, error)
+	MarkNotificationsRead(userID string) error
+}
+
+type notificationRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewNotificationRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) NotificationRepository {
+	return &notificationRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+func (r *notificationRepository) CreateNotifications(notifications []model.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	documents := []interface{}{}
+	for _, notification := range notifications {
+		documents = append(documents, notification)
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("notification")
+	_, err := collection.InsertMany(context.Background(), documents)
+	if err != nil {
+		fmt.Println("Error creating notifications:", err)
+		return err
+	}
+	return nil
+}
+
+// GetNotifications returns the newest notifications first, after is the last one of the previous page
+func (r *notificationRepository) GetNotifications(userID string, limit int, after *model.Cursor) ([]model.Notification, *model.Pagination, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("notification")
+	query := bson.M{"userID": userID}
+	total, err := collection.CountDocuments(context.Background(), query)
+	if err != nil {
+		fmt.Println("Error counting notifications:", err)
+		return nil, nil, err
+	}
+	if after != nil {
+		query = bson.M{"$and": bson.A{query, afterCursorFilter("createdDatetime", after, -1)}}
+	}
+	findOptions := options.Find().SetSort(bson.D{{"createdDatetime", -1}, {"_id", -1}}).SetLimit(int64(limit + 1))
+	cursor, err := collection.Find(context.Background(), query, findOptions)
+	if err != nil {
+		fmt.Println("Error finding notifications:", err)
+		return nil, nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	notifications := []model.Notification{}
+	if err = cursor.All(context.Background(), &notifications); err != nil {
+		return nil, nil, err
+	}
+	pagination := &model.Pagination{Total: int(total), Limit: limit}
+	if len(notifications) > limit {
+		pagination.HasMore = true
+		notifications = notifications[:limit]
+	}
+	return notifications, pagination, nil
+}
+
+func (r *notificationRepository) MarkNotificationsRead(userID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("notification")
+	_, err := collection.UpdateMany(context.Background(), bson.M{"userID": userID, "isRead": false}, bson.M{"$set": bson.M{"isRead": true}})
+	if err != nil {
+		fmt.Println("Error updating notifications:", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TimelineRepository interface {
+	AddTimelineEntries(entries []model.TimelineEntry) error
+	GetTimeline(userID string, sourceUserIDs []string, limit int, after *model.Cursor) ([]model.TimelineEntry, error)
+	RemoveTimelineSource(userID string, sourceUserID string) error
+	RemoveTimelineRepost(reposterID string, postID primitive.ObjectID) error
+	CountFollowers(userID string) (int64, error)
+	GetFollowerIDs(userID string, afterFollowID *primitive.ObjectID, limit int) ([]string, *primitive.ObjectID, error)
+	GetFollowingIDs(userID string) ([]string, error)
+	GetRecentPostEntries(authorIDs []string, limit int, after *model.Cursor) ([]model.TimelineEntry, error)
+	GetRecentRepostEntries(userIDs []string, limit int, after *model.Cursor) ([]model.TimelineEntry, error)
+	FindTimelineAccount(userID string) (*model.TimelineAccount, error)
+	GetFanoutOnReadUserIDs(userIDs []string) ([]string, error)
+	SetFanoutOnRead(userID string) error
+	MarkTimelineBuilt(userID string, builtDatetime time.Time) error
+	GetPendingFanoutPosts(createdBefore time.Time, limit int) ([]model.Post, error)
+	MarkPostFannedOut(postID primitive.ObjectID) error
+}
+
+type timelineRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewTimelineRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) TimelineRepository {
+	return &timelineRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+// AddTimelineEntries is idempotent. An entry already on the timeline gains the new sources
+// and reposts and keeps the later feedDatetime.
+func (r *timelineRepository) AddTimelineEntries(entries []model.TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("timeline")
+	writes := []mongo.WriteModel{}
+	for _, entry := range entries {
+		latest := bson.M{"feedDatetime": entry.FeedDatetime}
+		for reposterID, repostDatetime := range entry.Reposts {
+			latest["reposts."+reposterID] = repostDatetime
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"userID": entry.UserID, "postID": entry.PostID}).
+			SetUpdate(bson.M{
+				"$max":      latest,
+				"$addToSet": bson.M{"sourceUserIDs": bson.M{"$each": entry.SourceUserIDs}},
+			}).
+			SetUpsert(true))
+	}
+	_, err := collection.BulkWrite(context.Background(), writes, options.BulkWrite().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		fmt.Println("Error adding timeline entries:", err)
+		return err
+	}
+	return nil
+}
+
+// GetTimeline returns the entries after the cursor brought in by one of the sources, newest first
+func (r *timelineRepository) GetTimeline(userID string, sourceUserIDs []string, limit int, after *model.Cursor) ([]model.TimelineEntry, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("timeline")
+	filter := bson.M{"userID": userID, "sourceUserIDs": bson.M{"$in": sourceUserIDs}}
+	if after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"feedDatetime": bson.M{"$lt": after.Datetime}},
+			bson.M{"feedDatetime": after.Datetime, "postID": bson.M{"$lt": after.ID}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{"feedDatetime", -1}, {"postID", -1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		fmt.Println("Error finding timeline:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	entries := []model.TimelineEntry{}
+	if err = cursor.All(context.Background(), &entries); err != nil {
+		fmt.Println("Error decoding timeline:", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RemoveTimelineSource takes the user out of the sources of every entry, only entries nobody else brought in are deleted
+func (r *timelineRepository) RemoveTimelineSource(userID string, sourceUserID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("timeline")
+	_, err := collection.UpdateMany(context.Background(),
+		bson.M{"userID": userID, "sourceUserIDs": sourceUserID},
+		bson.M{"$pull": bson.M{"sourceUserIDs": sourceUserID}, "$unset": bson.M{"reposts." + sourceUserID: ""}})
+	if err != nil {
+		fmt.Println("Error pruning timeline:", err)
+		return err
+	}
+	_, err = collection.DeleteMany(context.Background(), bson.M{"userID": userID, "sourceUserIDs": bson.M{"$size": 0}})
+	if err != nil {
+		fmt.Println("Error pruning timeline:", err)
+		return err
+	}
+	return nil
+}
+
+// RemoveTimelineRepost takes an undone repost off every timeline holding it. The reposter stays a source
+// when they wrote the post, feedDatetime falls back to the latest repost left or to when the post was published.
+// Entries nobody else brought in are deleted.
+func (r *timelineRepository) RemoveTimelineRepost(reposterID string, postID primitive.ObjectID) error {
+	database := r.mongoClient.Database(r.envConfig.DatabaseName)
+	var post model.Post
+	err := database.Collection("post").FindOne(context.Background(), bson.M{"_id": postID},
+		options.FindOne().SetProjection(bson.M{"userID": 1, "createdDatetime": 1})).Decode(&post)
+	if err != nil && err != mongo.ErrNoDocuments {
+		fmt.Println("Error finding reposted post:", err)
+		return err
+	}
+	sourceUserIDs := interface{}(bson.M{"$setDifference": bson.A{"$sourceUserIDs", bson.A{reposterID}}})
+	if post.UserID == reposterID {
+		sourceUserIDs = "$sourceUserIDs"
+	}
+	latestRepost := bson.M{"$max": bson.M{"$map": bson.M{
+		"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$reposts", bson.M{}}}},
+		"in":    "$$this.v",
+	}}}
+	update := mongo.Pipeline{
+		bson.D{{"$unset", "reposts." + reposterID}},
+		bson.D{{"$set", bson.M{
+			"sourceUserIDs": sourceUserIDs,
+			"feedDatetime":  bson.M{"$max": bson.A{post.CreatedDatetime, latestRepost}},
+		}}},
+	}
+	collection := database.Collection("timeline")
+	_, err = collection.UpdateMany(context.Background(), bson.M{"postID": postID, "reposts." + reposterID: bson.M{"$exists": true}}, update)
+	if err != nil {
+		fmt.Println("Error removing repost from timelines:", err)
+		return err
+	}
+	_, err = collection.DeleteMany(context.Background(), bson.M{"postID": postID, "sourceUserIDs": bson.M{"$size": 0}})
+	if err != nil {
+		fmt.Println("Error removing repost from timelines:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *timelineRepository) CountFollowers(userID string) (int64, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("follow")
+	count, err := collection.CountDocuments(context.Background(), bson.M{"followUserID": userID})
+	if err != nil {
+		fmt.Println("Error counting followers:", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetFollowerIDs pages through followers by follow id, the returned id continues the next page and is nil on the last one
+func (r *timelineRepository) GetFollowerIDs(userID string, afterFollowID *primitive.ObjectID, limit int) ([]string, *primitive.ObjectID, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("follow")
+	filter := bson.M{"followUserID": userID}
+	if afterFollowID != nil {
+		filter["_id"] = bson.M{"$gt": *afterFollowID}
+	}
+	opts := options.Find().SetSort(bson.D{{"_id", 1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		fmt.Println("Error finding followers:", err)
+		return nil, nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	follows := []model.Follow{}
+	if err = cursor.All(context.Background(), &follows); err != nil {
+		fmt.Println("Error decoding followers:", err)
+		return nil, nil, err
+	}
+	followerIDs := []string{}
+	for _, follow := range follows {
+		followerIDs = append(followerIDs, follow.UserID)
+	}
+	if len(follows) < limit {
+		return followerIDs, nil, nil
+	}
+	return followerIDs, &follows[len(follows)-1].ID, nil
+}
+
+func (r *timelineRepository) GetFollowingIDs(userID string) ([]string, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("follow")
+	cursor, err := collection.Find(context.Background(), bson.M{"userID": userID})
+	if err != nil {
+		fmt.Println("Error finding following users:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	follows := []model.Follow{}
+	if err = cursor.All(context.Background(), &follows); err != nil {
+		fmt.Println("Error decoding following users:", err)
+		return nil, err
+	}
+	followingIDs := []string{}
+	for _, follow := range follows {
+		followingIDs = append(followingIDs, follow.FollowUserID)
+	}
+	return followingIDs, nil
+}
+
+// GetRecentPostEntries reads the latest visible posts of the authors as timeline entries, newest first
+func (r *timelineRepository) GetRecentPostEntries(authorIDs []string, limit int, after *model.Cursor) ([]model.TimelineEntry, error) {
+	if len(authorIDs) == 0 {
+		return []model.TimelineEntry{}, nil
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	filter := bson.D{
+		{"userID", bson.M{"$in": authorIDs}},
+		{"status", bson.M{"$ne": model.PostStatusPending}},
+		{"mediaStatus", bson.M{"$nin": bson.A{model.MediaStatusProcessing, model.MediaStatusFailed}}},
+	}
+	if after != nil {
+		filter = append(filter, bson.E{"$or", bson.A{
+			bson.M{"createdDatetime": bson.M{"$lt": after.Datetime}},
+			bson.M{"createdDatetime": after.Datetime, "_id": bson.M{"$lt": after.ID}},
+		}})
+	}
+	opts := options.Find().
+		SetSort(bson.D{{"createdDatetime", -1}, {"_id", -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"userID": 1, "createdDatetime": 1})
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		fmt.Println("Error finding recent posts:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	posts := []model.Post{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		fmt.Println("Error decoding recent posts:", err)
+		return nil, err
+	}
+	entries := []model.TimelineEntry{}
+	for _, post := range posts {
+		entries = append(entries, model.TimelineEntry{
+			PostID:        post.ID,
+			SourceUserIDs: []string{post.UserID},
+			FeedDatetime:  post.CreatedDatetime,
+		})
+	}
+	return entries, nil
+}
+
+// GetRecentRepostEntries reads the latest reposts made by the users as timeline entries, newest first.
+// The cursor compares post ids, which reposts keep as hex strings.
+func (r *timelineRepository) GetRecentRepostEntries(userIDs []string, limit int, after *model.Cursor) ([]model.TimelineEntry, error) {
+	if len(userIDs) == 0 {
+		return []model.TimelineEntry{}, nil
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("repost")
+	filter := bson.M{"userID": bson.M{"$in": userIDs}}
+	if after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"createdDatetime": bson.M{"$lt": after.Datetime}},
+			bson.M{"createdDatetime": after.Datetime, "postID": bson.M{"$lt": after.ID.Hex()}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{"createdDatetime", -1}, {"postID", -1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		fmt.Println("Error finding recent reposts:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	reposts := []model.Repost{}
+	if err = cursor.All(context.Background(), &reposts); err != nil {
+		fmt.Println("Error decoding recent reposts:", err)
+		return nil, err
+	}
+	entries := []model.TimelineEntry{}
+	for _, repost := range reposts {
+		postID, err := primitive.ObjectIDFromHex(repost.PostID)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, model.TimelineEntry{
+			PostID:        postID,
+			SourceUserIDs: []string{repost.UserID},
+			Reposts:       map[string]time.Time{repost.UserID: *repost.CreatedDatetime},
+			FeedDatetime:  repost.CreatedDatetime,
+		})
+	}
+	return entries, nil
+}
+
+// FindTimelineAccount returns an empty account for users whose timeline was never touched
+func (r *timelineRepository) FindTimelineAccount(userID string) (*model.TimelineAccount, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("timeline_account")
+	var account model.TimelineAccount
+	err := collection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&account)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &model.TimelineAccount{ID: userID}, nil
+		}
+		fmt.Println("Error finding timeline account:", err)
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *timelineRepository) GetFanoutOnReadUserIDs(userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return []string{}, nil
+	}
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("timeline_account")
+	cursor, err := collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": userIDs}, "fanoutOnRead": true})
+	if err != nil {
+		fmt.Println("Error finding fan-out-on-read users:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	accounts := []model.TimelineAccount{}
+	if err = cursor.All(context.Background(), &accounts); err != nil {
+		fmt.Println("Error decoding fan-out-on-read users:", err)
+		return nil, err
+	}
+	fanoutOnReadIDs := []string{}
+	for _, account := range accounts {
+		fanoutOnReadIDs = append(fanoutOnReadIDs, account.ID)
+	}
+	return fanoutOnReadIDs, nil
+}
+
+func (r *timelineRepository) SetFanoutOnRead(userID string) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("timeline_account")
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": userID}, bson.M{"$set": bson.M{"fanoutOnRead": true}}, options.Update().SetUpsert(true))
+	if err != nil {
+		fmt.Println("Error setting fan-out-on-read:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *timelineRepository) MarkTimelineBuilt(userID string, builtDatetime time.Time) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("timeline_account")
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": userID}, bson.M{"$set": bson.M{"builtDatetime": &builtDatetime}}, options.Update().SetUpsert(true))
+	if err != nil {
+		fmt.Println("Error marking timeline built:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *timelineRepository) GetPendingFanoutPosts(createdBefore time.Time, limit int) ([]model.Post, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	filter := bson.M{"fanoutStatus": model.FanoutStatusPending, "createdDatetime": bson.M{"$lt": createdBefore}}
+	cursor, err := collection.Find(context.Background(), filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		fmt.Println("Error finding pending fan-out posts:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	posts := []model.Post{}
+	if err = cursor.All(context.Background(), &posts); err != nil {
+		fmt.Println("Error decoding pending fan-out posts:", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *timelineRepository) MarkPostFannedOut(postID primitive.ObjectID) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": postID}, bson.M{"$unset": bson.M{"fanoutStatus": ""}})
+	if err != nil {
+		fmt.Println("Error marking post fanned out:", err)
+		return err
+	}
+	return nil
+}
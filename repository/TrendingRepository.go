@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const currentTrendingID = "current"
+
+type TrendingRepository interface {
+	CountHashtagUsage(recentFrom, baselineFrom time.Time) ([]model.TermUsage, error)
+	CountDomainUsage(recentFrom, baselineFrom time.Time) ([]model.TermUsage, error)
+	SaveTrending(trending *model.Trending) error
+	GetTrending() (*model.Trending, error)
+}
+
+type trendingRepository struct {
+	envConfig   *config.EnvConfig
+	mongoClient *mongo.Client
+}
+
+func NewTrendingRepository(envConfig *config.EnvConfig, mongoClient *mongo.Client) TrendingRepository {
+	return &trendingRepository{
+		envConfig:   envConfig,
+		mongoClient: mongoClient,
+	}
+}
+
+func (r *trendingRepository) CountHashtagUsage(recentFrom, baselineFrom time.Time) ([]model.TermUsage, error) {
+	return r.countTermUsage("hashtags", "$hashtags", recentFrom, baselineFrom)
+}
+
+func (r *trendingRepository) CountDomainUsage(recentFrom, baselineFrom time.Time) ([]model.TermUsage, error) {
+	return r.countTermUsage("ogDomain", bson.D{{"$toLower", "$ogDomain"}}, recentFrom, baselineFrom)
+}
+
+// countTermUsage counts distinct users per term so a single account posting many times only counts once
+func (r *trendingRepository) countTermUsage(field string, term any, recentFrom, baselineFrom time.Time) ([]model.TermUsage, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("post")
+	pipeline := mongo.Pipeline{
+		bson.D{
+			{"$match",
+				bson.D{
+					{"createdDatetime", bson.D{{"$gte", baselineFrom}}},
+					{"status", bson.D{{"$ne", model.PostStatusPending}}},
+					{"mediaStatus", bson.D{{"$nin", bson.A{model.MediaStatusProcessing, model.MediaStatusFailed}}}},
+					{field, bson.D{{"$nin", bson.A{nil, ""}}}},
+				},
+			},
+		},
+		bson.D{{"$unwind", "$" + field}},
+		bson.D{
+			{"$group",
+				bson.D{
+					{"_id", bson.D{{"term", term}, {"userID", "$userID"}}},
+					{"recent", bson.D{{"$max", bson.D{{"$cond", bson.A{bson.D{{"$gte", bson.A{"$createdDatetime", recentFrom}}}, 1, 0}}}}}},
+					{"baseline", bson.D{{"$max", bson.D{{"$cond", bson.A{bson.D{{"$lt", bson.A{"$createdDatetime", recentFrom}}}, 1, 0}}}}}},
+				},
+			},
+		},
+		bson.D{
+			{"$group",
+				bson.D{
+					{"_id", "$_id.term"},
+					{"recentUsers", bson.D{{"$sum", "$recent"}}},
+					{"baselineUsers", bson.D{{"$sum", "$baseline"}}},
+				},
+			},
+		},
+		bson.D{{"$match", bson.D{{"recentUsers", bson.D{{"$gt", 0}}}}}},
+		bson.D{
+			{"$project",
+				bson.D{
+					{"name", "$_id"},
+					{"recentUsers", "$recentUsers"},
+					{"baselineUsers", "$baselineUsers"},
+				},
+			},
+		},
+	}
+
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		fmt.Println("Error creating cursor:", err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var results []model.TermUsage
+	if err = cursor.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *trendingRepository) SaveTrending(trending *model.Trending) error {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("trending")
+	trending.ID = currentTrendingID
+	_, err := collection.ReplaceOne(context.Background(), bson.M{"_id": currentTrendingID}, trending, options.Replace().SetUpsert(true))
+	if err != nil {
+		fmt.Println("Error saving trending:", err)
+		return err
+	}
+	return nil
+}
+
+func (r *trendingRepository) GetTrending() (*model.Trending, error) {
+	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("trending")
+	var trending model.Trending
+	err := collection.FindOne(context.Background(), bson.M{"_id": currentTrendingID}).Decode(&trending)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &model.Trending{Hashtags: []model.TrendingItem{}, Domains: []model.TrendingItem{}}, nil
+		}
+		return nil, err
+	}
+	return &trending, nil
+}
@@ -22,8 +22,8 @@ type UserRepository interface {
 	FindUserViewByOthers(currentUserID, targetUsername string) (*model.UserViewByOthers, error)
 	GetUsersByIDList(userIDs []string) ([]model.User, error)
 	UpdateProfile(userID string, updatedUser *model.User) error
-	FollowUser(userID string, followUserID string) (string, error)
-	UnfollowUser(userID string, followUserID string) error
+	FollowUser(userID string, followUserID string) (bool, error)
+	UnfollowUser(userID string, followUserID string) (bool, error)
 	IsUserFollowed(userID string, followUserID string) (bool, error)
 }
 
@@ -261,7 +261,8 @@ func (r *userRepository) UpdateProfile(userID string, updatedUser *model.User) e
 	return nil
 }
 
-func (r *userRepository) FollowUser(userID string, followUserID string) (string, error) {
+// FollowUser is idempotent, false means the user was already followed and nothing changed
+func (r *userRepository) FollowUser(userID string, followUserID string) (bool, error) {
 	now := time.Now()
 	follow := model.Follow{
 		ID:              primitive.NewObjectID(),
@@ -270,31 +271,28 @@ func (r *userRepository) FollowUser(userID string, followUserID string) (string,
 		CreatedDatetime: &now,
 	}
 	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("follow")
-	result, err := collection.InsertOne(context.Background(), follow)
-	if err != nil {
-		return "", err
+	_, err := collection.InsertOne(context.Background(), follow)
+	// the unique index on (userID, followUserID) rejects a second follow
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
 	}
-	oid, ok := result.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return "", errors.New("there are some errors when following a user")
+	if err != nil {
+		fmt.Println("Error following user:", err)
+		return false, err
 	}
-
-	return oid.Hex(), nil
+	return true, nil
 }
 
-func (r *userRepository) UnfollowUser(userID string, followUserID string) error {
+// UnfollowUser is idempotent, false means the user wasn't followed and nothing changed
+func (r *userRepository) UnfollowUser(userID string, followUserID string) (bool, error) {
 	collection := r.mongoClient.Database(r.envConfig.DatabaseName).Collection("follow")
 	filter := bson.M{"userID": userID, "followUserID": followUserID}
 	result, err := collection.DeleteOne(context.Background(), filter)
 	if err != nil {
 		fmt.Println("Error deleting document:", err)
-		return err
-	}
-	if result.DeletedCount == 1 {
-		fmt.Println("Successfully deleted one document")
-		return nil
+		return false, err
 	}
-	return errors.New("no documents were deleted")
+	return result.DeletedCount == 1, nil
 }
 
 func (r *userRepository) IsUserFollowed(userID string, followUserID string) (bool, error) {
@@ -1,93 +1,468 @@
 package service
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"math"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/tipbk/sneakfeed-service/config"
 	"github.com/tipbk/sneakfeed-service/dto"
 	"github.com/tipbk/sneakfeed-service/model"
 	"github.com/tipbk/sneakfeed-service/repository"
+	"github.com/tipbk/sneakfeed-service/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+const heartReaction = "heart"
+
+const maxMentionsPerContent = 10
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 50
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// a following page skipping posts that are gone or hidden reads at most this many timeline batches to fill up
+const maxTimelineFetches = 5
+
+const (
+	MaxMediaPerPost  = 4
+	maxAltTextLength = 1000
+)
+
+// cursors are signed per list so one handed out for a feed can't be replayed against comments
+const (
+	postsCursorScope    = "posts"
+	forYouCursorScope   = "for_you"
+	commentsCursorScope = "comments"
+)
+
+var ErrPollAlreadyVoted = errors.New("you have already voted on this poll")
+
+var ErrEmptyContent = errors.New("content cannot be empty")
+
+// ErrInvalidPost wraps the reasons a post was refused, they are the client's to fix
+var ErrInvalidPost = errors.New("invalid post")
+
 type ContentService interface {
-	CreatePost(userID string, content string, imageUrl *string, ogTitle *string, ogDescription *string, ogLink *string, ogImage *string, ogDomain *string) (string, error)
+	CreatePost(userID string, content string, imageUrl *string, quotePostID *string, poll *model.Poll, publishAt *time.Time, mediaRequests []dto.CreateMediaRequest) (string, error)
 	AddComment(userID string, postID string, content string) (string, error)
-	GetPosts(userID string, limit int, timeFrom *time.Time, postFilter, username string) (*model.PostDetailPagination, error)
+	GetPosts(userID string, limit int, cursor string, postFilter, username string) (*model.PostDetailPagination, error)
+	GetPostsByHashtag(userID string, limit int, cursor string, hashtag string) (*model.PostDetailPagination, error)
 	GetPostByID(userID, postID string) (*model.PostDetail, error)
-	GetCommentFromPostID(postID string) ([]model.Comment, error)
+	GetCommentFromPostID(postID string, limit int, cursor string) ([]model.Comment, *model.Pagination, error)
 	FindPost(postID string) (*model.Post, error)
+	LikePost(userID string, postID string) error
+	UnlikePost(userID string, postID string) error
 	ToggleLikeOnPost(userID string, postID string) (bool, error)
 	CountLikeAndCommentOnPost(postID string) (int64, int64, error)
 	GetMetadata(targetUrl string) (*dto.MetadataExternal, error)
+	FindComment(commentID string) (*model.Comment, error)
+	UpdateComment(commentID string, content string) error
+	DeleteComment(commentID string) error
+	ToggleLikeOnComment(userID string, postID string, commentID string) (bool, error)
+	GetCommentLikeSummaries(userID string, commentIDs []string) (map[string]model.CommentLikeSummary, error)
+	ToggleRepostOnPost(userID string, postID string) (bool, error)
+	VotePoll(userID string, postID string, optionIndex int) (*model.PollResult, error)
+	GetScheduledPosts(userID string) ([]model.Post, error)
+	ReschedulePost(userID string, postID string, publishAt time.Time) error
+	CancelScheduledPost(userID string, postID string) error
+	GetReactionEmojis() []string
+	ToggleReactionOnPost(userID string, postID string, emoji string) (bool, error)
 }
 
 type contentService struct {
-	envConfig         *config.EnvConfig
-	contentRepository repository.ContentRepository
+	envConfig            *config.EnvConfig
+	contentRepository    repository.ContentRepository
+	userService          UserService
+	notificationService  NotificationService
+	linkPreviewService   LinkPreviewService
+	postPreviewService   PostPreviewService
+	timelineService      TimelineService
+	feedRankingService   FeedRankingService
+	mediaService         MediaService
+	imageUploaderService ImageUploaderService
 }
 
-func NewContentService(envConfig *config.EnvConfig, contentRepository repository.ContentRepository) ContentService {
+func NewContentService(envConfig *config.EnvConfig, contentRepository repository.ContentRepository, userService UserService, notificationService NotificationService, linkPreviewService LinkPreviewService, postPreviewService PostPreviewService, timelineService TimelineService, feedRankingService FeedRankingService, mediaService MediaService, imageUploaderService ImageUploaderService) ContentService {
 	return &contentService{
-		envConfig:         envConfig,
-		contentRepository: contentRepository,
+		envConfig:            envConfig,
+		contentRepository:    contentRepository,
+		userService:          userService,
+		notificationService:  notificationService,
+		linkPreviewService:   linkPreviewService,
+		postPreviewService:   postPreviewService,
+		timelineService:      timelineService,
+		feedRankingService:   feedRankingService,
+		mediaService:         mediaService,
+		imageUploaderService: imageUploaderService,
 	}
 }
 
-func (s *contentService) CreatePost(userID string, content string, imageUrl *string, ogTitle *string, ogDescription *string, ogLink *string, ogImage *string, ogDomain *string) (string, error) {
-	postID, err := s.contentRepository.CreatePost(userID, content, imageUrl, ogTitle, ogDescription, ogLink, ogImage, ogDomain)
+// CreatePost is the one place a post is validated, POST /posts and publishing a draft both rely on it.
+// It checks the whole post before any inline image is uploaded, so a rejected post leaves no files behind.
+// The post takes over the reference of its inline uploads and takes one more on media referenced by id.
+func (s *contentService) CreatePost(userID string, content string, imageUrl *string, quotePostID *string, poll *model.Poll, publishAt *time.Time, mediaRequests []dto.CreateMediaRequest) (string, error) {
+	if content == "" {
+		return "", ErrEmptyContent
+	}
+	if quotePostID != nil {
+		quotedPost, err := s.contentRepository.FindPost(*quotePostID)
+		if err != nil || quotedPost.IsHidden() {
+			return "", fmt.Errorf("%w: couldn't find quoted post", ErrInvalidPost)
+		}
+	}
+	status := model.PostStatusPublished
+	startTime := time.Now()
+	if publishAt != nil && publishAt.After(startTime) {
+		if publishAt.After(startTime.Add(maxScheduleAhead)) {
+			return "", fmt.Errorf("%w: post cannot be scheduled more than 1 year ahead", ErrInvalidPost)
+		}
+		status = model.PostStatusPending
+		startTime = *publishAt
+	} else {
+		publishAt = nil
+	}
+	if poll != nil {
+		err := validatePoll(poll, startTime)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidPost, err)
+		}
+	}
+	if len(mediaRequests) > MaxMediaPerPost {
+		return "", fmt.Errorf("%w: a post can have at most %d images", ErrInvalidPost, MaxMediaPerPost)
+	}
+	uploads := []MediaUpload{}
+	mediaIDs := []string{}
+	for _, mediaRequest := range mediaRequests {
+		if mediaRequest.ImageBase64 == "" && mediaRequest.MediaID == "" {
+			return "", fmt.Errorf("%w: media needs either mediaID or imageBase64", ErrInvalidPost)
+		}
+		if utf8.RuneCountInString(mediaRequest.AltText) > maxAltTextLength {
+			return "", fmt.Errorf("%w: alt text cannot be longer than %d characters", ErrInvalidPost, maxAltTextLength)
+		}
+		if mediaRequest.MediaID != "" {
+			mediaIDs = append(mediaIDs, mediaRequest.MediaID)
+		} else {
+			uploads = append(uploads, MediaUpload{ImageBase64: mediaRequest.ImageBase64, AltText: mediaRequest.AltText})
+		}
+	}
+	referencedMedia, err := s.mediaService.GetUserMedia(userID, mediaIDs)
+	if err != nil {
+		return "", err
+	}
+	mediaStatus := ""
+	for _, referenced := range referencedMedia {
+		if referenced.Status == model.MediaStatusFailed {
+			return "", fmt.Errorf("%w: media failed processing", ErrInvalidPost)
+		}
+		if referenced.Status == model.MediaStatusProcessing {
+			mediaStatus = model.MediaStatusProcessing
+		}
+	}
+
+	uploadedMedia := []model.MediaAttachment{}
+	if len(uploads) > 0 {
+		uploadedMedia, err = s.imageUploaderService.UploadMedia(uploads)
+		if err != nil {
+			return "", err
+		}
+	}
+	// put uploaded and referenced media back into the order they were sent
+	var media []model.MediaAttachment
+	uploadIndex, referenceIndex := 0, 0
+	for _, mediaRequest := range mediaRequests {
+		if mediaRequest.MediaID != "" {
+			media = append(media, referencedMedia[referenceIndex].Attachment(mediaRequest.AltText))
+			referenceIndex++
+		} else {
+			media = append(media, uploadedMedia[uploadIndex])
+			uploadIndex++
+		}
+	}
+	if imageUrl == nil && len(media) > 0 && media[0].Type == model.MediaTypeImage {
+		imageUrl = &media[0].Url
+	}
+	mentions := s.resolveMentions(content)
+	previewUrl := util.ExtractFirstUrl(content)
+	previewStatus := ""
+	if previewUrl != "" {
+		previewStatus = model.PreviewStatusPending
+	}
+	// scheduled posts are fanned out to timelines when the scheduler publishes them
+	fanoutStatus := ""
+	if status == model.PostStatusPublished {
+		fanoutStatus = model.FanoutStatusPending
+	}
+	post := &model.Post{
+		UserID:        userID,
+		Content:       content,
+		ImageUrl:      imageUrl,
+		QuotePostID:   quotePostID,
+		Hashtags:      util.ExtractHashtags(content),
+		Mentions:      mentions,
+		Poll:          poll,
+		Status:        status,
+		PublishAt:     publishAt,
+		Media:         media,
+		MediaStatus:   mediaStatus,
+		PreviewUrl:    previewUrl,
+		PreviewStatus: previewStatus,
+		FanoutStatus:  fanoutStatus,
+	}
+	postID, err := s.contentRepository.CreatePost(post)
 	if err != nil {
+		for _, attachment := range uploadedMedia {
+			s.imageUploaderService.DeleteMedia(attachment)
+		}
 		return "", err
 	}
+	for _, referenced := range referencedMedia {
+		if err := s.imageUploaderService.AcquireMedia(referenced.Attachment(""), 1); err != nil {
+			fmt.Println("Error acquiring post media:", err)
+		}
+	}
+	if previewUrl != "" {
+		s.postPreviewService.Enqueue(postID, previewUrl)
+	}
+	if fanoutStatus != "" {
+		s.timelineService.EnqueuePost(postID, userID, *post.CreatedDatetime)
+	}
+	// scheduled posts notify when the scheduler publishes them, posts with processing media once they are ready
+	if status == model.PostStatusPublished && mediaStatus == "" {
+		s.notifyMentions(userID, postID, "", mentions)
+	}
 	return postID, nil
 }
 
 func (s *contentService) AddComment(userID string, postID string, content string) (string, error) {
 	post, err := s.contentRepository.FindPost(postID)
-	if err != nil {
+	if err != nil || post.IsHidden() {
 		return "", errors.New("couldn't find post")
 	}
-	commentID, err := s.contentRepository.AddComment(userID, post.ID.Hex(), content)
+	mentions := s.resolveMentions(content)
+	commentID, err := s.contentRepository.AddComment(userID, post.ID.Hex(), content, mentions)
 	if err != nil {
 		return "", err
 	}
+	s.notifyMentions(userID, post.ID.Hex(), commentID, mentions)
 	return commentID, nil
 }
 
-func (s *contentService) GetCommentFromPostID(postID string) ([]model.Comment, error) {
-	comments, err := s.contentRepository.GetCommentFromPostID(postID)
+// resolveMentions keeps the @username handles which belong to a real user
+func (s *contentService) resolveMentions(content string) []model.MentionEntity {
+	mentions := []model.MentionEntity{}
+	userMap := make(map[string]*model.User)
+	for _, mention := range util.ExtractMentionEntities(content) {
+		user, ok := userMap[mention.Username]
+		if !ok {
+			if len(userMap) >= maxMentionsPerContent {
+				continue
+			}
+			foundUser, err := s.userService.FindUserWithUsername(mention.Username)
+			if err != nil {
+				foundUser = nil
+			}
+			user = foundUser
+			userMap[mention.Username] = user
+		}
+		if user == nil {
+			continue
+		}
+		mention.UserID = user.ID.Hex()
+		mentions = append(mentions, mention)
+	}
+	return mentions
+}
+
+// mention notifications are best effort and never fail the write they belong to
+func (s *contentService) notifyMentions(actorUserID string, postID string, commentID string, mentions []model.MentionEntity) {
+	userIDs := []string{}
+	seen := make(map[string]bool)
+	for _, mention := range mentions {
+		if seen[mention.UserID] {
+			continue
+		}
+		seen[mention.UserID] = true
+		userIDs = append(userIDs, mention.UserID)
+	}
+	err := s.notificationService.NotifyMentions(actorUserID, postID, commentID, userIDs)
+	if err != nil {
+		fmt.Println("Error notifying mentions:", err)
+	}
+}
+
+func (s *contentService) GetCommentFromPostID(postID string, limit int, cursor string) ([]model.Comment, *model.Pagination, error) {
+	after, err := s.decodeCursor(commentsCursorScope, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	comments, pagination, err := s.contentRepository.GetCommentFromPostID(postID, limit, after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pagination.HasMore {
+		last := comments[len(comments)-1]
+		pagination.NextCursor = util.EncodeCursor(s.envConfig.CursorSecret, commentsCursorScope, model.Cursor{Datetime: *last.CreatedDatetime, ID: last.ID})
+	}
+	return comments, pagination, nil
+}
+
+func (s *contentService) FindComment(commentID string) (*model.Comment, error) {
+	comment, err := s.contentRepository.FindComment(commentID)
 	if err != nil {
 		return nil, err
 	}
-	return comments, nil
+	return comment, nil
+}
+
+func (s *contentService) UpdateComment(commentID string, content string) error {
+	comment, err := s.contentRepository.FindComment(commentID)
+	if err != nil {
+		return err
+	}
+	mentions := s.resolveMentions(content)
+	err = s.contentRepository.UpdateComment(commentID, content, mentions)
+	if err != nil {
+		return err
+	}
+
+	// only users who weren't mentioned before the edit get a new notification
+	previouslyMentioned := make(map[string]bool)
+	for _, userID := range comment.MentionedUserIDs {
+		previouslyMentioned[userID] = true
+	}
+	newMentions := []model.MentionEntity{}
+	for _, mention := range mentions {
+		if !previouslyMentioned[mention.UserID] {
+			newMentions = append(newMentions, mention)
+		}
+	}
+	s.notifyMentions(comment.UserID, comment.PostID, commentID, newMentions)
+	return nil
 }
 
+func (s *contentService) DeleteComment(commentID string) error {
+	err := s.contentRepository.DeleteComment(commentID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FindPost only finds visible posts, scheduled or still processing posts can't be interacted with
 func (s *contentService) FindPost(postID string) (*model.Post, error) {
 	post, err := s.contentRepository.FindPost(postID)
 	if err != nil {
 		return nil, err
 	}
+	if post.IsHidden() {
+		return nil, errors.New("couldn't find a post")
+	}
+	return post, nil
+}
+
+func (s *contentService) GetScheduledPosts(userID string) ([]model.Post, error) {
+	posts, err := s.contentRepository.GetPendingPosts(userID)
+	if err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (s *contentService) ReschedulePost(userID string, postID string, publishAt time.Time) error {
+	post, err := s.findScheduledPost(userID, postID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if !publishAt.After(now) {
+		return errors.New("publishAt must be in the future")
+	}
+	if publishAt.After(now.Add(maxScheduleAhead)) {
+		return errors.New("post cannot be scheduled more than 1 year ahead")
+	}
+	if post.Poll != nil && !post.Poll.ExpiresDatetime.After(publishAt) {
+		return errors.New("poll would expire before the post is published")
+	}
+	return s.contentRepository.ReschedulePendingPost(postID, publishAt)
+}
+
+// CancelScheduledPost deletes the post and lets go of the references its media held
+func (s *contentService) CancelScheduledPost(userID string, postID string) error {
+	post, err := s.findScheduledPost(userID, postID)
+	if err != nil {
+		return err
+	}
+	if err := s.contentRepository.DeletePendingPost(postID); err != nil {
+		return err
+	}
+	for _, attachment := range post.Media {
+		if err := s.imageUploaderService.ReleaseMedia(attachment); err != nil {
+			fmt.Println("Error releasing post media:", err)
+		}
+	}
+	// imageUrl only stands on its own for posts published from a draft
+	if len(post.Media) == 0 && post.ImageUrl != nil {
+		if err := s.imageUploaderService.ReleaseImageUrl(*post.ImageUrl); err != nil {
+			fmt.Println("Error releasing post image:", err)
+		}
+	}
+	return nil
+}
+
+func (s *contentService) findScheduledPost(userID string, postID string) (*model.Post, error) {
+	post, err := s.contentRepository.FindPost(postID)
+	if err != nil || !post.IsPending() || post.UserID != userID {
+		return nil, errors.New("couldn't find a scheduled post")
+	}
 	return post, nil
 }
 
+// LikePost and UnlikePost are idempotent, repeating them leaves the post liked or unliked
+func (s *contentService) LikePost(userID string, postID string) error {
+	_, err := s.contentRepository.LikePost(userID, postID)
+	return err
+}
+
+func (s *contentService) UnlikePost(userID string, postID string) error {
+	_, err := s.contentRepository.UnlikePost(userID, postID)
+	return err
+}
+
+// ToggleLikeOnPost is kept for the toggle endpoint, a retried toggle can still flip the like back
 func (s *contentService) ToggleLikeOnPost(userID string, postID string) (bool, error) {
 	isLike, err := s.contentRepository.IsPostLikeByUserID(userID, postID)
 	if err != nil {
 		return false, err
 	}
+	if isLike {
+		return false, s.UnlikePost(userID, postID)
+	}
+	return true, s.LikePost(userID, postID)
+}
+
+func (s *contentService) ToggleLikeOnComment(userID string, postID string, commentID string) (bool, error) {
+	isLike, err := s.contentRepository.IsCommentLikeByUserID(userID, commentID)
+	if err != nil {
+		return false, err
+	}
 	if isLike { //do unlike
-		err := s.contentRepository.UnlikePost(userID, postID)
+		err := s.contentRepository.UnlikeComment(userID, commentID)
 		if err != nil {
 			return false, err
 		}
 		return false, nil
 	} else { // do like
-		_, err := s.contentRepository.LikePost(userID, postID)
+		err := s.contentRepository.LikeComment(userID, postID, commentID)
 		if err != nil {
 			return false, err
 		}
@@ -95,6 +470,18 @@ func (s *contentService) ToggleLikeOnPost(userID string, postID string) (bool, e
 	}
 }
 
+func (s *contentService) GetCommentLikeSummaries(userID string, commentIDs []string) (map[string]model.CommentLikeSummary, error) {
+	summaries, err := s.contentRepository.GetCommentLikeSummaries(userID, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	summaryMap := make(map[string]model.CommentLikeSummary)
+	for _, summary := range summaries {
+		summaryMap[summary.CommentID] = summary
+	}
+	return summaryMap, nil
+}
+
 func (s *contentService) CountLikeAndCommentOnPost(postID string) (int64, int64, error) {
 	likeCount, commentCount, err := s.contentRepository.CountLikeAndCommentOnPost(postID)
 	if err != nil {
@@ -103,47 +490,444 @@ func (s *contentService) CountLikeAndCommentOnPost(postID string) (int64, int64,
 	return likeCount, commentCount, nil
 }
 
-func (s *contentService) GetPosts(userID string, limit int, timeFrom *time.Time, postFilter, username string) (*model.PostDetailPagination, error) {
-	posts, err := s.contentRepository.GetPosts(userID, limit, timeFrom, postFilter, username)
+func (s *contentService) GetPosts(userID string, limit int, cursor string, postFilter, username string) (*model.PostDetailPagination, error) {
+	return s.getPostPage(userID, limit, cursor, postFilter, username, "")
+}
+
+func (s *contentService) GetPostsByHashtag(userID string, limit int, cursor string, hashtag string) (*model.PostDetailPagination, error) {
+	return s.getPostPage(userID, limit, cursor, "HASHTAG", "", util.NormalizeHashtag(hashtag))
+}
+
+// getPostPage continues after the cursor, the following feed is ordered by feedDatetime and the others by createdDatetime
+func (s *contentService) getPostPage(userID string, limit int, cursor string, postFilter, username, hashtag string) (*model.PostDetailPagination, error) {
+	if postFilter == "FOR_YOU" {
+		return s.getForYouPage(userID, limit, cursor)
+	}
+	after, err := s.decodeCursor(postsCursorScope, cursor)
+	if err != nil {
+		return nil, err
+	}
+	if postFilter == "FOLLOWING_POST" {
+		return s.getFollowingPage(userID, limit, after)
+	}
+	posts, err := s.contentRepository.GetPosts(userID, limit, after, postFilter, username, hashtag)
 	if err != nil {
 		return nil, err
 	}
+	for i := range posts.Posts {
+		s.decoratePost(&posts.Posts[i])
+	}
+	if posts.Pagination.HasMore {
+		last := posts.Posts[len(posts.Posts)-1]
+		if last.CreatedDatetime != nil {
+			posts.Pagination.NextCursor = util.EncodeCursor(s.envConfig.CursorSecret, postsCursorScope, model.Cursor{Datetime: *last.CreatedDatetime, ID: last.ID})
+		}
+	}
 	return posts, nil
 }
 
+// getFollowingPage reads a page of the home timeline. Entries whose post is gone or hidden are skipped and the
+// page is topped up from the entries after them, a page only comes back short when the timeline runs out or
+// after maxTimelineFetches reads. repostedBy and feedDatetime come from the timeline entries.
+func (s *contentService) getFollowingPage(userID string, limit int, after *model.Cursor) (*model.PostDetailPagination, error) {
+	page := &model.PostDetailPagination{
+		Pagination: model.Pagination{Limit: limit},
+		Posts:      []model.PostDetail{},
+	}
+	pageEntries := []model.TimelineEntry{}
+	hasMore := true
+	for fetch := 0; fetch < maxTimelineFetches && hasMore && len(page.Posts) < limit; fetch++ {
+		want := limit - len(page.Posts)
+		entries, err := s.timelineService.GetTimeline(userID, want, after)
+		if err != nil {
+			return nil, err
+		}
+		hasMore = len(entries) > want
+		if hasMore {
+			entries = entries[:want]
+		}
+		if len(entries) == 0 {
+			break
+		}
+		postIDs := []primitive.ObjectID{}
+		for _, entry := range entries {
+			postIDs = append(postIDs, entry.PostID)
+		}
+		posts, err := s.contentRepository.GetPostsByIDs(userID, postIDs)
+		if err != nil {
+			return nil, err
+		}
+		postMap := make(map[primitive.ObjectID]model.PostDetail)
+		for _, post := range posts {
+			postMap[post.ID] = post
+		}
+		for _, entry := range entries {
+			post, ok := postMap[entry.PostID]
+			if !ok {
+				continue
+			}
+			post.FeedDatetime = entry.FeedDatetime
+			page.Posts = append(page.Posts, post)
+			pageEntries = append(pageEntries, entry)
+		}
+		last := entries[len(entries)-1]
+		after = &model.Cursor{Datetime: *last.FeedDatetime, ID: last.PostID}
+	}
+	if err := s.setRepostedBy(page.Posts, pageEntries); err != nil {
+		return nil, err
+	}
+	for i := range page.Posts {
+		s.decoratePost(&page.Posts[i])
+	}
+	page.Pagination.Total = len(page.Posts)
+	page.Pagination.HasMore = hasMore
+	if hasMore {
+		page.Pagination.NextCursor = util.EncodeCursor(s.envConfig.CursorSecret, postsCursorScope, *after)
+	}
+	return page, nil
+}
+
+// setRepostedBy shows the latest followed reposter on each post, posts[i] is the post of entries[i]
+func (s *contentService) setRepostedBy(posts []model.PostDetail, entries []model.TimelineEntry) error {
+	reposterIDs := []string{}
+	for _, entry := range entries {
+		if reposterID, _, ok := latestRepost(entry); ok && !contains(reposterIDs, reposterID) {
+			reposterIDs = append(reposterIDs, reposterID)
+		}
+	}
+	if len(reposterIDs) == 0 {
+		return nil
+	}
+	users, err := s.userService.GetUsersByIDList(reposterIDs)
+	if err != nil {
+		return err
+	}
+	userMap := make(map[string]model.User)
+	for _, user := range users {
+		userMap[user.ID.Hex()] = user
+	}
+	for i, entry := range entries {
+		reposterID, repostDatetime, ok := latestRepost(entry)
+		if !ok {
+			continue
+		}
+		reposter := userMap[reposterID]
+		posts[i].RepostedBy = &model.RepostedBy{
+			UserID:          reposterID,
+			Username:        reposter.Username,
+			DisplayName:     reposter.DisplayName,
+			CreatedDatetime: &repostDatetime,
+			TotalReposters:  len(entry.Reposts),
+		}
+	}
+	return nil
+}
+
+// getForYouPage ranks the feed on the first page, the cursor carries the time it was ranked along with the last
+// post shown. Later pages follow the saved ranking and only rank again, as of the same time, once it has expired.
+// A cursor whose post is no longer ranked ends the feed.
+func (s *contentService) getForYouPage(userID string, limit int, cursor string) (*model.PostDetailPagination, error) {
+	after, err := s.decodeCursor(forYouCursorScope, cursor)
+	if err != nil {
+		return nil, err
+	}
+	// cursors keep milliseconds, the first page is ranked at the same precision as the ones after it
+	rankedAt := time.UnixMilli(time.Now().UnixMilli())
+	var rankedIDs []primitive.ObjectID
+	if after != nil {
+		rankedAt = after.Datetime
+		rankedIDs, err = s.feedRankingService.GetRankedPostIDs(userID, rankedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	postMap := make(map[primitive.ObjectID]model.PostDetail)
+	if rankedIDs == nil {
+		ranked, err := s.feedRankingService.RankForYou(userID, rankedAt)
+		if err != nil {
+			return nil, err
+		}
+		rankedIDs = []primitive.ObjectID{}
+		for _, post := range ranked {
+			rankedIDs = append(rankedIDs, post.ID)
+			postMap[post.ID] = post
+		}
+	}
+	start := 0
+	if after != nil {
+		start = len(rankedIDs)
+		for i, postID := range rankedIDs {
+			if postID == after.ID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := start + limit
+	if end > len(rankedIDs) {
+		end = len(rankedIDs)
+	}
+	pageIDs := rankedIDs[start:end]
+	missingIDs := []primitive.ObjectID{}
+	for _, postID := range pageIDs {
+		if _, ok := postMap[postID]; !ok {
+			missingIDs = append(missingIDs, postID)
+		}
+	}
+	if len(missingIDs) > 0 {
+		posts, err := s.contentRepository.GetPostsByIDs(userID, missingIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			postMap[post.ID] = post
+		}
+	}
+	page := &model.PostDetailPagination{
+		Pagination: model.Pagination{Limit: limit, HasMore: end < len(rankedIDs)},
+		Posts:      []model.PostDetail{},
+	}
+	// posts deleted or hidden since the feed was ranked are skipped
+	for _, postID := range pageIDs {
+		if post, ok := postMap[postID]; ok {
+			s.decoratePost(&post)
+			page.Posts = append(page.Posts, post)
+		}
+	}
+	page.Pagination.Total = len(page.Posts)
+	if page.Pagination.HasMore {
+		page.Pagination.NextCursor = util.EncodeCursor(s.envConfig.CursorSecret, forYouCursorScope, model.Cursor{Datetime: rankedAt, ID: pageIDs[len(pageIDs)-1]})
+	}
+	return page, nil
+}
+
+func (s *contentService) decodeCursor(scope string, cursor string) (*model.Cursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	return util.DecodeCursor(s.envConfig.CursorSecret, scope, cursor)
+}
+
 func (s *contentService) GetPostByID(userID, postID string) (*model.PostDetail, error) {
 	post, err := s.contentRepository.GetPostByID(userID, postID)
 	if err != nil {
 		return nil, err
 	}
+	s.decoratePost(post)
 	return post, nil
 }
 
-func (s *contentService) GetMetadata(targetUrl string) (*dto.MetadataExternal, error) {
-	client := &http.Client{}
-	requestedUrl := fmt.Sprintf("%s/api/metadata/%s", s.envConfig.MetadataEndpoint, url.QueryEscape(targetUrl))
-	req, err := http.NewRequest("GET", requestedUrl, nil)
+// decoratePost fills the fields of a post detail which are derived outside the database
+func (s *contentService) decoratePost(post *model.PostDetail) {
+	s.mergeHeartReaction(post)
+	post.HashtagEntities = util.ExtractHashtagEntities(post.Content)
+	post.PollResult = buildPollResult(post.Poll, post.PollVoteCounts, post.MyPollVote, time.Now())
+	// galleries stored before videos were supported only hold images
+	for i := range post.Media {
+		if post.Media[i].Type == "" {
+			post.Media[i].Type = model.MediaTypeImage
+			post.Media[i].Status = model.MediaStatusReady
+		}
+	}
+}
+
+// validatePoll checks the poll against startTime, the time the post becomes visible
+func validatePoll(poll *model.Poll, startTime time.Time) error {
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return fmt.Errorf("poll must have %d to %d options", minPollOptions, maxPollOptions)
+	}
+	for i, option := range poll.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return errors.New("poll option cannot be empty")
+		}
+		if utf8.RuneCountInString(option) > maxPollOptionLength {
+			return fmt.Errorf("poll option cannot be longer than %d characters", maxPollOptionLength)
+		}
+		poll.Options[i] = option
+	}
+	if poll.ExpiresDatetime == nil {
+		return errors.New("poll expiry cannot be empty")
+	}
+	if !poll.ExpiresDatetime.After(startTime) {
+		return errors.New("poll expiry must be after the post is published")
+	}
+	if poll.ExpiresDatetime.After(startTime.Add(maxPollDuration)) {
+		return errors.New("poll cannot last longer than 7 days")
+	}
+	return nil
+}
+
+func (s *contentService) VotePoll(userID string, postID string, optionIndex int) (*model.PollResult, error) {
+	post, err := s.contentRepository.FindPost(postID)
+	if err != nil || post.IsHidden() {
+		return nil, errors.New("couldn't find post")
+	}
+	if post.Poll == nil {
+		return nil, errors.New("post doesn't have a poll")
+	}
+	if !post.Poll.ExpiresDatetime.After(time.Now()) {
+		return nil, errors.New("poll is closed")
+	}
+	if optionIndex < 0 || optionIndex >= len(post.Poll.Options) {
+		return nil, errors.New("poll option doesn't exist")
+	}
+	err = s.contentRepository.VotePoll(userID, postID, optionIndex)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrPollAlreadyVoted
+		}
 		return nil, err
 	}
-	req.Header.Set("referer", requestedUrl)
-	resp, err := client.Do(req)
+	postDetail, err := s.GetPostByID(userID, postID)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
-		return nil, errors.New("response status error from metadata service")
+	return postDetail.PollResult, nil
+}
+
+// buildPollResult hides the counts until the viewer has voted or the poll has closed
+func buildPollResult(poll *model.Poll, voteCounts []int, myVote *int, now time.Time) *model.PollResult {
+	if poll == nil {
+		return nil
+	}
+	isClosed := poll.ExpiresDatetime == nil || !poll.ExpiresDatetime.After(now)
+	result := &model.PollResult{
+		Options:         []model.PollOptionResult{},
+		ExpiresDatetime: poll.ExpiresDatetime,
+		IsClosed:        isClosed,
+		MyVote:          myVote,
+	}
+	showCounts := isClosed || myVote != nil
+	totalVotes := 0
+	for i := range poll.Options {
+		if i < len(voteCounts) {
+			totalVotes += voteCounts[i]
+		}
+	}
+	for i, option := range poll.Options {
+		optionResult := model.PollOptionResult{Text: option}
+		if showCounts {
+			voteCount := 0
+			if i < len(voteCounts) {
+				voteCount = voteCounts[i]
+			}
+			percentage := 0.0
+			if totalVotes > 0 {
+				percentage = math.Round(float64(voteCount)*1000/float64(totalVotes)) / 10
+			}
+			optionResult.VoteCount = &voteCount
+			optionResult.Percentage = &percentage
+		}
+		result.Options = append(result.Options, optionResult)
+	}
+	if showCounts {
+		result.TotalVotes = &totalVotes
 	}
-	var response dto.MetadataExternal
-	body, err := io.ReadAll(resp.Body)
+	return result
+}
+
+func (s *contentService) ToggleRepostOnPost(userID string, postID string) (bool, error) {
+	isRepost, err := s.contentRepository.IsPostRepostedByUserID(userID, postID)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	err = json.Unmarshal([]byte(body), &response)
+	if isRepost { //do unrepost
+		err := s.contentRepository.UnrepostPost(userID, postID)
+		if err != nil {
+			return false, err
+		}
+		s.timelineService.RemoveRepost(userID, postID)
+		return false, nil
+	} else { // do repost
+		err := s.contentRepository.RepostPost(userID, postID)
+		if err != nil {
+			return false, err
+		}
+		s.timelineService.EnqueueRepost(userID, postID, time.Now())
+		return true, nil
+	}
+}
+
+func (s *contentService) GetReactionEmojis() []string {
+	return s.envConfig.ReactionEmojis
+}
+
+// heart goes through the like collection so the old like endpoint and the heart reaction stay in sync
+func (s *contentService) ToggleReactionOnPost(userID string, postID string, emoji string) (bool, error) {
+	if !s.isReactionEmojiAllowed(emoji) {
+		return false, errors.New("emoji is not allowed")
+	}
+	if emoji == heartReaction {
+		return s.ToggleLikeOnPost(userID, postID)
+	}
+	isReacted, err := s.contentRepository.IsPostReactedByUserID(userID, postID, emoji)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
+	if isReacted {
+		err := s.contentRepository.RemoveReaction(userID, postID, emoji)
+		if err != nil {
+			return false, err
+		}
+		return false, nil
+	} else {
+		err := s.contentRepository.AddReaction(userID, postID, emoji)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
 
-	return &response, nil
+func (s *contentService) isReactionEmojiAllowed(emoji string) bool {
+	for _, allowedEmoji := range s.envConfig.ReactionEmojis {
+		if allowedEmoji == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeHeartReaction exposes likes as the heart reaction and orders reactions like the configured emoji set
+func (s *contentService) mergeHeartReaction(post *model.PostDetail) {
+	reactions := []model.ReactionCount{}
+	if post.TotalLikes > 0 {
+		reactions = append(reactions, model.ReactionCount{Emoji: heartReaction, Count: post.TotalLikes})
+	}
+	myReactions := []string{}
+	if post.IsLike {
+		myReactions = append(myReactions, heartReaction)
+	}
+
+	countMap := make(map[string]int)
+	for _, reaction := range post.Reactions {
+		countMap[reaction.Emoji] = reaction.Count
+	}
+	myReactionMap := make(map[string]bool)
+	for _, emoji := range post.MyReactions {
+		myReactionMap[emoji] = true
+	}
+	for _, emoji := range s.envConfig.ReactionEmojis {
+		if emoji == heartReaction {
+			continue
+		}
+		if countMap[emoji] > 0 {
+			reactions = append(reactions, model.ReactionCount{Emoji: emoji, Count: countMap[emoji]})
+		}
+		if myReactionMap[emoji] {
+			myReactions = append(myReactions, emoji)
+		}
+	}
+	post.Reactions = reactions
+	post.MyReactions = myReactions
+}
+
+// GetMetadata serves the cached link preview, the response keeps the shape of the old metadata service
+func (s *contentService) GetMetadata(targetUrl string) (*dto.MetadataExternal, error) {
+	metadata, err := s.linkPreviewService.GetLinkPreview(targetUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.MetadataExternal{Metadata: *metadata}, nil
 }
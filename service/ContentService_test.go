@@ -0,0 +1,42 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/dto"
+	"github.com/tipbk/sneakfeed-service/model"
+)
+
+func TestCreatePostRefusesInvalidPosts(t *testing.T) {
+	now := time.Now()
+	tooFar := now.Add(2 * maxScheduleAhead)
+	pollEnd := now.Add(time.Hour)
+	tests := []struct {
+		name      string
+		content   string
+		poll      *model.Poll
+		publishAt *time.Time
+		media     []dto.CreateMediaRequest
+		wantErr   error
+	}{
+		{name: "empty content", content: "", wantErr: ErrEmptyContent},
+		{name: "scheduled too far ahead", content: "hi", publishAt: &tooFar, wantErr: ErrInvalidPost},
+		{name: "poll with one option", content: "hi", poll: &model.Poll{Options: []string{"yes"}, ExpiresDatetime: &pollEnd}, wantErr: ErrInvalidPost},
+		{name: "poll without expiry", content: "hi", poll: &model.Poll{Options: []string{"yes", "no"}}, wantErr: ErrInvalidPost},
+		{name: "too many media", content: "hi", media: make([]dto.CreateMediaRequest, MaxMediaPerPost+1), wantErr: ErrInvalidPost},
+		{name: "media without a source", content: "hi", media: []dto.CreateMediaRequest{{AltText: "a cat"}}, wantErr: ErrInvalidPost},
+		{name: "alt text too long", content: "hi", media: []dto.CreateMediaRequest{{MediaID: "m", AltText: strings.Repeat("a", maxAltTextLength+1)}}, wantErr: ErrInvalidPost},
+	}
+	contentService := &contentService{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := contentService.CreatePost("user", test.content, nil, nil, test.poll, test.publishAt, test.media)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("got %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	counterReconcilerLockName  = "counter_reconciler"
+	counterReconcilerBatchSize = 500
+)
+
+// CounterReconcilerService recounts the likes and comments of every post and repairs counters that drifted,
+// it also fills the counters of posts created before they existed. Only the replica holding the Mongo lock runs it.
+type CounterReconcilerService interface {
+	Start()
+	ReconcileCounters() error
+}
+
+type counterReconcilerService struct {
+	envConfig         *config.EnvConfig
+	counterRepository repository.CounterRepository
+	lockRepository    repository.LockRepository
+	instanceID        string
+}
+
+func NewCounterReconcilerService(envConfig *config.EnvConfig, counterRepository repository.CounterRepository, lockRepository repository.LockRepository) CounterReconcilerService {
+	return &counterReconcilerService{
+		envConfig:         envConfig,
+		counterRepository: counterRepository,
+		lockRepository:    lockRepository,
+		instanceID:        primitive.NewObjectID().Hex(),
+	}
+}
+
+// Start reconciles right away so counters missing after an upgrade are filled, then on every interval
+func (s *counterReconcilerService) Start() {
+	interval := time.Duration(s.envConfig.CounterReconcileIntervalMinutes) * time.Minute
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			isLeader, err := s.lockRepository.AcquireLock(counterReconcilerLockName, s.instanceID, interval*3)
+			if err != nil {
+				fmt.Println("Error acquiring counter reconciler lock:", err)
+			} else if isLeader {
+				if err := s.ReconcileCounters(); err != nil {
+					fmt.Println("Error reconciling counters:", err)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *counterReconcilerService) ReconcileCounters() error {
+	var afterPostID *primitive.ObjectID
+	repaired := 0
+	for {
+		counters, err := s.counterRepository.GetPostCounters(afterPostID, counterReconcilerBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(counters) == 0 {
+			break
+		}
+		postIDs := []primitive.ObjectID{}
+		for _, counter := range counters {
+			postIDs = append(postIDs, counter.ID)
+		}
+		// counted after the counters were read, see RepairPostCounters
+		likeCounts, err := s.counterRepository.CountPostLikes(postIDs)
+		if err != nil {
+			return err
+		}
+		commentCounts, err := s.counterRepository.CountPostComments(postIDs)
+		if err != nil {
+			return err
+		}
+		for _, counter := range counters {
+			likeCount := likeCounts[counter.ID]
+			commentCount := commentCounts[counter.ID]
+			if counter.LikeCount != nil && *counter.LikeCount == likeCount && counter.CommentCount != nil && *counter.CommentCount == commentCount {
+				continue
+			}
+			isRepaired, err := s.counterRepository.RepairPostCounters(counter, likeCount, commentCount)
+			if err != nil {
+				return err
+			}
+			if isRepaired {
+				repaired++
+			}
+		}
+		afterPostID = &counters[len(counters)-1].ID
+	}
+	if repaired > 0 {
+		fmt.Println("Repaired post counters:", repaired)
+	}
+	return nil
+}
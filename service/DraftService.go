@@ -0,0 +1,146 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"github.com/tipbk/sneakfeed-service/util"
+)
+
+type DraftService interface {
+	CreateDraft(draft *model.Draft, imageBase64 *string) (string, error)
+	GetDrafts(userID string) ([]model.Draft, error)
+	FindDraft(userID string, draftID string) (*model.Draft, error)
+	UpdateDraft(draft *model.Draft, imageBase64 *string, removeImage bool) error
+	DeleteDraft(userID string, draftID string) error
+	PublishDraft(draft *model.Draft) (string, error)
+}
+
+// A draft holds a reference on its image until it is replaced, deleted or handed to the published post
+type draftService struct {
+	draftRepository      repository.DraftRepository
+	contentService       ContentService
+	imageUploaderService ImageUploaderService
+	linkPreviewService   LinkPreviewService
+}
+
+func NewDraftService(draftRepository repository.DraftRepository, contentService ContentService, imageUploaderService ImageUploaderService, linkPreviewService LinkPreviewService) DraftService {
+	return &draftService{
+		draftRepository:      draftRepository,
+		contentService:       contentService,
+		imageUploaderService: imageUploaderService,
+		linkPreviewService:   linkPreviewService,
+	}
+}
+
+func (s *draftService) CreateDraft(draft *model.Draft, imageBase64 *string) (string, error) {
+	s.attachDraftPreview(draft)
+	if err := s.uploadDraftImage(draft, imageBase64); err != nil {
+		return "", err
+	}
+	draftID, err := s.draftRepository.CreateDraft(draft)
+	if err != nil {
+		s.releaseDraftImage(draft.ImageUrl)
+		return "", err
+	}
+	return draftID, nil
+}
+
+func (s *draftService) GetDrafts(userID string) ([]model.Draft, error) {
+	return s.draftRepository.GetDrafts(userID)
+}
+
+func (s *draftService) FindDraft(userID string, draftID string) (*model.Draft, error) {
+	return s.draftRepository.FindDraft(userID, draftID)
+}
+
+// UpdateDraft saves the draft with a new image, without its image or keeping the stored one
+func (s *draftService) UpdateDraft(draft *model.Draft, imageBase64 *string, removeImage bool) error {
+	s.attachDraftPreview(draft)
+	previousImageUrl := draft.ImageUrl
+	if removeImage {
+		draft.ImageUrl = nil
+	}
+	if err := s.uploadDraftImage(draft, imageBase64); err != nil {
+		return err
+	}
+	isImageChanged := draft.ImageUrl != previousImageUrl
+	if err := s.draftRepository.UpdateDraft(draft); err != nil {
+		if isImageChanged {
+			s.releaseDraftImage(draft.ImageUrl)
+		}
+		return err
+	}
+	if isImageChanged {
+		s.releaseDraftImage(previousImageUrl)
+	}
+	return nil
+}
+
+func (s *draftService) DeleteDraft(userID string, draftID string) error {
+	draft, err := s.draftRepository.FindDraft(userID, draftID)
+	if err != nil {
+		return err
+	}
+	if err := s.draftRepository.DeleteDraft(draft.UserID, draft.ID.Hex()); err != nil {
+		return err
+	}
+	s.releaseDraftImage(draft.ImageUrl)
+	return nil
+}
+
+// PublishDraft creates the post through the same path as POST /posts and removes the draft afterwards
+func (s *draftService) PublishDraft(draft *model.Draft) (string, error) {
+	postID, err := s.contentService.CreatePost(draft.UserID, draft.Content, draft.ImageUrl, nil, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	// the post already exists, a leftover draft is harmless so only log it
+	if err := s.draftRepository.DeleteDraft(draft.UserID, draft.ID.Hex()); err != nil {
+		fmt.Println("Error deleting published draft:", err)
+	}
+	return postID, nil
+}
+
+// attachDraftPreview fills the og fields from the link preview cache, never from the client.
+// A draft without a link, or with one that can't be previewed, has no og fields.
+func (s *draftService) attachDraftPreview(draft *model.Draft) {
+	draft.OgTitle, draft.OgDescription, draft.OgLink, draft.OgImage, draft.OgDomain = nil, nil, nil, nil, nil
+	previewUrl := util.ExtractFirstUrl(draft.Content)
+	if previewUrl == "" {
+		return
+	}
+	metadata, err := s.linkPreviewService.GetLinkPreview(previewUrl)
+	if err != nil {
+		return
+	}
+	draft.OgTitle = &metadata.OgTitle
+	draft.OgDescription = &metadata.OgDescription
+	draft.OgLink = &previewUrl
+	draft.OgImage = &metadata.Image
+	draft.OgDomain = &metadata.Domain
+}
+
+// uploadDraftImage stores a new pending image for the draft, the upload holds the draft's reference
+func (s *draftService) uploadDraftImage(draft *model.Draft, imageBase64 *string) error {
+	if imageBase64 == nil {
+		return nil
+	}
+	uploadResponse, err := s.imageUploaderService.UploadImage(*imageBase64)
+	if err != nil {
+		return err
+	}
+	draft.ImageUrl = &uploadResponse.Url
+	return nil
+}
+
+// releaseDraftImage lets go of an image the draft no longer uses, a published draft hands its image to the post instead
+func (s *draftService) releaseDraftImage(imageUrl *string) {
+	if imageUrl == nil {
+		return
+	}
+	if err := s.imageUploaderService.ReleaseImageUrl(*imageUrl); err != nil {
+		fmt.Println("Error releasing draft image:", err)
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tipbk/sneakfeed-service/dto"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+)
+
+type fakeDraftLinkPreviewService struct {
+	previews map[string]dto.Metadata
+}
+
+func (s *fakeDraftLinkPreviewService) GetLinkPreview(targetUrl string) (*dto.Metadata, error) {
+	metadata, ok := s.previews[targetUrl]
+	if !ok {
+		return nil, errors.New("no preview")
+	}
+	return &metadata, nil
+}
+
+type fakeDraftRepository struct {
+	repository.DraftRepository
+	saved *model.Draft
+}
+
+func (r *fakeDraftRepository) CreateDraft(draft *model.Draft) (string, error) {
+	r.saved = draft
+	return "draft", nil
+}
+
+func (r *fakeDraftRepository) UpdateDraft(draft *model.Draft) error {
+	r.saved = draft
+	return nil
+}
+
+func TestDraftPreviewComesFromTheLink(t *testing.T) {
+	links := &fakeDraftLinkPreviewService{previews: map[string]dto.Metadata{
+		"https://example.com/article": {OgTitle: "Article", Domain: "example.com"},
+	}}
+	drafts := &fakeDraftRepository{}
+	draftService := NewDraftService(drafts, nil, nil, links)
+
+	forged := "Forged"
+	draft := &model.Draft{UserID: "user", Content: "read https://example.com/article", OgTitle: &forged}
+	if _, err := draftService.CreateDraft(draft, nil); err != nil {
+		t.Fatal(err)
+	}
+	if drafts.saved.OgTitle == nil || *drafts.saved.OgTitle != "Article" || *drafts.saved.OgLink != "https://example.com/article" {
+		t.Errorf("got og title %v, want the fetched preview", drafts.saved.OgTitle)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"link removed", "no link anymore"},
+		{"link without a preview", "read https://example.com/missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			draft.Content = test.content
+			if err := draftService.UpdateDraft(draft, nil, false); err != nil {
+				t.Fatal(err)
+			}
+			if drafts.saved.OgTitle != nil || drafts.saved.OgLink != nil {
+				t.Errorf("got og title %v and link %v, want the old preview cleared", drafts.saved.OgTitle, drafts.saved.OgLink)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// weights are read again at most this often, changes in feed_ranking show up without a restart
+	feedRankingWeightsRefresh = time.Minute
+	secondDegreeAccounts      = 100
+	// a FOR_YOU cursor keeps following its ranking for this long, after that the feed is ranked again
+	forYouRankingTtl = time.Hour
+)
+
+// FeedRankingService ranks the FOR_YOU feed. Candidates are recent posts from followed accounts, accounts
+// followed by followed accounts and posts using trending hashtags or domains.
+type FeedRankingService interface {
+	RankForYou(userID string, rankedAt time.Time) ([]model.PostDetail, error)
+	GetRankedPostIDs(userID string, rankedAt time.Time) ([]primitive.ObjectID, error)
+}
+
+type feedRankingService struct {
+	feedRankingRepository repository.FeedRankingRepository
+	timelineRepository    repository.TimelineRepository
+	trendingService       TrendingService
+	weightsLock           sync.Mutex
+	weights               *model.FeedRankingWeights
+	weightsLoadedDatetime time.Time
+}
+
+func NewFeedRankingService(feedRankingRepository repository.FeedRankingRepository, timelineRepository repository.TimelineRepository, trendingService TrendingService) FeedRankingService {
+	return &feedRankingService{
+		feedRankingRepository: feedRankingRepository,
+		timelineRepository:    timelineRepository,
+		trendingService:       trendingService,
+	}
+}
+
+// rankingCandidate is a post with the highest source weight it was found through
+type rankingCandidate struct {
+	Post         model.PostDetail
+	SourceWeight float64
+}
+
+// RankForYou ranks everything as of rankedAt and saves the order for GetRankedPostIDs, later pages
+// follow it instead of ranking again while likes and comments keep changing the scores
+func (s *feedRankingService) RankForYou(userID string, rankedAt time.Time) ([]model.PostDetail, error) {
+	weights := s.getWeights()
+	from := rankedAt.Add(-time.Duration(weights.CandidateHours * float64(time.Hour)))
+
+	followingIDs, err := s.timelineRepository.GetFollowingIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	secondDegreeIDs, err := s.feedRankingRepository.GetSecondDegreeUserIDs(userID, followingIDs, secondDegreeAccounts)
+	if err != nil {
+		return nil, err
+	}
+	trending, err := s.trendingService.GetTrending()
+	if err != nil {
+		return nil, err
+	}
+	hashtags := []string{}
+	for _, item := range trending.Hashtags {
+		hashtags = append(hashtags, item.Name)
+	}
+	domains := []string{}
+	for _, item := range trending.Domains {
+		domains = append(domains, item.Name)
+	}
+
+	candidates := map[string]*rankingCandidate{}
+	addCandidates := func(posts []model.PostDetail, sourceWeight float64) {
+		for _, post := range posts {
+			candidate, ok := candidates[post.ID.Hex()]
+			if !ok {
+				candidates[post.ID.Hex()] = &rankingCandidate{Post: post, SourceWeight: sourceWeight}
+			} else if sourceWeight > candidate.SourceWeight {
+				candidate.SourceWeight = sourceWeight
+			}
+		}
+	}
+	followingPosts, err := s.feedRankingRepository.GetCandidatePostsByAuthors(userID, followingIDs, from, rankedAt, weights.CandidatesPerSource)
+	if err != nil {
+		return nil, err
+	}
+	addCandidates(followingPosts, weights.FollowingWeight)
+	secondDegreePosts, err := s.feedRankingRepository.GetCandidatePostsByAuthors(userID, secondDegreeIDs, from, rankedAt, weights.CandidatesPerSource)
+	if err != nil {
+		return nil, err
+	}
+	addCandidates(secondDegreePosts, weights.SecondDegreeWeight)
+	trendingPosts, err := s.feedRankingRepository.GetCandidatePostsByTerms(userID, hashtags, domains, from, rankedAt, weights.CandidatesPerSource)
+	if err != nil {
+		return nil, err
+	}
+	addCandidates(trendingPosts, weights.TrendingWeight)
+
+	affinities, err := s.feedRankingRepository.GetAuthorAffinities(userID, rankedAt.AddDate(0, 0, -weights.AffinityDays))
+	if err != nil {
+		return nil, err
+	}
+	rankingCandidates := []rankingCandidate{}
+	for _, candidate := range candidates {
+		rankingCandidates = append(rankingCandidates, *candidate)
+	}
+	ranked := rankPosts(rankingCandidates, affinities, *weights, rankedAt)
+
+	postIDs := []primitive.ObjectID{}
+	for _, post := range ranked {
+		postIDs = append(postIDs, post.ID)
+	}
+	expiresDatetime := time.Now().Add(forYouRankingTtl)
+	ranking := &model.ForYouRanking{UserID: userID, RankedDatetime: &rankedAt, PostIDs: postIDs, ExpiresDatetime: &expiresDatetime}
+	// the feed still works without it, later pages are ranked again
+	if err := s.feedRankingRepository.SaveForYouRanking(ranking); err != nil {
+		fmt.Println("Error saving for you ranking:", userID, err)
+	}
+	return ranked, nil
+}
+
+// GetRankedPostIDs returns the order RankForYou saved, nil once it has expired
+func (s *feedRankingService) GetRankedPostIDs(userID string, rankedAt time.Time) ([]primitive.ObjectID, error) {
+	ranking, err := s.feedRankingRepository.GetForYouRanking(userID, rankedAt)
+	if err != nil || ranking == nil {
+		return nil, err
+	}
+	return ranking.PostIDs, nil
+}
+
+// getWeights keeps serving the last weights it could read, or the defaults, while feed_ranking is unavailable
+func (s *feedRankingService) getWeights() *model.FeedRankingWeights {
+	s.weightsLock.Lock()
+	defer s.weightsLock.Unlock()
+	if s.weights != nil && time.Since(s.weightsLoadedDatetime) < feedRankingWeightsRefresh {
+		return s.weights
+	}
+	weights, err := s.feedRankingRepository.GetFeedRankingWeights(model.DefaultFeedRankingWeights())
+	if err != nil {
+		fmt.Println("Error loading feed ranking weights:", err)
+		if s.weights != nil {
+			return s.weights
+		}
+		defaults := model.DefaultFeedRankingWeights()
+		return &defaults
+	}
+	s.weights = weights
+	s.weightsLoadedDatetime = time.Now()
+	return s.weights
+}
+
+// rankPosts orders the candidates by score and then spreads authors out. It only depends on its arguments,
+// equal scores are ordered by post id so the same input always gives the same feed.
+func rankPosts(candidates []rankingCandidate, affinities map[string]int, weights model.FeedRankingWeights, now time.Time) []model.PostDetail {
+	scored := make([]scoredPost, 0, len(candidates))
+	for _, candidate := range candidates {
+		scored = append(scored, scoredPost{
+			post:  candidate.Post,
+			score: scorePost(candidate, affinities[candidate.Post.UserID], weights, now),
+		})
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		return scored[i].isBefore(scored[j])
+	})
+	return diversifyPosts(scored, weights)
+}
+
+// scorePost is recency decay times the sum of the source weight, engagement and author affinity
+func scorePost(candidate rankingCandidate, affinity int, weights model.FeedRankingWeights, now time.Time) float64 {
+	post := candidate.Post
+	ageHours := 0.0
+	if post.CreatedDatetime != nil && now.After(*post.CreatedDatetime) {
+		ageHours = now.Sub(*post.CreatedDatetime).Hours()
+	}
+	recency := 1.0
+	if weights.RecencyHalfLifeHours > 0 {
+		recency = math.Pow(0.5, ageHours/weights.RecencyHalfLifeHours)
+	}
+	engagement := math.Log1p(weights.LikeWeight*float64(post.TotalLikes) +
+		weights.CommentWeight*float64(post.TotalComments) +
+		weights.RepostWeight*float64(post.TotalReposts))
+	return recency * (candidate.SourceWeight +
+		weights.EngagementWeight*engagement +
+		weights.AffinityWeight*math.Log1p(float64(affinity)))
+}
+
+type scoredPost struct {
+	post  model.PostDetail
+	score float64
+}
+
+func (p scoredPost) isBefore(other scoredPost) bool {
+	if p.score != other.score {
+		return p.score > other.score
+	}
+	return p.post.ID.Hex() > other.post.ID.Hex()
+}
+
+// diversifyPosts picks posts greedily by score after the author repeat penalty, keeps at most
+// MaxPostsPerAuthor per author and avoids the same author twice in a row while anyone else is left
+func diversifyPosts(scored []scoredPost, weights model.FeedRankingWeights) []model.PostDetail {
+	picked := []model.PostDetail{}
+	authorCounts := map[string]int{}
+	remaining := scored
+	previousAuthor := ""
+	for len(remaining) > 0 {
+		best := -1
+		var bestPost scoredPost
+		eligible := remaining[:0]
+		for _, candidate := range remaining {
+			if weights.MaxPostsPerAuthor > 0 && authorCounts[candidate.post.UserID] >= weights.MaxPostsPerAuthor {
+				continue
+			}
+			eligible = append(eligible, candidate)
+		}
+		remaining = eligible
+		for i, candidate := range remaining {
+			adjusted := candidate
+			adjusted.score *= math.Pow(weights.AuthorRepeatPenalty, float64(authorCounts[candidate.post.UserID]))
+			if best >= 0 {
+				isRepeat := candidate.post.UserID == previousAuthor
+				isBestRepeat := remaining[best].post.UserID == previousAuthor
+				if isRepeat && !isBestRepeat {
+					continue
+				}
+				if isRepeat == isBestRepeat && !adjusted.isBefore(bestPost) {
+					continue
+				}
+			}
+			best = i
+			bestPost = adjusted
+		}
+		if best < 0 {
+			break
+		}
+		chosen := remaining[best]
+		picked = append(picked, chosen.post)
+		authorCounts[chosen.post.UserID]++
+		previousAuthor = chosen.post.UserID
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return picked
+}
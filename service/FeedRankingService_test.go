@@ -0,0 +1,239 @@
+package service
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func rankingPost(userID string, createdDatetime time.Time, likes int) model.PostDetail {
+	return model.PostDetail{ID: primitive.NewObjectID(), UserID: userID, CreatedDatetime: &createdDatetime, TotalLikes: likes}
+}
+
+func postIDs(posts []model.PostDetail) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func TestRankPostsScore(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		first      model.PostDetail
+		second     model.PostDetail
+		affinities map[string]int
+	}{
+		{
+			name:   "newer posts first",
+			first:  rankingPost("a", now.Add(-time.Hour), 0),
+			second: rankingPost("b", now.Add(-24*time.Hour), 0),
+		},
+		{
+			name:   "more engagement first",
+			first:  rankingPost("a", now.Add(-time.Hour), 20),
+			second: rankingPost("b", now.Add(-time.Hour), 0),
+		},
+		{
+			name:       "authors the reader interacts with first",
+			first:      rankingPost("a", now.Add(-time.Hour), 0),
+			second:     rankingPost("b", now.Add(-time.Hour), 0),
+			affinities: map[string]int{"a": 5},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candidates := []rankingCandidate{{Post: test.second, SourceWeight: 1}, {Post: test.first, SourceWeight: 1}}
+			got := rankPosts(candidates, test.affinities, model.DefaultFeedRankingWeights(), now)
+			if want := postIDs([]model.PostDetail{test.first, test.second}); !reflect.DeepEqual(postIDs(got), want) {
+				t.Errorf("got %v, want %v", postIDs(got), want)
+			}
+		})
+	}
+}
+
+func TestRankPostsTieBreak(t *testing.T) {
+	now := time.Now()
+	a := rankingPost("a", now, 0)
+	b := rankingPost("b", now, 0)
+	want := []primitive.ObjectID{b.ID, a.ID}
+	for _, candidates := range [][]rankingCandidate{
+		{{Post: a, SourceWeight: 1}, {Post: b, SourceWeight: 1}},
+		{{Post: b, SourceWeight: 1}, {Post: a, SourceWeight: 1}},
+	} {
+		if got := postIDs(rankPosts(candidates, nil, model.DefaultFeedRankingWeights(), now)); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want equal scores ordered by the larger id first %v", got, want)
+		}
+	}
+}
+
+func TestDiversifyPosts(t *testing.T) {
+	weights := model.DefaultFeedRankingWeights()
+	weights.MaxPostsPerAuthor = 3
+	scored := []scoredPost{}
+	for i := 0; i < 5; i++ {
+		scored = append(scored, scoredPost{post: model.PostDetail{ID: primitive.NewObjectID(), UserID: "prolific"}, score: float64(10 - i)})
+	}
+	scored = append(scored,
+		scoredPost{post: model.PostDetail{ID: primitive.NewObjectID(), UserID: "quiet"}, score: 1},
+		scoredPost{post: model.PostDetail{ID: primitive.NewObjectID(), UserID: "quiet"}, score: 0.5},
+	)
+
+	best, second := scored[0].post.ID, scored[1].post.ID
+	picked := diversifyPosts(scored, weights)
+	authors := []string{}
+	for _, post := range picked {
+		authors = append(authors, post.UserID)
+	}
+	want := []string{"prolific", "quiet", "prolific", "quiet", "prolific"}
+	if !reflect.DeepEqual(authors, want) {
+		t.Errorf("got authors %v, want %v", authors, want)
+	}
+	if picked[0].ID != best || picked[2].ID != second {
+		t.Errorf("an author's posts were not kept in score order")
+	}
+}
+
+// fakeFeedRankingRepository finds candidates by author in posts and keeps saved rankings in memory
+type fakeFeedRankingRepository struct {
+	repository.FeedRankingRepository
+	posts           []model.PostDetail
+	trendingPosts   []model.PostDetail
+	secondDegreeIDs []string
+	rankings        map[string]*model.ForYouRanking
+}
+
+func (r *fakeFeedRankingRepository) GetFeedRankingWeights(defaults model.FeedRankingWeights) (*model.FeedRankingWeights, error) {
+	return &defaults, nil
+}
+
+func (r *fakeFeedRankingRepository) GetSecondDegreeUserIDs(userID string, followingIDs []string, limit int) ([]string, error) {
+	return r.secondDegreeIDs, nil
+}
+
+func (r *fakeFeedRankingRepository) GetCandidatePostsByAuthors(userID string, authorIDs []string, from, until time.Time, limit int) ([]model.PostDetail, error) {
+	posts := []model.PostDetail{}
+	for _, post := range r.posts {
+		if contains(authorIDs, post.UserID) {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+func (r *fakeFeedRankingRepository) GetCandidatePostsByTerms(userID string, hashtags []string, domains []string, from, until time.Time, limit int) ([]model.PostDetail, error) {
+	return r.trendingPosts, nil
+}
+
+func (r *fakeFeedRankingRepository) GetAuthorAffinities(userID string, since time.Time) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func (r *fakeFeedRankingRepository) SaveForYouRanking(ranking *model.ForYouRanking) error {
+	r.rankings[ranking.UserID+strconv.FormatInt(ranking.RankedDatetime.UnixMilli(), 10)] = ranking
+	return nil
+}
+
+func (r *fakeFeedRankingRepository) GetForYouRanking(userID string, rankedDatetime time.Time) (*model.ForYouRanking, error) {
+	return r.rankings[userID+strconv.FormatInt(rankedDatetime.UnixMilli(), 10)], nil
+}
+
+type fakeFollowingRepository struct {
+	repository.TimelineRepository
+	followingIDs []string
+}
+
+func (r *fakeFollowingRepository) GetFollowingIDs(userID string) ([]string, error) {
+	return r.followingIDs, nil
+}
+
+type fakeTrendingService struct {
+	TrendingService
+}
+
+func (s *fakeTrendingService) GetTrending() (*model.Trending, error) {
+	return &model.Trending{}, nil
+}
+
+func newTestFeedRankingService(rankingRepository *fakeFeedRankingRepository, followingIDs []string) FeedRankingService {
+	rankingRepository.rankings = map[string]*model.ForYouRanking{}
+	return NewFeedRankingService(rankingRepository, &fakeFollowingRepository{followingIDs: followingIDs}, &fakeTrendingService{})
+}
+
+func TestRankForYouTakesTheHighestSourceWeight(t *testing.T) {
+	now := time.Now()
+	// found through following and trending, it has to keep the following weight to beat the second degree post
+	shared := rankingPost("friend", now.Add(-time.Hour), 0)
+	secondDegree := rankingPost("friend-of-friend", now.Add(-time.Hour), 0)
+	rankingRepository := &fakeFeedRankingRepository{
+		posts:           []model.PostDetail{shared, secondDegree},
+		trendingPosts:   []model.PostDetail{shared},
+		secondDegreeIDs: []string{"friend-of-friend"},
+	}
+	feedRankingService := newTestFeedRankingService(rankingRepository, []string{"friend"})
+
+	ranked, err := feedRankingService.RankForYou("me", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []primitive.ObjectID{shared.ID, secondDegree.ID}; !reflect.DeepEqual(postIDs(ranked), want) {
+		t.Errorf("got %v, want %v", postIDs(ranked), want)
+	}
+}
+
+func TestGetForYouPageFollowsTheRanking(t *testing.T) {
+	now := time.Now()
+	posts := []model.PostDetail{}
+	followingIDs := []string{}
+	visible := map[primitive.ObjectID]bool{}
+	for i := 0; i < 4; i++ {
+		authorID := "author" + strconv.Itoa(i)
+		post := rankingPost(authorID, now.Add(-time.Duration(i+1)*time.Hour), 0)
+		posts = append(posts, post)
+		followingIDs = append(followingIDs, authorID)
+		visible[post.ID] = true
+	}
+	rankingRepository := &fakeFeedRankingRepository{posts: posts}
+	contentService := &contentService{
+		envConfig:          &config.EnvConfig{CursorSecret: "secret"},
+		contentRepository:  &fakeTimelineContentRepository{visible: visible},
+		feedRankingService: newTestFeedRankingService(rankingRepository, followingIDs),
+	}
+
+	page, err := contentService.getForYouPage("me", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := postIDs(posts[:2]); !reflect.DeepEqual(postIDs(page.Posts), want) || !page.Pagination.HasMore {
+		t.Fatalf("first page got %v and %+v, want %v", postIDs(page.Posts), page.Pagination, want)
+	}
+	cursor := page.Pagination.NextCursor
+
+	// the oldest post takes off after the first page, the next page still follows the order it was ranked in
+	rankingRepository.posts[3].TotalLikes = 1000
+	page, err = contentService.getForYouPage("me", 2, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := postIDs(posts[2:]); !reflect.DeepEqual(postIDs(page.Posts), want) || page.Pagination.HasMore {
+		t.Errorf("second page got %v and %+v, want %v", postIDs(page.Posts), page.Pagination, want)
+	}
+
+	// once the saved ranking has expired the feed is ranked again and continues after the cursor's post
+	rankingRepository.rankings = map[string]*model.ForYouRanking{}
+	page, err = contentService.getForYouPage("me", 2, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := postIDs(posts[2:3]); !reflect.DeepEqual(postIDs(page.Posts), want) {
+		t.Errorf("second page after expiry got %v, want %v", postIDs(page.Posts), want)
+	}
+}
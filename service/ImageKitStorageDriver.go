@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	ImageKit "github.com/imagekit-developer/imagekit-go"
+	"github.com/imagekit-developer/imagekit-go/api/uploader"
+)
+
+// imageKitStorageDriver reads its keys from IMAGEKIT_* env vars through ImageKit.New()
+type imageKitStorageDriver struct {
+}
+
+func NewImageKitStorageDriver() StorageDriver {
+	return &imageKitStorageDriver{}
+}
+
+func (d *imageKitStorageDriver) Put(file io.Reader, size int64, fileName string, contentType string) (*StoredObject, error) {
+	ik, err := ImageKit.New()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ik.Uploader.Upload(context.Background(), file, uploader.UploadParam{
+		FileName: fileName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &StoredObject{
+		Key: resp.Data.FileId,
+		Url: resp.Data.Url,
+	}, nil
+}
+
+// Get looks the file up for its url and downloads it from the ImageKit CDN
+func (d *imageKitStorageDriver) Get(key string) (io.ReadCloser, error) {
+	ik, err := ImageKit.New()
+	if err != nil {
+		return nil, err
+	}
+	file, err := ik.Media.FileById(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	response, err := storageHttpClient.Get(file.Data.Url)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("downloading %s failed with status %d", key, response.StatusCode)
+	}
+	return response.Body, nil
+}
+
+func (d *imageKitStorageDriver) Delete(key string) error {
+	ik, err := ImageKit.New()
+	if err != nil {
+		return err
+	}
+	_, err = ik.Media.DeleteFile(context.Background(), key)
+	return err
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	ImageVariantAvatar    = "avatar"
+	ImageVariantThumbnail = "thumbnail"
+	ImageVariantDisplay   = "display"
+
+	avatarVariantSize    = 64
+	thumbnailVariantSize = 400
+	displayVariantSize   = 1200
+	variantJpegQuality   = 85
+	// EXIF lives in the first APP1 segment, nothing past this is needed to find the orientation
+	exifScanBytes = 128 * 1024
+	// a few KB file can declare a huge canvas, anything bigger is refused before it is decoded
+	maxImagePixels = 40 * 1000 * 1000
+)
+
+var ErrUnsupportedMimeType = errors.New("file type is not supported")
+
+// the sniffed type has to match what the decoder finds, so renamed files are rejected
+var allowedImageMimeTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// processedVariant is one re-encoded size of an upload, ready to be stored
+type processedVariant struct {
+	Name        string
+	Data        []byte
+	Extension   string
+	ContentType string
+	Width       int
+	Height      int
+}
+
+type processedImage struct {
+	Variants []processedVariant
+	Blurhash string
+}
+
+// processImage decodes an upload, checks the real format and size from the header, applies the EXIF orientation and
+// re-encodes it into the avatar, thumbnail and display variants. Re-encoding drops every
+// metadata block of the original, including EXIF and GPS.
+func processImage(file io.ReadSeeker) (*processedImage, error) {
+	head := make([]byte, exifScanBytes)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	format, ok := allowedImageMimeTypes[http.DetectContentType(head)]
+	if !ok {
+		return nil, ErrUnsupportedMimeType
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	config, configFormat, err := image.DecodeConfig(file)
+	if err != nil || configFormat != format {
+		return nil, ErrUnsupportedMimeType
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedMimeType
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, fmt.Errorf("%w: image cannot have more than %d megapixels", ErrMediaTooLarge, maxImagePixels/1000000)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, decodedFormat, err := image.Decode(file)
+	if err != nil || decodedFormat != format {
+		return nil, ErrUnsupportedMimeType
+	}
+	if format == "jpeg" {
+		img = orientImage(img, jpegOrientation(head))
+	}
+
+	hash, err := blurhashImage(img)
+	if err != nil {
+		return nil, err
+	}
+	processed := &processedImage{Blurhash: hash}
+	variants := []struct {
+		name string
+		img  image.Image
+	}{
+		{ImageVariantAvatar, resizeSquare(img, avatarVariantSize)},
+		{ImageVariantThumbnail, resizeToFit(img, thumbnailVariantSize)},
+		{ImageVariantDisplay, resizeToFit(img, displayVariantSize)},
+	}
+	for _, variant := range variants {
+		encoded, err := encodeVariant(variant.name, variant.img)
+		if err != nil {
+			return nil, err
+		}
+		processed.Variants = append(processed.Variants, *encoded)
+	}
+	return processed, nil
+}
+
+// encodeVariant keeps png for images with transparency and uses jpeg for everything else
+func encodeVariant(name string, img image.Image) (*processedVariant, error) {
+	var buffer bytes.Buffer
+	variant := &processedVariant{
+		Name:   name,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+	if isOpaque(img) {
+		if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: variantJpegQuality}); err != nil {
+			return nil, err
+		}
+		variant.Extension = ".jpg"
+		variant.ContentType = "image/jpeg"
+	} else {
+		if err := png.Encode(&buffer, img); err != nil {
+			return nil, err
+		}
+		variant.Extension = ".png"
+		variant.ContentType = "image/png"
+	}
+	variant.Data = buffer.Bytes()
+	return variant, nil
+}
+
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
+
+// resizeToFit scales the image down so its longest side is at most size, it never scales up
+func resizeToFit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return toRGBA(img)
+	}
+	targetWidth, targetHeight := size, size
+	if width > height {
+		targetHeight = maxInt(1, height*size/width)
+	} else {
+		targetWidth = maxInt(1, width*size/height)
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+	return resized
+}
+
+// resizeSquare crops the center square and scales it to size
+func resizeSquare(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x, y, x+side, y+side)
+	target := size
+	if side < size {
+		target = side
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, target, target))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, crop, draw.Src, nil)
+	return resized
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// orientImage applies an EXIF orientation (1-8) so the pixels are stored upright
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// orientations 5 to 8 swap width and height
+	outWidth, outHeight := width, height
+	if orientation >= 5 {
+		outWidth, outHeight = height, width
+	}
+	oriented := image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			oriented.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return oriented
+}
+
+// jpegOrientation reads the orientation tag from the EXIF block of a jpeg, 1 means upright
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+		marker := data[offset+1]
+		// start of scan, no more metadata segments follow
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		segmentEnd := offset + 2 + length
+		if length < 2 || segmentEnd > len(data) {
+			return 1
+		}
+		segment := data[offset+4 : segmentEnd]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		offset = segmentEnd
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifdOffset:]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPng(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// withPngSize rewrites the IHDR chunk so the file declares another size than the pixels it holds
+func withPngSize(data []byte, width, height uint32) []byte {
+	patched := append([]byte{}, data...)
+	// 8 byte signature, 4 byte length, then "IHDR" and its 13 bytes of data
+	binary.BigEndian.PutUint32(patched[16:20], width)
+	binary.BigEndian.PutUint32(patched[20:24], height)
+	binary.BigEndian.PutUint32(patched[29:33], crc32.ChecksumIEEE(patched[12:29]))
+	return patched
+}
+
+func TestProcessImageVariants(t *testing.T) {
+	processed, err := processImage(bytes.NewReader(encodeTestPng(t, 1600, 800)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{
+		ImageVariantAvatar:    {avatarVariantSize, avatarVariantSize},
+		ImageVariantThumbnail: {thumbnailVariantSize, thumbnailVariantSize / 2},
+		ImageVariantDisplay:   {displayVariantSize, displayVariantSize / 2},
+	}
+	if len(processed.Variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(processed.Variants), len(want))
+	}
+	for _, variant := range processed.Variants {
+		size := want[variant.Name]
+		if variant.Width != size[0] || variant.Height != size[1] {
+			t.Errorf("%s is %dx%d, want %dx%d", variant.Name, variant.Width, variant.Height, size[0], size[1])
+		}
+		if variant.ContentType != "image/jpeg" {
+			t.Errorf("%s is %s, want image/jpeg for an opaque image", variant.Name, variant.ContentType)
+		}
+	}
+	if processed.Blurhash == "" {
+		t.Error("blurhash is empty")
+	}
+}
+
+func TestProcessImageRejectsDecompressionBomb(t *testing.T) {
+	bomb := withPngSize(encodeTestPng(t, 8, 8), 60000, 60000)
+	if len(bomb) > 4096 {
+		t.Fatalf("bomb is %d bytes, want a tiny file", len(bomb))
+	}
+	_, err := processImage(bytes.NewReader(bomb))
+	if !errors.Is(err, ErrMediaTooLarge) {
+		t.Fatalf("got %v, want ErrMediaTooLarge", err)
+	}
+}
+
+func TestProcessImageRejectsRenamedFiles(t *testing.T) {
+	_, err := processImage(bytes.NewReader([]byte("<html><body>not an image</body></html>")))
+	if !errors.Is(err, ErrUnsupportedMimeType) {
+		t.Fatalf("got %v, want ErrUnsupportedMimeType", err)
+	}
+}
@@ -1,35 +1,297 @@
 package service
 
 import (
-	"context"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"sync"
 
-	ImageKit "github.com/imagekit-developer/imagekit-go"
-	"github.com/imagekit-developer/imagekit-go/api/uploader"
+	"github.com/buckket/go-blurhash"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// blurhash only needs a tiny image, so large uploads are sampled down first
+	blurhashSampleSize = 32
+	blurhashXComponent = 4
+	blurhashYComponent = 3
 )
 
 type ImageUploaderService interface {
-	UploadImage(file string) (*uploader.UploadResponse, error)
+	UploadImage(file string) (*model.MediaAttachment, error)
+	UploadImageFile(file io.ReadSeeker) (*model.MediaAttachment, error)
+	UploadClipFile(file io.ReadSeeker, size int64, extension string, contentType string) (*model.MediaAttachment, error)
+	UploadMedia(uploads []MediaUpload) ([]model.MediaAttachment, error)
+	AcquireMedia(attachment model.MediaAttachment, count int) error
+	ReleaseMedia(attachment model.MediaAttachment) error
+	ReleaseImageUrl(url string) error
+	DeleteMedia(attachment model.MediaAttachment) error
 }
 
+// MediaUpload is a base64 image waiting to be uploaded with its alt text
+type MediaUpload struct {
+	ImageBase64 string
+	AltText     string
+}
+
+// Images are stored once per content hash. Every upload, post, profile and draft using one holds a reference,
+// and MediaGarbageCollectorService deletes the files once nothing refers to them any more.
 type imageUploaderService struct {
+	storageDriver         StorageDriver
+	mediaObjectRepository repository.MediaObjectRepository
 }
 
-func NewImageUploaderService() ImageUploaderService {
-	return &imageUploaderService{}
+func NewImageUploaderService(storageDriver StorageDriver, mediaObjectRepository repository.MediaObjectRepository) ImageUploaderService {
+	return &imageUploaderService{
+		storageDriver:         storageDriver,
+		mediaObjectRepository: mediaObjectRepository,
+	}
 }
 
-func (s *imageUploaderService) UploadImage(file string) (*uploader.UploadResponse, error) {
-	ik, err := ImageKit.New()
+// UploadImage runs a base64 image (plain or data uri) through the image pipeline and stores every variant
+func (s *imageUploaderService) UploadImage(file string) (*model.MediaAttachment, error) {
+	data, err := decodeBase64(file)
 	if err != nil {
 		return nil, err
 	}
+	return s.UploadImageFile(bytes.NewReader(data))
+}
+
+// UploadImageFile returns the already stored copy when the same bytes were uploaded before,
+// either way the caller holds one reference on the result
+func (s *imageUploaderService) UploadImageFile(file io.ReadSeeker) (*model.MediaAttachment, error) {
+	return s.uploadFile(file, s.storeImage)
+}
 
-	ctx := context.Background()
-	resp, err := ik.Uploader.Upload(ctx, file, uploader.UploadParam{
-		FileName: "randomname",
+// UploadClipFile stores the clip of a video or animated gif as is. Like images it is shared by content hash
+// and the caller holds one reference, so the garbage collector can delete it once nothing uses it.
+func (s *imageUploaderService) UploadClipFile(file io.ReadSeeker, size int64, extension string, contentType string) (*model.MediaAttachment, error) {
+	return s.uploadFile(file, func(file io.ReadSeeker) (*model.MediaAttachment, error) {
+		stored, err := s.storageDriver.Put(file, size, primitive.NewObjectID().Hex()+extension, contentType)
+		if err != nil {
+			return nil, err
+		}
+		return &model.MediaAttachment{Url: stored.Url, FileID: stored.Key}, nil
 	})
+}
+
+func (s *imageUploaderService) uploadFile(file io.ReadSeeker, store func(file io.ReadSeeker) (*model.MediaAttachment, error)) (*model.MediaAttachment, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	contentHash := hex.EncodeToString(hash.Sum(nil))
+	object, err := s.mediaObjectRepository.AcquireObject(contentHash)
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	if object != nil {
+		return &object.Attachment, nil
+	}
+
+	attachment, err := store(file)
+	if err != nil {
+		return nil, err
+	}
+	err = s.mediaObjectRepository.CreateObject(&model.MediaObject{ID: contentHash, Attachment: *attachment})
+	if err == nil {
+		return attachment, nil
+	}
+	s.deleteFiles(attachment.StorageKeys())
+	if err != repository.ErrMediaObjectExists {
+		return nil, err
+	}
+	// the same file was uploaded at the same time, use the copy that got saved first
+	object, err = s.mediaObjectRepository.AcquireObject(contentHash)
+	if err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, errors.New("failed to save file")
+	}
+	return &object.Attachment, nil
+}
+
+// storeImage runs the image pipeline and stores every variant
+func (s *imageUploaderService) storeImage(file io.ReadSeeker) (*model.MediaAttachment, error) {
+	processed, err := processImage(file)
+	if err != nil {
+		return nil, err
+	}
+	attachment := &model.MediaAttachment{
+		Blurhash: processed.Blurhash,
+		Type:     model.MediaTypeImage,
+		Status:   model.MediaStatusReady,
+	}
+	fileName := primitive.NewObjectID().Hex()
+	for _, variant := range processed.Variants {
+		stored, err := s.storageDriver.Put(bytes.NewReader(variant.Data), int64(len(variant.Data)), fileName+"_"+variant.Name+variant.Extension, variant.ContentType)
+		if err != nil {
+			s.deleteFiles(attachment.StorageKeys())
+			return nil, err
+		}
+		attachment.Variants = append(attachment.Variants, model.ImageVariant{
+			Name:   variant.Name,
+			Url:    stored.Url,
+			Key:    stored.Key,
+			Width:  variant.Width,
+			Height: variant.Height,
+		})
+		if variant.Name == ImageVariantDisplay {
+			attachment.Url = stored.Url
+			attachment.FileID = stored.Key
+			attachment.Width = variant.Width
+			attachment.Height = variant.Height
+		}
+	}
+	return attachment, nil
+}
+
+// AcquireMedia takes count more references on the stored images of an attachment, one per post or profile using it
+func (s *imageUploaderService) AcquireMedia(attachment model.MediaAttachment, count int) error {
+	return s.mediaObjectRepository.AcquireObjectsByKeys(attachment.StorageKeys(), count)
+}
+
+func (s *imageUploaderService) ReleaseMedia(attachment model.MediaAttachment) error {
+	return s.mediaObjectRepository.ReleaseObjectsByKeys(attachment.StorageKeys())
+}
+
+// ReleaseImageUrl is for profile and draft images, which only keep the url
+func (s *imageUploaderService) ReleaseImageUrl(url string) error {
+	return s.mediaObjectRepository.ReleaseObjectByUrl(url)
+}
+
+// DeleteMedia releases the shared images of an attachment and removes files nobody shares,
+// like files stored before they were tracked in media_object
+func (s *imageUploaderService) DeleteMedia(attachment model.MediaAttachment) error {
+	keys := attachment.StorageKeys()
+	objects, err := s.mediaObjectRepository.GetObjectsByKeys(keys)
+	if err != nil {
+		return err
+	}
+	if err := s.mediaObjectRepository.ReleaseObjectsByKeys(keys); err != nil {
+		return err
+	}
+	sharedKeys := map[string]bool{}
+	for _, object := range objects {
+		for _, key := range object.Keys {
+			sharedKeys[key] = true
+		}
+	}
+	unsharedKeys := []string{}
+	for _, key := range keys {
+		if !sharedKeys[key] {
+			unsharedKeys = append(unsharedKeys, key)
+		}
+	}
+	return s.deleteFiles(unsharedKeys)
+}
+
+// deleteFiles keeps going on errors so nothing is left behind needlessly
+func (s *imageUploaderService) deleteFiles(keys []string) error {
+	var deleteErr error
+	for _, key := range keys {
+		if err := s.storageDriver.Delete(key); err != nil {
+			fmt.Println("Error deleting stored image:", key, err)
+			deleteErr = err
+		}
+	}
+	return deleteErr
+}
+
+// UploadMedia uploads every image in parallel and keeps the order of uploads.
+// If any upload fails the ones that already succeeded are deleted again.
+func (s *imageUploaderService) UploadMedia(uploads []MediaUpload) ([]model.MediaAttachment, error) {
+	attachments := make([]model.MediaAttachment, len(uploads))
+	errs := make([]error, len(uploads))
+	var wg sync.WaitGroup
+	for i := range uploads {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			attachment, err := s.UploadImage(uploads[i].ImageBase64)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			attachment.AltText = uploads[i].AltText
+			attachments[i] = *attachment
+		}(i)
+	}
+	wg.Wait()
+
+	var uploadErr error
+	for _, err := range errs {
+		if err != nil {
+			uploadErr = err
+			break
+		}
+	}
+	if uploadErr == nil {
+		return attachments, nil
+	}
+	for _, attachment := range attachments {
+		s.DeleteMedia(attachment)
+	}
+	return nil, uploadErr
+}
+
+// blurhashImage returns the blurhash placeholder of an image
+func blurhashImage(img image.Image) (string, error) {
+	return blurhash.Encode(blurhashXComponent, blurhashYComponent, sampleImage(img, blurhashSampleSize))
+}
+
+// decodeBase64 accepts either plain base64 or a data uri
+func decodeBase64(file string) ([]byte, error) {
+	if strings.HasPrefix(file, "data:") {
+		comma := strings.Index(file, ",")
+		if comma == -1 {
+			return nil, errors.New("invalid image data")
+		}
+		file = file[comma+1:]
+	}
+	data, err := base64.StdEncoding.DecodeString(file)
+	if err != nil {
+		return nil, errors.New("invalid image data")
+	}
+	return data, nil
+}
+
+// sampleImage does a nearest neighbour resize so the longest side is at most size
+func sampleImage(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	targetWidth, targetHeight := size, size
+	if width > height {
+		targetHeight = height * size / width
+	} else {
+		targetWidth = width * size / height
+	}
+	if targetWidth < 1 {
+		targetWidth = 1
+	}
+	if targetHeight < 1 {
+		targetHeight = 1
+	}
+	sampled := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		for x := 0; x < targetWidth; x++ {
+			sampled.Set(x, y, img.At(bounds.Min.X+x*width/targetWidth, bounds.Min.Y+y*height/targetHeight))
+		}
+	}
+	return sampled
 }
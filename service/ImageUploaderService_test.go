@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+)
+
+type fakeStorageDriver struct {
+	stored  []string
+	deleted []string
+}
+
+func (d *fakeStorageDriver) Put(file io.Reader, size int64, fileName string, contentType string) (*StoredObject, error) {
+	d.stored = append(d.stored, fileName)
+	return &StoredObject{Key: fileName, Url: "/uploads/" + fileName}, nil
+}
+
+func (d *fakeStorageDriver) Get(key string) (io.ReadCloser, error) {
+	return nil, io.EOF
+}
+
+func (d *fakeStorageDriver) Delete(key string) error {
+	d.deleted = append(d.deleted, key)
+	return nil
+}
+
+// fakeMediaObjectRepository only knows the objects it is given, other methods are not used by these tests
+type fakeMediaObjectRepository struct {
+	repository.MediaObjectRepository
+	objects  []model.MediaObject
+	released []string
+}
+
+func (r *fakeMediaObjectRepository) AcquireObject(hash string) (*model.MediaObject, error) {
+	for i := range r.objects {
+		if r.objects[i].ID == hash {
+			r.objects[i].RefCount++
+			return &r.objects[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeMediaObjectRepository) CreateObject(object *model.MediaObject) error {
+	object.RefCount = 1
+	object.Keys = object.Attachment.StorageKeys()
+	r.objects = append(r.objects, *object)
+	return nil
+}
+
+func (r *fakeMediaObjectRepository) GetObjectsByKeys(keys []string) ([]model.MediaObject, error) {
+	found := []model.MediaObject{}
+	for _, object := range r.objects {
+		for _, key := range object.Keys {
+			if contains(keys, key) {
+				found = append(found, object)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+func (r *fakeMediaObjectRepository) ReleaseObjectsByKeys(keys []string) error {
+	r.released = append(r.released, keys...)
+	return nil
+}
+
+func TestDeleteMedia(t *testing.T) {
+	tests := []struct {
+		name        string
+		attachment  model.MediaAttachment
+		objects     []model.MediaObject
+		wantDeleted []string
+	}{
+		{
+			name:        "attachment from before variants only has its file",
+			attachment:  model.MediaAttachment{Url: "https://ik.imagekit.io/old.jpg", FileID: "old-file-id"},
+			wantDeleted: []string{"old-file-id"},
+		},
+		{
+			name: "unshared variants are all deleted",
+			attachment: model.MediaAttachment{FileID: "a_display.jpg", Variants: []model.ImageVariant{
+				{Name: ImageVariantAvatar, Key: "a_avatar.jpg"},
+				{Name: ImageVariantThumbnail, Key: "a_thumbnail.jpg"},
+				{Name: ImageVariantDisplay, Key: "a_display.jpg"},
+			}},
+			wantDeleted: []string{"a_avatar.jpg", "a_display.jpg", "a_thumbnail.jpg"},
+		},
+		{
+			name: "files of a shared object are left to the garbage collector",
+			attachment: model.MediaAttachment{FileID: "b_display.jpg", Variants: []model.ImageVariant{
+				{Name: ImageVariantAvatar, Key: "b_avatar.jpg"},
+				{Name: ImageVariantDisplay, Key: "b_display.jpg"},
+			}},
+			objects:     []model.MediaObject{{ID: "hash", Keys: []string{"b_avatar.jpg", "b_display.jpg"}}},
+			wantDeleted: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := &fakeStorageDriver{deleted: []string{}}
+			objects := &fakeMediaObjectRepository{objects: test.objects}
+			uploader := NewImageUploaderService(storage, objects)
+			if err := uploader.DeleteMedia(test.attachment); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(storage.deleted)
+			if !reflect.DeepEqual(storage.deleted, test.wantDeleted) {
+				t.Errorf("deleted %v, want %v", storage.deleted, test.wantDeleted)
+			}
+			if !reflect.DeepEqual(objects.released, test.attachment.StorageKeys()) {
+				t.Errorf("released %v, want %v", objects.released, test.attachment.StorageKeys())
+			}
+		})
+	}
+}
+
+func TestUploadClipFile(t *testing.T) {
+	storage := &fakeStorageDriver{}
+	objects := &fakeMediaObjectRepository{}
+	uploader := NewImageUploaderService(storage, objects)
+
+	clip, err := uploader.UploadClipFile(bytes.NewReader([]byte("video bytes")), 11, ".mp4", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(storage.stored) != 1 || clip.FileID != storage.stored[0] || clip.Url != "/uploads/"+storage.stored[0] {
+		t.Fatalf("got clip %+v, stored %v", clip, storage.stored)
+	}
+	if len(objects.objects) != 1 || !reflect.DeepEqual(objects.objects[0].Keys, []string{clip.FileID}) || objects.objects[0].RefCount != 1 {
+		t.Fatalf("clip is not tracked as a media object: %+v", objects.objects)
+	}
+
+	again, err := uploader.UploadClipFile(bytes.NewReader([]byte("video bytes")), 11, ".mp4", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.FileID != clip.FileID || len(storage.stored) != 1 {
+		t.Errorf("same clip was stored twice: %v", storage.stored)
+	}
+	if objects.objects[0].RefCount != 2 {
+		t.Errorf("got refCount %d, want 2", objects.objects[0].RefCount)
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/dto"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"golang.org/x/sync/singleflight"
+)
+
+// trackingParams are dropped from links so the same page shared from different places hits one cache entry
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+}
+
+// LinkPreviewService serves link previews from the link_preview collection and only fetches on a miss.
+// A stale hit is returned straight away and refreshed in the background, and concurrent fetches of
+// one link share a single request.
+type LinkPreviewService interface {
+	GetLinkPreview(targetUrl string) (*dto.Metadata, error)
+}
+
+type linkPreviewService struct {
+	linkPreviewRepository repository.LinkPreviewRepository
+	metadataFetcher       MetadataFetcher
+	ttl                   time.Duration
+	refreshAfter          time.Duration
+	negativeTtl           time.Duration
+	now                   func() time.Time
+	fetches               singleflight.Group
+}
+
+func NewLinkPreviewService(envConfig *config.EnvConfig, linkPreviewRepository repository.LinkPreviewRepository, metadataFetcher MetadataFetcher) LinkPreviewService {
+	return &linkPreviewService{
+		linkPreviewRepository: linkPreviewRepository,
+		metadataFetcher:       metadataFetcher,
+		ttl:                   time.Duration(envConfig.MetadataCacheTtlHours) * time.Hour,
+		refreshAfter:          time.Duration(envConfig.MetadataCacheRefreshMinutes) * time.Minute,
+		negativeTtl:           time.Duration(envConfig.MetadataCacheNegativeSeconds) * time.Second,
+		now:                   time.Now,
+	}
+}
+
+func (s *linkPreviewService) GetLinkPreview(targetUrl string) (*dto.Metadata, error) {
+	canonicalUrl, err := canonicalizeUrl(targetUrl)
+	if err != nil {
+		return nil, err
+	}
+	// the cache only saves work, previews still load while it is unavailable
+	preview, _ := s.linkPreviewRepository.FindLinkPreview(canonicalUrl)
+	now := s.now()
+	if preview != nil && preview.ExpiresDatetime.After(now) {
+		if preview.Error == "" && !preview.RefreshDatetime.After(now) {
+			s.fetches.DoChan(canonicalUrl, func() (interface{}, error) {
+				return s.refresh(preview), nil
+			})
+		}
+		return linkPreviewResult(preview)
+	}
+
+	result, _, _ := s.fetches.Do(canonicalUrl, func() (interface{}, error) {
+		return s.fetch(canonicalUrl), nil
+	})
+	return linkPreviewResult(result.(*model.LinkPreview))
+}
+
+// fetch always returns a preview to cache, a failed fetch becomes a short lived negative entry
+func (s *linkPreviewService) fetch(canonicalUrl string) *model.LinkPreview {
+	now := s.now()
+	refreshDatetime := now.Add(s.refreshAfter)
+	expiresDatetime := now.Add(s.ttl)
+	preview := &model.LinkPreview{
+		ID:              canonicalUrl,
+		FetchedDatetime: &now,
+		RefreshDatetime: &refreshDatetime,
+		ExpiresDatetime: &expiresDatetime,
+	}
+	metadata, err := s.metadataFetcher.Fetch(canonicalUrl)
+	if err != nil {
+		expiresDatetime = now.Add(s.negativeTtl)
+		preview.Error = err.Error()
+		preview.RefreshDatetime = &expiresDatetime
+	} else {
+		preview.OgTitle = metadata.OgTitle
+		preview.OgDescription = metadata.OgDescription
+		preview.Domain = metadata.Domain
+		preview.FullURL = metadata.FullURL
+		preview.Image = metadata.Image
+	}
+	s.linkPreviewRepository.SaveLinkPreview(preview)
+	return preview
+}
+
+// refresh keeps serving the old preview when the link fails for now, it is tried again after the negative ttl
+func (s *linkPreviewService) refresh(stale *model.LinkPreview) *model.LinkPreview {
+	metadata, err := s.metadataFetcher.Fetch(stale.ID)
+	if err != nil {
+		retryDatetime := s.now().Add(s.negativeTtl)
+		stale.RefreshDatetime = &retryDatetime
+		s.linkPreviewRepository.SaveLinkPreview(stale)
+		return stale
+	}
+	now := s.now()
+	refreshDatetime := now.Add(s.refreshAfter)
+	expiresDatetime := now.Add(s.ttl)
+	preview := &model.LinkPreview{
+		ID:              stale.ID,
+		OgTitle:         metadata.OgTitle,
+		OgDescription:   metadata.OgDescription,
+		Domain:          metadata.Domain,
+		FullURL:         metadata.FullURL,
+		Image:           metadata.Image,
+		FetchedDatetime: &now,
+		RefreshDatetime: &refreshDatetime,
+		ExpiresDatetime: &expiresDatetime,
+	}
+	s.linkPreviewRepository.SaveLinkPreview(preview)
+	return preview
+}
+
+func linkPreviewResult(preview *model.LinkPreview) (*dto.Metadata, error) {
+	if preview.Error != "" {
+		return nil, linkPreviewError(preview.Error)
+	}
+	return &dto.Metadata{
+		OgTitle:       preview.OgTitle,
+		OgDescription: preview.OgDescription,
+		Domain:        preview.Domain,
+		FullURL:       preview.FullURL,
+		Image:         preview.Image,
+	}, nil
+}
+
+// linkPreviewError turns a cached message back into the error it came from so handlers can still tell them apart
+func linkPreviewError(message string) error {
+	for _, err := range []error{ErrInvalidMetadataUrl, ErrBlockedUrl, ErrNotAWebPage} {
+		if err.Error() == message {
+			return err
+		}
+	}
+	return errors.New(message)
+}
+
+// canonicalizeUrl lowercases the scheme and host, drops default ports, fragments and tracking
+// parameters and sorts the query so equivalent links share one cache entry
+func canonicalizeUrl(targetUrl string) (string, error) {
+	parsedUrl, err := url.Parse(strings.TrimSpace(targetUrl))
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Hostname() == "" {
+		return "", ErrInvalidMetadataUrl
+	}
+	parsedUrl.Scheme = strings.ToLower(parsedUrl.Scheme)
+	host := strings.ToLower(parsedUrl.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	port := parsedUrl.Port()
+	if (parsedUrl.Scheme == "http" && port == "80") || (parsedUrl.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsedUrl.Host = host
+	parsedUrl.Fragment = ""
+	parsedUrl.RawFragment = ""
+	if parsedUrl.Path == "" {
+		parsedUrl.Path = "/"
+	}
+	query := parsedUrl.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	// Encode sorts by key
+	parsedUrl.RawQuery = query.Encode()
+	return parsedUrl.String(), nil
+}
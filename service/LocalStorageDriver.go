@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localStorageDriver keeps files on disk, main serves the directory as a static route
+type localStorageDriver struct {
+	dir     string
+	baseUrl string
+}
+
+func NewLocalStorageDriver(dir string, baseUrl string) (StorageDriver, error) {
+	if _, err := LocalStorageRoute(baseUrl); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &localStorageDriver{
+		dir:     dir,
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+	}, nil
+}
+
+func (d *localStorageDriver) Put(file io.Reader, size int64, fileName string, contentType string) (*StoredObject, error) {
+	path, err := d.path(fileName)
+	if err != nil {
+		return nil, err
+	}
+	// write next to the target and rename so a half written file is never served
+	tempFile, err := os.CreateTemp(d.dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := io.Copy(tempFile, file); err != nil {
+		tempFile.Close()
+		return nil, err
+	}
+	if err := tempFile.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return nil, err
+	}
+	return &StoredObject{
+		Key: fileName,
+		Url: d.baseUrl + "/" + fileName,
+	}, nil
+}
+
+func (d *localStorageDriver) Get(key string) (io.ReadCloser, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (d *localStorageDriver) Delete(key string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (d *localStorageDriver) path(fileName string) (string, error) {
+	if fileName == "" || fileName != filepath.Base(fileName) || strings.HasPrefix(fileName, ".") {
+		return "", errors.New("invalid file name")
+	}
+	return filepath.Join(d.dir, fileName), nil
+}
+
+// LocalStorageRoute is the path the files are served on, the path of LOCAL_STORAGE_BASE_URL.
+// The base url may point at another host, like a proxy in front of the service, as long as the path is kept.
+func LocalStorageRoute(baseUrl string) (string, error) {
+	parsed, err := url.Parse(baseUrl)
+	if err != nil {
+		return "", err
+	}
+	route := strings.TrimSuffix(parsed.Path, "/")
+	if route == "" {
+		return "", errors.New("LOCAL_STORAGE_BASE_URL needs a path like /uploads so files don't shadow the api")
+	}
+	return route, nil
+}
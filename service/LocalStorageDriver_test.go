@@ -0,0 +1,30 @@
+package service
+
+import "testing"
+
+func TestLocalStorageRoute(t *testing.T) {
+	tests := []struct {
+		baseUrl string
+		want    string
+		wantErr bool
+	}{
+		{baseUrl: "/uploads", want: "/uploads"},
+		{baseUrl: "/static/media/", want: "/static/media"},
+		{baseUrl: "https://cdn.example.com/media", want: "/media"},
+		{baseUrl: "https://cdn.example.com", wantErr: true},
+		{baseUrl: "/", wantErr: true},
+		{baseUrl: "", wantErr: true},
+	}
+	for _, test := range tests {
+		route, err := LocalStorageRoute(test.baseUrl)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("LocalStorageRoute(%q) = %q, want an error", test.baseUrl, route)
+			}
+			continue
+		}
+		if err != nil || route != test.want {
+			t.Errorf("LocalStorageRoute(%q) = %q, %v, want %q", test.baseUrl, route, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	mediaGarbageCollectorLockName  = "media_garbage_collector"
+	mediaGarbageCollectorBatchSize = 100
+)
+
+// MediaGarbageCollectorService expires uploads that were never used and deletes stored files nothing refers to.
+// Like the post scheduler only the replica holding the Mongo lock does the work.
+type MediaGarbageCollectorService interface {
+	Start()
+	CollectGarbage() error
+}
+
+type mediaGarbageCollectorService struct {
+	envConfig             *config.EnvConfig
+	mediaRepository       repository.MediaRepository
+	mediaObjectRepository repository.MediaObjectRepository
+	lockRepository        repository.LockRepository
+	imageUploaderService  ImageUploaderService
+	storageDriver         StorageDriver
+	instanceID            string
+}
+
+func NewMediaGarbageCollectorService(envConfig *config.EnvConfig, mediaRepository repository.MediaRepository, mediaObjectRepository repository.MediaObjectRepository, lockRepository repository.LockRepository, imageUploaderService ImageUploaderService, storageDriver StorageDriver) MediaGarbageCollectorService {
+	return &mediaGarbageCollectorService{
+		envConfig:             envConfig,
+		mediaRepository:       mediaRepository,
+		mediaObjectRepository: mediaObjectRepository,
+		lockRepository:        lockRepository,
+		imageUploaderService:  imageUploaderService,
+		storageDriver:         storageDriver,
+		instanceID:            primitive.NewObjectID().Hex(),
+	}
+}
+
+func (s *mediaGarbageCollectorService) Start() {
+	interval := time.Duration(s.envConfig.MediaGcIntervalMinutes) * time.Minute
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			isLeader, err := s.lockRepository.AcquireLock(mediaGarbageCollectorLockName, s.instanceID, interval*3)
+			if err != nil {
+				fmt.Println("Error acquiring media garbage collector lock:", err)
+				continue
+			}
+			if !isLeader {
+				continue
+			}
+			if err := s.CollectGarbage(); err != nil {
+				fmt.Println("Error collecting media garbage:", err)
+			}
+		}
+	}()
+}
+
+func (s *mediaGarbageCollectorService) CollectGarbage() error {
+	cutoff := time.Now().Add(-time.Duration(s.envConfig.MediaGcGraceHours) * time.Hour)
+	if err := s.expireUploads(cutoff); err != nil {
+		return err
+	}
+	return s.deleteOrphanedObjects(cutoff)
+}
+
+// expireUploads drops the reference an upload holds, posts and profiles using it hold their own
+func (s *mediaGarbageCollectorService) expireUploads(cutoff time.Time) error {
+	for {
+		expired, err := s.mediaRepository.GetExpiredMedia(cutoff, mediaGarbageCollectorBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, media := range expired {
+			// releasing twice after a failed delete only undercounts, which the reference check covers
+			if err := s.imageUploaderService.ReleaseMedia(media.Attachment("")); err != nil {
+				return err
+			}
+			if err := s.mediaRepository.DeleteMedia(media.ID.Hex()); err != nil {
+				return err
+			}
+		}
+		if len(expired) < mediaGarbageCollectorBatchSize {
+			return nil
+		}
+	}
+}
+
+// deleteOrphanedObjects only trusts a zero count after checking nothing still points at the files,
+// an object found in use gets its count back instead
+func (s *mediaGarbageCollectorService) deleteOrphanedObjects(cutoff time.Time) error {
+	for {
+		objects, err := s.mediaObjectRepository.GetOrphanedObjects(cutoff, mediaGarbageCollectorBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			if err := s.deleteOrphanedObject(&object); err != nil {
+				return err
+			}
+		}
+		if len(objects) < mediaGarbageCollectorBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *mediaGarbageCollectorService) deleteOrphanedObject(object *model.MediaObject) error {
+	isReferenced, err := s.mediaObjectRepository.IsObjectReferenced(object)
+	if err != nil {
+		return err
+	}
+	if isReferenced {
+		fmt.Println("Media object is referenced but has no count, keeping it:", object.ID)
+		_, err := s.mediaObjectRepository.AcquireObject(object.ID)
+		return err
+	}
+	isDeleted, err := s.mediaObjectRepository.DeleteOrphanedObject(object.ID)
+	if err != nil || !isDeleted {
+		return err
+	}
+	for _, key := range object.Keys {
+		if err := s.storageDriver.Delete(key); err != nil {
+			fmt.Println("Error deleting stored media:", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+)
+
+const (
+	// a claimed media is retried by any replica once its lease runs out
+	mediaProcessingLease       = 10 * time.Minute
+	maxMediaProcessingAttempts = 3
+	// posts created while their media was finishing can miss the update, the sweep catches them
+	staleProcessingPostAge   = time.Minute
+	staleProcessingPostBatch = 100
+)
+
+// MediaProcessingService validates videos and gifs uploaded through POST /media in the background,
+// then moves them and the posts using them from PROCESSING to READY (or FAILED)
+type MediaProcessingService interface {
+	Start()
+	Enqueue()
+	ProcessNext() (bool, error)
+}
+
+type mediaProcessingService struct {
+	envConfig            *config.EnvConfig
+	mediaRepository      repository.MediaRepository
+	contentRepository    repository.ContentRepository
+	storageDriver        StorageDriver
+	imageUploaderService ImageUploaderService
+	notificationService  NotificationService
+	queued               chan struct{}
+}
+
+func NewMediaProcessingService(envConfig *config.EnvConfig, mediaRepository repository.MediaRepository, contentRepository repository.ContentRepository, storageDriver StorageDriver, imageUploaderService ImageUploaderService, notificationService NotificationService) MediaProcessingService {
+	return &mediaProcessingService{
+		envConfig:            envConfig,
+		mediaRepository:      mediaRepository,
+		contentRepository:    contentRepository,
+		storageDriver:        storageDriver,
+		imageUploaderService: imageUploaderService,
+		notificationService:  notificationService,
+		queued:               make(chan struct{}, 1),
+	}
+}
+
+// Start polls for work on an interval, Enqueue wakes the worker up straight away
+func (s *mediaProcessingService) Start() {
+	interval := time.Duration(s.envConfig.MediaWorkerIntervalSeconds) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.queued:
+			}
+			if err := s.reconcileStalePosts(); err != nil {
+				fmt.Println("Error reconciling processing posts:", err)
+			}
+			for {
+				processed, err := s.ProcessNext()
+				if err != nil {
+					fmt.Println("Error processing media:", err)
+				}
+				if !processed {
+					break
+				}
+			}
+		}
+	}()
+}
+
+func (s *mediaProcessingService) Enqueue() {
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// ProcessNext claims and processes one media, it returns false when nothing was waiting
+func (s *mediaProcessingService) ProcessNext() (bool, error) {
+	media, err := s.mediaRepository.ClaimProcessingMedia(time.Now(), mediaProcessingLease)
+	if err != nil || media == nil {
+		return false, err
+	}
+
+	err = s.processMedia(media)
+	if err == nil {
+		return true, s.finishMedia(media)
+	}
+	var rejected *mediaRejectedError
+	if !errors.As(err, &rejected) && media.Attempts < maxMediaProcessingAttempts {
+		// keep the claim, the media is retried when the lease runs out
+		return true, err
+	}
+	fmt.Println("Media failed processing:", media.ID.Hex(), err)
+	if err := s.mediaRepository.FailMedia(media.ID.Hex(), err.Error()); err != nil {
+		return true, err
+	}
+	media.Status = model.MediaStatusFailed
+	s.deleteOriginal(media)
+	return true, s.updatePosts(media)
+}
+
+func (s *mediaProcessingService) processMedia(media *model.Media) error {
+	workDir, err := os.MkdirTemp("", "media-processing-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	originalPath := filepath.Join(workDir, "original")
+	if err := s.downloadOriginal(media.OriginalKey, originalPath); err != nil {
+		return err
+	}
+	if media.Type == model.MediaTypeGif {
+		return s.processGif(media, originalPath)
+	}
+	return s.processVideo(media, workDir, originalPath)
+}
+
+func (s *mediaProcessingService) processVideo(media *model.Media, workDir string, originalPath string) error {
+	probe, err := probeVideo(s.envConfig.FfprobePath, originalPath)
+	if err != nil {
+		return err
+	}
+	info, err := validateVideo(probe, float64(s.envConfig.MediaMaxVideoSeconds))
+	if err != nil {
+		return err
+	}
+	videoPath := filepath.Join(workDir, "video"+info.Extension)
+	if err := remuxVideo(s.envConfig.FfmpegPath, originalPath, videoPath, info); err != nil {
+		return err
+	}
+	posterPath := filepath.Join(workDir, "poster.png")
+	if err := extractPosterFrame(s.envConfig.FfmpegPath, videoPath, posterPath, info.Duration); err != nil {
+		return err
+	}
+
+	posterFile, err := os.Open(posterPath)
+	if err != nil {
+		return err
+	}
+	defer posterFile.Close()
+	poster, err := s.imageUploaderService.UploadImageFile(posterFile)
+	if err != nil {
+		return err
+	}
+	videoFile, err := os.Open(videoPath)
+	if err != nil {
+		s.imageUploaderService.DeleteMedia(*poster)
+		return err
+	}
+	defer videoFile.Close()
+	stat, err := videoFile.Stat()
+	if err != nil {
+		s.imageUploaderService.DeleteMedia(*poster)
+		return err
+	}
+	clip, err := s.imageUploaderService.UploadClipFile(videoFile, stat.Size(), info.Extension, info.ContentType)
+	if err != nil {
+		s.imageUploaderService.DeleteMedia(*poster)
+		return err
+	}
+
+	media.Url = clip.Url
+	media.FileID = clip.FileID
+	media.Width = info.Width
+	media.Height = info.Height
+	media.Duration = info.Duration
+	media.PosterUrl = poster.Url
+	media.Blurhash = poster.Blurhash
+	media.Variants = poster.Variants
+	return nil
+}
+
+// processGif keeps animated gifs as gifs, a single frame gif is handled like any other image
+func (s *mediaProcessingService) processGif(media *model.Media, originalPath string) error {
+	file, err := os.Open(originalPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	animated, err := decodeAnimatedGif(file, float64(s.envConfig.MediaMaxVideoSeconds))
+	if err != nil {
+		return err
+	}
+
+	if animated.Frames == 1 {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		attachment, err := s.imageUploaderService.UploadImageFile(file)
+		if err != nil {
+			return err
+		}
+		media.Type = model.MediaTypeImage
+		media.Url = attachment.Url
+		media.FileID = attachment.FileID
+		media.Width = attachment.Width
+		media.Height = attachment.Height
+		media.Blurhash = attachment.Blurhash
+		media.Variants = attachment.Variants
+		return nil
+	}
+
+	var posterData bytes.Buffer
+	if err := png.Encode(&posterData, animated.Poster); err != nil {
+		return err
+	}
+	poster, err := s.imageUploaderService.UploadImageFile(bytes.NewReader(posterData.Bytes()))
+	if err != nil {
+		return err
+	}
+	clip, err := s.imageUploaderService.UploadClipFile(bytes.NewReader(animated.Data), int64(len(animated.Data)), ".gif", "image/gif")
+	if err != nil {
+		s.imageUploaderService.DeleteMedia(*poster)
+		return err
+	}
+	media.Url = clip.Url
+	media.FileID = clip.FileID
+	media.Width = animated.Width
+	media.Height = animated.Height
+	media.Duration = animated.Duration
+	media.PosterUrl = poster.Url
+	media.Blurhash = poster.Blurhash
+	media.Variants = poster.Variants
+	return nil
+}
+
+func (s *mediaProcessingService) downloadOriginal(key string, path string) error {
+	reader, err := s.storageDriver.Get(key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+func (s *mediaProcessingService) finishMedia(media *model.Media) error {
+	if err := s.mediaRepository.CompleteMedia(media); err != nil {
+		return err
+	}
+	s.deleteOriginal(media)
+	return s.updatePosts(media)
+}
+
+func (s *mediaProcessingService) deleteOriginal(media *model.Media) {
+	if err := s.storageDriver.Delete(media.OriginalKey); err != nil {
+		fmt.Println("Error deleting original upload:", media.OriginalKey, err)
+	}
+}
+
+// updatePosts copies the result onto posts using the media and releases the ones whose media are all done
+func (s *mediaProcessingService) updatePosts(media *model.Media) error {
+	attachment := media.Attachment("")
+	updatedPosts, err := s.contentRepository.UpdatePostMedia(media.ID.Hex(), attachment)
+	if err != nil {
+		return err
+	}
+	if err := s.imageUploaderService.AcquireMedia(attachment, int(updatedPosts)); err != nil {
+		return err
+	}
+	posts, err := s.contentRepository.GetProcessingPostsByMediaID(media.ID.Hex())
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err := s.finishPost(post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mediaProcessingService) finishPost(post model.Post) error {
+	mediaStatus := postMediaStatus(post.Media)
+	if mediaStatus == model.MediaStatusProcessing {
+		return nil
+	}
+	isUpdated, err := s.contentRepository.FinishPostMediaProcessing(post.ID.Hex(), mediaStatus)
+	if err != nil {
+		return err
+	}
+	// scheduled posts notify when the scheduler publishes them
+	if isUpdated && mediaStatus == model.MediaStatusReady && !post.IsPending() {
+		if err := s.notificationService.NotifyMentions(post.UserID, post.ID.Hex(), "", post.MentionedUserIDs); err != nil {
+			fmt.Println("Error notifying mentions:", err)
+		}
+	}
+	return nil
+}
+
+// reconcileStalePosts re-applies finished media to posts that have been processing for a while
+func (s *mediaProcessingService) reconcileStalePosts() error {
+	posts, err := s.contentRepository.GetStaleProcessingPosts(time.Now().Add(-staleProcessingPostAge), staleProcessingPostBatch)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		for _, attachment := range post.Media {
+			if attachment.MediaID == "" || attachment.Status != model.MediaStatusProcessing {
+				continue
+			}
+			media, err := s.mediaRepository.FindMedia(attachment.MediaID)
+			if err != nil {
+				return err
+			}
+			if media.Status == model.MediaStatusProcessing {
+				continue
+			}
+			if err := s.updatePosts(media); err != nil {
+				return err
+			}
+		}
+		// the media may all be done already with only the post status left behind
+		if err := s.finishPost(post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postMediaStatus is FAILED if any attachment failed, PROCESSING while any is processing, READY otherwise
+func postMediaStatus(media []model.MediaAttachment) string {
+	status := model.MediaStatusReady
+	for _, attachment := range media {
+		if attachment.Status == model.MediaStatusFailed {
+			return model.MediaStatusFailed
+		}
+		if attachment.Status == model.MediaStatusProcessing {
+			status = model.MediaStatusProcessing
+		}
+	}
+	return status
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrMediaTooLarge = errors.New("file is too large")
+
+type MediaService interface {
+	UploadMedia(userID string, file io.Reader) (*model.Media, error)
+	GetUserMedia(userID string, mediaIDs []string) ([]model.Media, error)
+	FindUserMedia(userID string, mediaID string) (*model.Media, error)
+}
+
+// videos and gifs are stored as they are uploaded and processed later by MediaProcessingService
+var processedInBackgroundMimeTypes = map[string]string{
+	"image/gif":  model.MediaTypeGif,
+	"video/mp4":  model.MediaTypeVideo,
+	"video/webm": model.MediaTypeVideo,
+}
+
+type mediaService struct {
+	envConfig              *config.EnvConfig
+	mediaRepository        repository.MediaRepository
+	imageUploaderService   ImageUploaderService
+	storageDriver          StorageDriver
+	mediaProcessingService MediaProcessingService
+}
+
+func NewMediaService(envConfig *config.EnvConfig, mediaRepository repository.MediaRepository, imageUploaderService ImageUploaderService, storageDriver StorageDriver, mediaProcessingService MediaProcessingService) MediaService {
+	return &mediaService{
+		envConfig:              envConfig,
+		mediaRepository:        mediaRepository,
+		imageUploaderService:   imageUploaderService,
+		storageDriver:          storageDriver,
+		mediaProcessingService: mediaProcessingService,
+	}
+}
+
+// UploadMedia sniffs the file type from its first bytes, then spools it to a temp file
+// capped at the configured size so the request body is never held in memory
+func (s *mediaService) UploadMedia(userID string, file io.Reader) (*model.Media, error) {
+	reader := bufio.NewReaderSize(file, 512)
+	head, err := reader.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	mimeType := http.DetectContentType(head)
+	mediaType, isBackground := processedInBackgroundMimeTypes[mimeType]
+	if _, ok := allowedImageMimeTypes[mimeType]; !ok && !isBackground {
+		return nil, ErrUnsupportedMimeType
+	}
+
+	tempFile, err := os.CreateTemp("", "media-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	maxBytes := s.envConfig.MediaMaxUploadBytes
+	if isBackground {
+		maxBytes = s.envConfig.MediaMaxVideoBytes
+	}
+	size, err := io.Copy(tempFile, io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBytes {
+		return nil, ErrMediaTooLarge
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if isBackground {
+		return s.queueMedia(userID, tempFile, size, mimeType, mediaType)
+	}
+	attachment, err := s.imageUploaderService.UploadImageFile(tempFile)
+	if err != nil {
+		return nil, err
+	}
+	media := &model.Media{
+		UserID:   userID,
+		Url:      attachment.Url,
+		FileID:   attachment.FileID,
+		MimeType: mimeType,
+		Size:     size,
+		Width:    attachment.Width,
+		Height:   attachment.Height,
+		Blurhash: attachment.Blurhash,
+		Variants: attachment.Variants,
+		Type:     model.MediaTypeImage,
+		Status:   model.MediaStatusReady,
+	}
+	_, err = s.mediaRepository.CreateMedia(media)
+	if err != nil {
+		s.imageUploaderService.DeleteMedia(*attachment)
+		return nil, err
+	}
+	return media, nil
+}
+
+// queueMedia keeps the untouched upload in storage so any replica's worker can pick it up
+func (s *mediaService) queueMedia(userID string, file io.Reader, size int64, mimeType string, mediaType string) (*model.Media, error) {
+	stored, err := s.storageDriver.Put(file, size, primitive.NewObjectID().Hex()+"_original", mimeType)
+	if err != nil {
+		return nil, err
+	}
+	media := &model.Media{
+		UserID:      userID,
+		MimeType:    mimeType,
+		Size:        size,
+		Type:        mediaType,
+		Status:      model.MediaStatusProcessing,
+		OriginalKey: stored.Key,
+	}
+	_, err = s.mediaRepository.CreateMedia(media)
+	if err != nil {
+		if err := s.storageDriver.Delete(stored.Key); err != nil {
+			fmt.Println("Error deleting original upload:", stored.Key, err)
+		}
+		return nil, err
+	}
+	s.mediaProcessingService.Enqueue()
+	return media, nil
+}
+
+func (s *mediaService) FindUserMedia(userID string, mediaID string) (*model.Media, error) {
+	media, err := s.mediaRepository.GetUserMedia(userID, []string{mediaID})
+	if err != nil {
+		return nil, err
+	}
+	return &media[0], nil
+}
+
+func (s *mediaService) GetUserMedia(userID string, mediaIDs []string) ([]model.Media, error) {
+	if len(mediaIDs) == 0 {
+		return []model.Media{}, nil
+	}
+	return s.mediaRepository.GetUserMedia(userID, mediaIDs)
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/dto"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const metadataUserAgent = "SneakfeedBot/1.0 (+link preview)"
+
+var (
+	ErrInvalidMetadataUrl = errors.New("url must be an absolute http or https link")
+	ErrNotAWebPage        = errors.New("link is not a web page")
+)
+
+// MetadataFetcher builds link previews from OpenGraph, Twitter Card and plain html tags
+type MetadataFetcher interface {
+	Fetch(targetUrl string) (*dto.Metadata, error)
+}
+
+type metadataFetcher struct {
+	client    *http.Client
+	urlPolicy UrlPolicy
+	timeout   time.Duration
+	maxBytes  int64
+}
+
+// NewMetadataFetcher fetches pages in process, or goes through the external metadata service
+// when METADATA_SERVICE_ENDPOINT_URL is set
+func NewMetadataFetcher(envConfig *config.EnvConfig, urlPolicy UrlPolicy) MetadataFetcher {
+	if envConfig.MetadataEndpoint != "" {
+		return newMetadataProxyFetcher(envConfig, urlPolicy)
+	}
+	maxRedirects := envConfig.MetadataMaxRedirects
+	// no proxy, every connection has to go through the policy's dial check
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = newMetadataDialer(urlPolicy).DialContext
+	return &metadataFetcher{
+		client: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				return urlPolicy.CheckUrl(req.URL)
+			},
+		},
+		urlPolicy: urlPolicy,
+		timeout:   time.Duration(envConfig.MetadataTimeoutSeconds) * time.Second,
+		maxBytes:  envConfig.MetadataMaxBytes,
+	}
+}
+
+// newMetadataDialer checks the address of every connection after DNS, so a name resolving
+// to an internal address is refused even if it resolved to a public one before
+func newMetadataDialer(urlPolicy UrlPolicy) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   urlPolicy.DialControl,
+	}
+}
+
+// Fetch downloads at most maxBytes of the page within the timeout, redirects included.
+// The link and every redirect have to pass the url policy.
+func (f *metadataFetcher) Fetch(targetUrl string) (*dto.Metadata, error) {
+	parsedUrl, err := parseMetadataUrl(f.urlPolicy, targetUrl)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsedUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", metadataUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.5")
+	resp, err := f.client.Do(req)
+	if errors.Is(err, ErrBlockedUrl) || errors.Is(err, ErrInvalidMetadataUrl) {
+		// a redirect or dns answer was refused, the wrapped dial error would only leak internal addresses
+		return nil, ErrBlockedUrl
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		return nil, fmt.Errorf("link responded with status %d", resp.StatusCode)
+	}
+
+	// the url after redirects is what relative image links resolve against
+	finalUrl := resp.Request.URL
+	metadata := &dto.Metadata{
+		Domain:  finalUrl.Hostname(),
+		FullURL: finalUrl.String(),
+	}
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "image/") {
+		metadata.Image = finalUrl.String()
+		return metadata, nil
+	}
+	if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotAWebPage
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.maxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := readMetadataTags(body)
+	if err != nil {
+		return nil, err
+	}
+	fillMetadata(metadata, tags, finalUrl)
+	return metadata, nil
+}
+
+func parseMetadataUrl(urlPolicy UrlPolicy, targetUrl string) (*url.URL, error) {
+	parsedUrl, err := url.Parse(strings.TrimSpace(targetUrl))
+	if err != nil {
+		return nil, ErrInvalidMetadataUrl
+	}
+	if err := urlPolicy.CheckUrl(parsedUrl); err != nil {
+		return nil, err
+	}
+	return parsedUrl, nil
+}
+
+// metadataTags holds the head tags a preview is built from, keyed by meta property or name
+type metadataTags struct {
+	title string
+	meta  map[string]string
+}
+
+// readMetadataTags tokenizes the page until the head ends, a page cut off by the size cap still yields what was read
+func readMetadataTags(body io.Reader) (*metadataTags, error) {
+	tags := &metadataTags{meta: map[string]string{}}
+	tokenizer := html.NewTokenizer(body)
+	inTitle := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return nil, err
+			}
+			return tags, nil
+		case html.TextToken:
+			if inTitle && tags.title == "" {
+				tags.title = string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return tags, nil
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "meta":
+				if hasAttr {
+					readMetaTag(tokenizer, tags)
+				}
+			case "body":
+				return tags, nil
+			}
+		}
+	}
+}
+
+// readMetaTag keeps the first value of each key, OpenGraph uses property and everything else uses name
+func readMetaTag(tokenizer *html.Tokenizer, tags *metadataTags) {
+	var key, content string
+	for {
+		attrName, attrValue, more := tokenizer.TagAttr()
+		switch string(attrName) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(attrValue)))
+			}
+		case "content":
+			content = string(attrValue)
+		}
+		if !more {
+			break
+		}
+	}
+	content = collapseWhitespace(content)
+	if key == "" || content == "" {
+		return
+	}
+	if _, ok := tags.meta[key]; !ok {
+		tags.meta[key] = content
+	}
+}
+
+// fillMetadata prefers OpenGraph, then Twitter Card, then the plain title and description
+func fillMetadata(metadata *dto.Metadata, tags *metadataTags, pageUrl *url.URL) {
+	metadata.OgTitle = firstMetadataValue(tags.meta, "og:title", "twitter:title")
+	if metadata.OgTitle == "" {
+		metadata.OgTitle = collapseWhitespace(tags.title)
+	}
+	metadata.OgDescription = firstMetadataValue(tags.meta, "og:description", "twitter:description", "description")
+	image := firstMetadataValue(tags.meta, "og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src")
+	if image == "" {
+		return
+	}
+	imageUrl, err := pageUrl.Parse(image)
+	if err != nil || (imageUrl.Scheme != "http" && imageUrl.Scheme != "https") {
+		return
+	}
+	metadata.Image = imageUrl.String()
+}
+
+func firstMetadataValue(meta map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := meta[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func collapseWhitespace(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
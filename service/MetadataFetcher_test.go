@@ -0,0 +1,264 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+)
+
+// testUrlPolicy lets the fetcher reach httptest servers on loopback, only blockedHost is refused
+type testUrlPolicy struct {
+	blockedHost string
+}
+
+func (p *testUrlPolicy) CheckUrl(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return ErrInvalidMetadataUrl
+	}
+	if target.Hostname() == p.blockedHost {
+		return ErrBlockedUrl
+	}
+	return nil
+}
+
+func (p *testUrlPolicy) CheckAddress(ip net.IP, port int) error {
+	return nil
+}
+
+func (p *testUrlPolicy) DialControl(network string, address string, conn syscall.RawConn) error {
+	return nil
+}
+
+func newTestMetadataFetcher(maxBytes int64, maxRedirects int) MetadataFetcher {
+	envConfig := &config.EnvConfig{
+		MetadataTimeoutSeconds: 5,
+		MetadataMaxBytes:       maxBytes,
+		MetadataMaxRedirects:   maxRedirects,
+	}
+	return NewMetadataFetcher(envConfig, &testUrlPolicy{blockedHost: "blocked.example"})
+}
+
+func TestMetadataFetcherRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/articles/page", http.StatusFound)
+	})
+	mux.HandleFunc("/articles/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>Page</title><meta property="og:image" content="cover.png"></head></html>`)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://blocked.example/admin", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	fetcher := newTestMetadataFetcher(1024*1024, 3)
+
+	metadata, err := fetcher.Fetch(server.URL + "/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.FullURL != server.URL+"/articles/page" {
+		t.Errorf("got full url %q, want the url after redirects", metadata.FullURL)
+	}
+	if metadata.Image != server.URL+"/articles/cover.png" {
+		t.Errorf("got image %q, want it resolved against the final url", metadata.Image)
+	}
+	if metadata.OgTitle != "Page" {
+		t.Errorf("got title %q, want Page", metadata.OgTitle)
+	}
+
+	if _, err := fetcher.Fetch(server.URL + "/loop"); err == nil || !strings.Contains(err.Error(), "stopped after 3 redirects") {
+		t.Errorf("got %v, want the redirect limit error", err)
+	}
+	if _, err := fetcher.Fetch(server.URL + "/internal"); !errors.Is(err, ErrBlockedUrl) {
+		t.Errorf("got %v, want ErrBlockedUrl for a redirect to a blocked host", err)
+	}
+}
+
+func TestMetadataFetcherByteCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><meta property="og:title" content="Early">`)
+		fmt.Fprint(w, strings.Repeat(" ", 4096))
+		fmt.Fprint(w, `<meta property="og:description" content="Too late"></head></html>`)
+	}))
+	defer server.Close()
+
+	metadata, err := newTestMetadataFetcher(1024, 5).Fetch(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.OgTitle != "Early" {
+		t.Errorf("got title %q, want what was read before the cap", metadata.OgTitle)
+	}
+	if metadata.OgDescription != "" {
+		t.Errorf("got description %q, want nothing past the cap", metadata.OgDescription)
+	}
+}
+
+func TestMetadataFetcherTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	fetcher := newTestMetadataFetcher(1024, 5).(*metadataFetcher)
+	fetcher.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := fetcher.Fetch(server.URL)
+	if err == nil {
+		t.Fatal("got no error, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch took %v, want it to give up after the timeout", elapsed)
+	}
+}
+
+func TestMetadataFetcherContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     error
+		wantTitle   string
+		wantImage   bool
+	}{
+		{
+			name:        "json is not a web page",
+			contentType: "application/json",
+			body:        `{"title": "nope"}`,
+			wantErr:     ErrNotAWebPage,
+		},
+		{
+			name:        "pdf is not a web page",
+			contentType: "application/pdf",
+			body:        "%PDF-1.4",
+			wantErr:     ErrNotAWebPage,
+		},
+		{
+			name:        "an image link previews as itself",
+			contentType: "image/png",
+			body:        "\x89PNG",
+			wantImage:   true,
+		},
+		{
+			name:        "xhtml is read like html",
+			contentType: "application/xhtml+xml",
+			body:        `<html><head><title>Strict</title></head></html>`,
+			wantTitle:   "Strict",
+		},
+		{
+			name:        "latin-1 header charset",
+			contentType: "text/html; charset=iso-8859-1",
+			body:        "<html><head><title>Caf\xe9</title></head></html>",
+			wantTitle:   "Café",
+		},
+		{
+			name:        "charset from a meta tag",
+			contentType: "text/html",
+			body:        "<html><head><meta charset=\"windows-1252\"><title>\x93Quoted\x94</title></head></html>",
+			wantTitle:   "“Quoted”",
+		},
+		{
+			name:        "utf-8 is kept as is",
+			contentType: "text/html; charset=utf-8",
+			body:        "<html><head><title>สวัสดี</title></head></html>",
+			wantTitle:   "สวัสดี",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				fmt.Fprint(w, test.body)
+			}))
+			defer server.Close()
+
+			metadata, err := newTestMetadataFetcher(1024*1024, 5).Fetch(server.URL + "/file")
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("got %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata.OgTitle != test.wantTitle {
+				t.Errorf("got title %q, want %q", metadata.OgTitle, test.wantTitle)
+			}
+			if test.wantImage && metadata.Image != server.URL+"/file" {
+				t.Errorf("got image %q, want the link itself", metadata.Image)
+			}
+		})
+	}
+}
+
+func TestMetadataProxyFetcher(t *testing.T) {
+	var requestedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.EscapedPath()
+		fmt.Fprint(w, `{"metadata": {"ogTitle": "Proxied", "domain": "example.com"}}`)
+	}))
+	defer server.Close()
+	envConfig := &config.EnvConfig{
+		MetadataEndpoint:       server.URL,
+		MetadataTimeoutSeconds: 5,
+		MetadataMaxBytes:       1024,
+	}
+	fetcher := NewMetadataFetcher(envConfig, &testUrlPolicy{blockedHost: "blocked.example"})
+
+	metadata, err := fetcher.Fetch("https://93.184.216.34/a?b=c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestedPath != "/api/metadata/"+url.QueryEscape("https://93.184.216.34/a?b=c") {
+		t.Errorf("got path %q", requestedPath)
+	}
+	if metadata.OgTitle != "Proxied" || metadata.Domain != "example.com" {
+		t.Errorf("got %+v", metadata)
+	}
+	if _, err := fetcher.Fetch("http://blocked.example/"); !errors.Is(err, ErrBlockedUrl) {
+		t.Errorf("got %v, want the url policy applied before calling the proxy", err)
+	}
+}
+
+func TestMetadataProxyFetcherChecksResolvedAddresses(t *testing.T) {
+	proxied := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+		fmt.Fprint(w, `{"metadata": {"ogTitle": "Internal"}}`)
+	}))
+	defer server.Close()
+	envConfig := &config.EnvConfig{
+		MetadataEndpoint:       server.URL,
+		MetadataTimeoutSeconds: 5,
+		MetadataMaxBytes:       1024,
+		MetadataAllowedPorts:   []int{80, 443},
+	}
+	fetcher := NewMetadataFetcher(envConfig, NewUrlPolicy(envConfig))
+
+	// localhost passes CheckUrl as a name but resolves to loopback
+	if _, err := fetcher.Fetch("http://localhost/admin"); !errors.Is(err, ErrBlockedUrl) {
+		t.Errorf("got %v, want ErrBlockedUrl for a name resolving to loopback", err)
+	}
+	if proxied {
+		t.Error("the link was forwarded to the proxy")
+	}
+}
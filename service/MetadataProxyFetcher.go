@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/dto"
+)
+
+// metadataProxyFetcher asks the external metadata service for previews, the way they were built
+// before the service fetched pages itself. Links still have to pass the url policy, and as the proxy
+// connects on its own the host is resolved here first so every address can be checked.
+type metadataProxyFetcher struct {
+	client    *http.Client
+	endpoint  string
+	urlPolicy UrlPolicy
+	maxBytes  int64
+}
+
+func newMetadataProxyFetcher(envConfig *config.EnvConfig, urlPolicy UrlPolicy) MetadataFetcher {
+	return &metadataProxyFetcher{
+		client:    &http.Client{Timeout: time.Duration(envConfig.MetadataTimeoutSeconds) * time.Second},
+		endpoint:  envConfig.MetadataEndpoint,
+		urlPolicy: urlPolicy,
+		maxBytes:  envConfig.MetadataMaxBytes,
+	}
+}
+
+func (f *metadataProxyFetcher) Fetch(targetUrl string) (*dto.Metadata, error) {
+	parsedUrl, err := parseMetadataUrl(f.urlPolicy, targetUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkAddresses(parsedUrl); err != nil {
+		return nil, err
+	}
+	requestedUrl := fmt.Sprintf("%s/api/metadata/%s", f.endpoint, url.QueryEscape(parsedUrl.String()))
+	req, err := http.NewRequest(http.MethodGet, requestedUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("referer", requestedUrl)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		return nil, errors.New("response status error from metadata service")
+	}
+	var response dto.MetadataExternal
+	if err := json.NewDecoder(io.LimitReader(resp.Body, f.maxBytes)).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &response.Metadata, nil
+}
+
+// checkAddresses refuses the link when any address its host resolves to is blocked
+func (f *metadataProxyFetcher) checkAddresses(target *url.URL) error {
+	port, err := urlPort(target)
+	if err != nil {
+		return ErrBlockedUrl
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), f.client.Timeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, target.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if err := f.urlPolicy.CheckAddress(address.IP, port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
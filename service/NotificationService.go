@@ -0,0 +1,80 @@
+package service
+
+import (
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"github.com/tipbk/sneakfeed-service/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const notificationsCursorScope = "notifications"
+
+type NotificationService interface {
+	NotifyMentions(actorUserID string, postID string, commentID string, mentionedUserIDs []string) error
+	GetNotifications(userID string, limit int, cursor string) ([]model.Notification, *model.Pagination, error)
+	MarkNotificationsRead(userID string) error
+}
+
+type notificationService struct {
+	envConfig              *config.EnvConfig
+	notificationRepository repository.NotificationRepository
+}
+
+func NewNotificationService(envConfig *config.EnvConfig, notificationRepository repository.NotificationRepository) NotificationService {
+	return &notificationService{
+		envConfig:              envConfig,
+		notificationRepository: notificationRepository,
+	}
+}
+
+// NotifyMentions tells every mentioned user except the actor that they were mentioned
+func (s *notificationService) NotifyMentions(actorUserID string, postID string, commentID string, mentionedUserIDs []string) error {
+	now := time.Now()
+	notifications := []model.Notification{}
+	for _, userID := range mentionedUserIDs {
+		if userID == actorUserID {
+			continue
+		}
+		notifications = append(notifications, model.Notification{
+			ID:              primitive.NewObjectID(),
+			UserID:          userID,
+			ActorUserID:     actorUserID,
+			Type:            model.NotificationTypeMention,
+			PostID:          postID,
+			CommentID:       commentID,
+			CreatedDatetime: &now,
+		})
+	}
+	return s.notificationRepository.CreateNotifications(notifications)
+}
+
+func (s *notificationService) GetNotifications(userID string, limit int, cursor string) ([]model.Notification, *model.Pagination, error) {
+	var after *model.Cursor
+	if cursor != "" {
+		decoded, err := util.DecodeCursor(s.envConfig.CursorSecret, notificationsCursorScope, cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = decoded
+	}
+	notifications, pagination, err := s.notificationRepository.GetNotifications(userID, limit, after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pagination.HasMore {
+		last := notifications[len(notifications)-1]
+		pagination.NextCursor = util.EncodeCursor(s.envConfig.CursorSecret, notificationsCursorScope, model.Cursor{Datetime: *last.CreatedDatetime, ID: last.ID})
+	}
+	return notifications, pagination, nil
+}
+
+func (s *notificationService) MarkNotificationsRead(userID string) error {
+	err := s.notificationRepository.MarkNotificationsRead(userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
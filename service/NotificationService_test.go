@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"github.com/tipbk/sneakfeed-service/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeNotificationRepository pages through notifications already sorted newest first
+type fakeNotificationRepository struct {
+	repository.NotificationRepository
+	notifications []model.Notification
+	after         *model.Cursor
+}
+
+func (r *fakeNotificationRepository) GetNotifications(userID string, limit int, after *model.Cursor) ([]model.Notification, *model.Pagination, error) {
+	r.after = after
+	start := 0
+	if after != nil {
+		for i, notification := range r.notifications {
+			if notification.ID == after.ID {
+				start = i + 1
+			}
+		}
+	}
+	page := r.notifications[start:]
+	pagination := &model.Pagination{Total: len(r.notifications), Limit: limit}
+	if len(page) > limit {
+		pagination.HasMore = true
+		page = page[:limit]
+	}
+	return page, pagination, nil
+}
+
+func TestGetNotificationsCursor(t *testing.T) {
+	envConfig := &config.EnvConfig{CursorSecret: "secret"}
+	now := time.Now()
+	notifications := []model.Notification{}
+	for i := 0; i < 3; i++ {
+		createdDatetime := now.Add(-time.Duration(i) * time.Minute)
+		notifications = append(notifications, model.Notification{ID: primitive.NewObjectID(), CreatedDatetime: &createdDatetime})
+	}
+	notificationRepository := &fakeNotificationRepository{notifications: notifications}
+	notificationService := NewNotificationService(envConfig, notificationRepository)
+
+	page, pagination, err := notificationService.GetNotifications("user", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || !pagination.HasMore || pagination.NextCursor == "" {
+		t.Fatalf("first page got %d notifications and %+v", len(page), pagination)
+	}
+
+	page, pagination, err = notificationService.GetNotifications("user", 2, pagination.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notificationRepository.after == nil || notificationRepository.after.ID != notifications[1].ID || !notificationRepository.after.Datetime.Equal(notifications[1].CreatedDatetime.Truncate(time.Millisecond)) {
+		t.Errorf("second page continued after %+v, want the last notification of the first page", notificationRepository.after)
+	}
+	if len(page) != 1 || page[0].ID != notifications[2].ID || pagination.HasMore || pagination.NextCursor != "" {
+		t.Errorf("second page got %d notifications and %+v", len(page), pagination)
+	}
+
+	postsCursor := util.EncodeCursor(envConfig.CursorSecret, postsCursorScope, model.Cursor{Datetime: now, ID: notifications[0].ID})
+	if _, _, err := notificationService.GetNotifications("user", 2, postsCursor); !errors.Is(err, util.ErrInvalidCursor) {
+		t.Errorf("got %v, want ErrInvalidCursor for a cursor of another list", err)
+	}
+}
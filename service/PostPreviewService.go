@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+)
+
+const (
+	// posts whose preview was lost, like on a restart, are picked up by the sweep
+	postPreviewSweepInterval = time.Minute
+	stalePostPreviewAge      = time.Minute
+	stalePostPreviewBatch    = 100
+	// a slow page only ties up one worker, posts that don't fit in the queue are left to the sweep
+	postPreviewWorkers   = 4
+	postPreviewQueueSize = 100
+)
+
+// PostPreviewService attaches the link preview of the first link in a post after it is created,
+// so the og fields always come from the fetched page and never from the client
+type PostPreviewService interface {
+	Start()
+	Enqueue(postID string, previewUrl string)
+}
+
+type postPreviewService struct {
+	contentRepository  repository.ContentRepository
+	linkPreviewService LinkPreviewService
+	queue              chan postPreviewJob
+}
+
+type postPreviewJob struct {
+	postID     string
+	previewUrl string
+}
+
+func NewPostPreviewService(contentRepository repository.ContentRepository, linkPreviewService LinkPreviewService) PostPreviewService {
+	return &postPreviewService{
+		contentRepository:  contentRepository,
+		linkPreviewService: linkPreviewService,
+		queue:              make(chan postPreviewJob, postPreviewQueueSize),
+	}
+}
+
+// Start runs the workers and sweeps for pending previews, every replica can run it since updates only apply to pending posts
+func (s *postPreviewService) Start() {
+	for i := 0; i < postPreviewWorkers; i++ {
+		go s.work()
+	}
+	go func() {
+		ticker := time.NewTicker(postPreviewSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.attachStalePreviews(); err != nil {
+				fmt.Println("Error attaching stale post previews:", err)
+			}
+		}
+	}()
+}
+
+// Enqueue never blocks the post being created, when the queue is full the sweep attaches the preview later
+func (s *postPreviewService) Enqueue(postID string, previewUrl string) {
+	select {
+	case s.queue <- postPreviewJob{postID: postID, previewUrl: previewUrl}:
+	default:
+		fmt.Println("Post preview queue is full, leaving it to the sweep:", postID)
+	}
+}
+
+func (s *postPreviewService) work() {
+	for job := range s.queue {
+		if err := s.attachPreview(job.postID, job.previewUrl); err != nil {
+			fmt.Println("Error attaching post preview:", job.postID, err)
+		}
+	}
+}
+
+func (s *postPreviewService) attachStalePreviews() error {
+	posts, err := s.contentRepository.GetPendingPreviewPosts(time.Now().Add(-stalePostPreviewAge), stalePostPreviewBatch)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err := s.attachPreview(post.ID.Hex(), post.PreviewUrl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachPreview goes through the link preview cache, a link that can't be previewed leaves the og fields empty
+func (s *postPreviewService) attachPreview(postID string, previewUrl string) error {
+	metadata, err := s.linkPreviewService.GetLinkPreview(previewUrl)
+	preview := &model.Post{PreviewStatus: model.PreviewStatusFailed}
+	if err == nil {
+		preview = &model.Post{
+			OgTitle:       &metadata.OgTitle,
+			OgDescription: &metadata.OgDescription,
+			OgLink:        &previewUrl,
+			OgImage:       &metadata.Image,
+			OgDomain:      &metadata.Domain,
+			PreviewStatus: model.PreviewStatusReady,
+		}
+	}
+	_, err = s.contentRepository.UpdatePostPreview(postID, previewUrl, preview)
+	return err
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/dto"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+)
+
+// blockingLinkPreviewService holds every fetch until release is closed
+type blockingLinkPreviewService struct {
+	release chan struct{}
+}
+
+func (s *blockingLinkPreviewService) GetLinkPreview(targetUrl string) (*dto.Metadata, error) {
+	<-s.release
+	return &dto.Metadata{OgTitle: targetUrl}, nil
+}
+
+type fakePreviewContentRepository struct {
+	repository.ContentRepository
+	mu      sync.Mutex
+	updated map[string]string
+}
+
+func (r *fakePreviewContentRepository) UpdatePostPreview(postID string, previewUrl string, preview *model.Post) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updated[postID] = *preview.OgTitle
+	return true, nil
+}
+
+func (r *fakePreviewContentRepository) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.updated)
+}
+
+func TestPostPreviewServiceQueue(t *testing.T) {
+	links := &blockingLinkPreviewService{release: make(chan struct{})}
+	posts := &fakePreviewContentRepository{updated: map[string]string{}}
+	service := NewPostPreviewService(posts, links).(*postPreviewService)
+
+	// nothing drains the queue yet, once it is full later posts are left to the sweep
+	total := postPreviewQueueSize + 10
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < total; i++ {
+			service.Enqueue(strconv.Itoa(i), "https://example.com/"+strconv.Itoa(i))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Enqueue blocked on a full queue")
+	}
+
+	for i := 0; i < postPreviewWorkers; i++ {
+		go service.work()
+	}
+	close(links.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for posts.count() < postPreviewQueueSize && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := posts.count(); got != postPreviewQueueSize {
+		t.Fatalf("attached %d previews, want %d", got, postPreviewQueueSize)
+	}
+	for i := postPreviewQueueSize; i < total; i++ {
+		if _, ok := posts.updated[strconv.Itoa(i)]; ok {
+			t.Errorf("post %d did not fit in the queue but got a preview", i)
+		}
+	}
+}
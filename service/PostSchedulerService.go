@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	postSchedulerLockName  = "post_scheduler"
+	postSchedulerBatchSize = 100
+)
+
+// PostSchedulerService publishes scheduled posts once they are due.
+// Every replica runs it but only the one holding the Mongo lock does the work.
+type PostSchedulerService interface {
+	Start()
+	PublishDuePosts() error
+}
+
+type postSchedulerService struct {
+	envConfig           *config.EnvConfig
+	contentRepository   repository.ContentRepository
+	lockRepository      repository.LockRepository
+	notificationService NotificationService
+	timelineService     TimelineService
+	instanceID          string
+}
+
+func NewPostSchedulerService(envConfig *config.EnvConfig, contentRepository repository.ContentRepository, lockRepository repository.LockRepository, notificationService NotificationService, timelineService TimelineService) PostSchedulerService {
+	return &postSchedulerService{
+		envConfig:           envConfig,
+		contentRepository:   contentRepository,
+		lockRepository:      lockRepository,
+		notificationService: notificationService,
+		timelineService:     timelineService,
+		instanceID:          primitive.NewObjectID().Hex(),
+	}
+}
+
+func (s *postSchedulerService) Start() {
+	interval := time.Duration(s.envConfig.PostSchedulerIntervalSeconds) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			// the lease outlives a few ticks so a healthy leader keeps it
+			isLeader, err := s.lockRepository.AcquireLock(postSchedulerLockName, s.instanceID, interval*3)
+			if err != nil {
+				fmt.Println("Error acquiring post scheduler lock:", err)
+				continue
+			}
+			if !isLeader {
+				continue
+			}
+			if err := s.PublishDuePosts(); err != nil {
+				fmt.Println("Error publishing scheduled posts:", err)
+			}
+		}
+	}()
+}
+
+func (s *postSchedulerService) PublishDuePosts() error {
+	now := time.Now()
+	posts, err := s.contentRepository.GetDuePendingPosts(now, postSchedulerBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		isPublished, err := s.contentRepository.PublishPendingPost(post.ID.Hex(), now)
+		if err != nil {
+			fmt.Println("Error publishing post:", post.ID.Hex(), err)
+			continue
+		}
+		if !isPublished {
+			continue
+		}
+		s.timelineService.EnqueuePost(post.ID.Hex(), post.UserID, now)
+		err = s.notificationService.NotifyMentions(post.UserID, post.ID.Hex(), "", post.MentionedUserIDs)
+		if err != nil {
+			fmt.Println("Error notifying mentions:", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat     = "20060102T150405Z"
+)
+
+// s3StorageDriver talks to any S3 compatible store (AWS, MinIO) with path style urls
+// and signs requests with AWS signature version 4
+type s3StorageDriver struct {
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	accessKeyID     string
+	secretAccessKey string
+	publicUrl       string
+	httpClient      *http.Client
+	now             func() time.Time
+}
+
+func NewS3StorageDriver(endpoint string, region string, bucket string, accessKeyID string, secretAccessKey string, publicUrl string) (StorageDriver, error) {
+	if endpoint == "" || bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required for the s3 storage driver")
+	}
+	endpointUrl, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if publicUrl == "" {
+		publicUrl = endpointUrl.String() + "/" + bucket
+	}
+	return &s3StorageDriver{
+		endpoint:        endpointUrl,
+		region:          region,
+		bucket:          bucket,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		publicUrl:       strings.TrimSuffix(publicUrl, "/"),
+		httpClient:      storageHttpClient,
+		now:             time.Now,
+	}, nil
+}
+
+func (d *s3StorageDriver) Put(file io.Reader, size int64, fileName string, contentType string) (*StoredObject, error) {
+	request, err := http.NewRequest(http.MethodPut, d.objectUrl(fileName), file)
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = size
+	request.Header.Set("Content-Type", contentType)
+	if err := d.do(request); err != nil {
+		return nil, err
+	}
+	return &StoredObject{
+		Key: fileName,
+		Url: d.publicUrl + "/" + url.PathEscape(fileName),
+	}, nil
+}
+
+func (d *s3StorageDriver) Get(key string) (io.ReadCloser, error) {
+	request, err := http.NewRequest(http.MethodGet, d.objectUrl(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	d.sign(request)
+	response, err := d.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("s3 GET failed with status %d", response.StatusCode)
+	}
+	return response.Body, nil
+}
+
+func (d *s3StorageDriver) Delete(key string) error {
+	request, err := http.NewRequest(http.MethodDelete, d.objectUrl(key), nil)
+	if err != nil {
+		return err
+	}
+	return d.do(request)
+}
+
+func (d *s3StorageDriver) objectUrl(key string) string {
+	return d.endpoint.String() + "/" + url.PathEscape(d.bucket) + "/" + url.PathEscape(key)
+}
+
+func (d *s3StorageDriver) do(request *http.Request) error {
+	d.sign(request)
+	response, err := d.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("s3 %s failed with status %d: %s", request.Method, response.StatusCode, string(body))
+	}
+	return nil
+}
+
+// sign adds an AWS signature version 4 Authorization header, the payload is left unsigned
+// so the body can be streamed without hashing it first
+func (d *s3StorageDriver) sign(request *http.Request) {
+	amzDate := d.now().UTC().Format(amzDateFormat)
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	headers := map[string]string{
+		"host":                 request.URL.Host,
+		"x-amz-content-sha256": s3UnsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	request.Header.Set("Authorization", signV4(request.Method, request.URL.Path, request.URL.Query(), headers,
+		s3UnsignedPayload, d.accessKeyID, d.secretAccessKey, d.region, "s3"))
+}
+
+// signV4 returns the signature version 4 Authorization header of a request. path is the unescaped path and
+// headers holds every signed header by its lowercase name, x-amz-date included.
+func signV4(method string, path string, query url.Values, headers map[string]string, payloadHash string, accessKeyID string, secretAccessKey string, region string, service string) string {
+	amzDate := headers["x-amz-date"]
+	date := amzDate[:8]
+
+	headerNames := []string{}
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	canonicalHeaders := ""
+	for _, name := range headerNames {
+		canonicalHeaders += name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n"
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	queryKeys := []string{}
+	for key := range query {
+		queryKeys = append(queryKeys, key)
+	}
+	sort.Strings(queryKeys)
+	queryParts := []string{}
+	for _, key := range queryKeys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			queryParts = append(queryParts, awsUriEncode(key, true)+"="+awsUriEncode(value, true))
+		}
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		awsUriEncode(path, false),
+		strings.Join(queryParts, "&"),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return "AWS4-HMAC-SHA256 Credential=" + accessKeyID + "/" + scope +
+		", SignedHeaders=" + signedHeaders + ", Signature=" + signature
+}
+
+// awsUriEncode escapes everything but unreserved characters the way AWS expects, slashes are kept in paths
+func awsUriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+)
+
+const (
+	StorageDriverImageKit = "imagekit"
+	StorageDriverLocal    = "local"
+	StorageDriverS3       = "s3"
+)
+
+// shared by drivers that talk to storage over http, large videos need the generous timeout
+var storageHttpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// StoredObject is a file saved by a StorageDriver, Key is what Delete needs to remove it again
+type StoredObject struct {
+	Key string
+	Url string
+}
+
+// StorageDriver is where uploaded media ends up, chosen with STORAGE_DRIVER
+type StorageDriver interface {
+	Put(file io.Reader, size int64, fileName string, contentType string) (*StoredObject, error)
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+func NewStorageDriver(envConfig *config.EnvConfig) (StorageDriver, error) {
+	switch envConfig.StorageDriver {
+	case StorageDriverImageKit:
+		return NewImageKitStorageDriver(), nil
+	case StorageDriverLocal:
+		return NewLocalStorageDriver(envConfig.LocalStorageDir, envConfig.LocalStorageBaseUrl)
+	case StorageDriverS3:
+		return NewS3StorageDriver(envConfig.S3Endpoint, envConfig.S3Region, envConfig.S3Bucket, envConfig.S3AccessKeyID, envConfig.S3SecretAccessKey, envConfig.S3PublicUrl)
+	}
+	return nil, errors.New("unknown storage driver: " + envConfig.StorageDriver)
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// posts whose fan-out was lost, like on a restart, are picked up by the sweep
+	timelineSweepInterval = time.Minute
+	staleFanoutAge        = time.Minute
+	staleFanoutBatch      = 100
+	fanoutBatchSize       = 1000
+)
+
+// TimelineService keeps the home timelines behind the following feed. New posts and reposts are
+// written to the timelines of the author's followers in the background. Authors with more followers
+// than TimelineFanoutMaxFollowers are switched to fan-out on read, their posts are merged in when a
+// timeline is read instead.
+type TimelineService interface {
+	Start()
+	EnqueuePost(postID string, authorID string, createdDatetime time.Time)
+	EnqueueRepost(userID string, postID string, repostDatetime time.Time)
+	RemoveRepost(userID string, postID string)
+	Follow(userID string, followUserID string)
+	Unfollow(userID string, followUserID string)
+	GetTimeline(userID string, limit int, after *model.Cursor) ([]model.TimelineEntry, error)
+}
+
+type timelineService struct {
+	timelineRepository repository.TimelineRepository
+	maxFanoutFollowers int64
+	backfillPosts      int
+}
+
+func NewTimelineService(envConfig *config.EnvConfig, timelineRepository repository.TimelineRepository) TimelineService {
+	return &timelineService{
+		timelineRepository: timelineRepository,
+		maxFanoutFollowers: int64(envConfig.TimelineFanoutMaxFollowers),
+		backfillPosts:      envConfig.TimelineBackfillPosts,
+	}
+}
+
+// Start sweeps for posts that were never fanned out, every replica can run it since timeline writes are idempotent
+func (s *timelineService) Start() {
+	go func() {
+		ticker := time.NewTicker(timelineSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.fanoutStalePosts(); err != nil {
+				fmt.Println("Error fanning out stale posts:", err)
+			}
+		}
+	}()
+}
+
+func (s *timelineService) EnqueuePost(postID string, authorID string, createdDatetime time.Time) {
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return
+	}
+	go func() {
+		if err := s.fanoutPost(postHex, authorID, createdDatetime); err != nil {
+			fmt.Println("Error fanning out post:", postID, err)
+		}
+	}()
+}
+
+// EnqueueRepost moves the post up the timelines of the reposter's followers, it is best effort and not retried
+func (s *timelineService) EnqueueRepost(userID string, postID string, repostDatetime time.Time) {
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return
+	}
+	go func() {
+		entry := model.TimelineEntry{
+			PostID:        postHex,
+			SourceUserIDs: []string{userID},
+			Reposts:       map[string]time.Time{userID: repostDatetime},
+			FeedDatetime:  &repostDatetime,
+		}
+		if err := s.fanout(userID, entry); err != nil {
+			fmt.Println("Error fanning out repost:", postID, err)
+		}
+	}()
+}
+
+// RemoveRepost takes an undone repost off the timelines it was fanned out to, it is best effort like EnqueueRepost
+func (s *timelineService) RemoveRepost(userID string, postID string) {
+	postHex, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return
+	}
+	go func() {
+		if err := s.timelineRepository.RemoveTimelineRepost(userID, postHex); err != nil {
+			fmt.Println("Error removing repost:", postID, err)
+		}
+	}()
+}
+
+// Follow backfills the recent posts and reposts of the followed user
+func (s *timelineService) Follow(userID string, followUserID string) {
+	go func() {
+		if err := s.backfill(userID, []string{followUserID}); err != nil {
+			fmt.Println("Error backfilling timeline:", userID, err)
+		}
+	}()
+}
+
+// Unfollow takes the unfollowed user out of the timeline sources, posts someone else followed also brought in stay.
+// Until that is done the feed only shows what followed users brought in.
+func (s *timelineService) Unfollow(userID string, followUserID string) {
+	go func() {
+		if err := s.timelineRepository.RemoveTimelineSource(userID, followUserID); err != nil {
+			fmt.Println("Error pruning timeline:", userID, err)
+		}
+	}()
+}
+
+// GetTimeline returns up to limit+1 entries after the cursor so the caller can tell whether there is another page.
+// A timeline which was never built, like one from before timelines existed, is backfilled first. The posts and
+// reposts of fan-out-on-read users are merged in, sources and reposts are limited to users still followed.
+func (s *timelineService) GetTimeline(userID string, limit int, after *model.Cursor) ([]model.TimelineEntry, error) {
+	account, err := s.timelineRepository.FindTimelineAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+	followingIDs, err := s.timelineRepository.GetFollowingIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	if account.BuiltDatetime == nil {
+		if err := s.build(userID, followingIDs); err != nil {
+			return nil, err
+		}
+	}
+	sourceIDs := append([]string{userID}, followingIDs...)
+	entries, err := s.timelineRepository.GetTimeline(userID, sourceIDs, limit+1, after)
+	if err != nil {
+		return nil, err
+	}
+	entries = keepTimelineSources(entries, sourceIDs)
+	fanoutOnReadIDs, err := s.timelineRepository.GetFanoutOnReadUserIDs(followingIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(fanoutOnReadIDs) == 0 {
+		return entries, nil
+	}
+	postEntries, err := s.timelineRepository.GetRecentPostEntries(fanoutOnReadIDs, limit+1, after)
+	if err != nil {
+		return nil, err
+	}
+	repostEntries, err := s.timelineRepository.GetRecentRepostEntries(fanoutOnReadIDs, limit+1, after)
+	if err != nil {
+		return nil, err
+	}
+	return mergeTimelineEntries(entries, append(postEntries, repostEntries...), limit+1), nil
+}
+
+func (s *timelineService) fanoutStalePosts() error {
+	posts, err := s.timelineRepository.GetPendingFanoutPosts(time.Now().Add(-staleFanoutAge), staleFanoutBatch)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if post.CreatedDatetime == nil {
+			continue
+		}
+		if err := s.fanoutPost(post.ID, post.UserID, *post.CreatedDatetime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *timelineService) fanoutPost(postID primitive.ObjectID, authorID string, createdDatetime time.Time) error {
+	entry := model.TimelineEntry{PostID: postID, SourceUserIDs: []string{authorID}, FeedDatetime: &createdDatetime}
+	if err := s.fanout(authorID, entry); err != nil {
+		return err
+	}
+	return s.timelineRepository.MarkPostFannedOut(postID)
+}
+
+// fanout writes the entry to the user's own timeline and to their followers' unless they have too many,
+// then the user is switched to fan-out on read for good so their older posts are not missed
+func (s *timelineService) fanout(userID string, entry model.TimelineEntry) error {
+	entry.UserID = userID
+	if err := s.timelineRepository.AddTimelineEntries([]model.TimelineEntry{entry}); err != nil {
+		return err
+	}
+	followerCount, err := s.timelineRepository.CountFollowers(userID)
+	if err != nil {
+		return err
+	}
+	if followerCount > s.maxFanoutFollowers {
+		return s.timelineRepository.SetFanoutOnRead(userID)
+	}
+	account, err := s.timelineRepository.FindTimelineAccount(userID)
+	if err != nil {
+		return err
+	}
+	if account.FanoutOnRead {
+		return nil
+	}
+	var afterFollowID *primitive.ObjectID
+	for {
+		followerIDs, nextFollowID, err := s.timelineRepository.GetFollowerIDs(userID, afterFollowID, fanoutBatchSize)
+		if err != nil {
+			return err
+		}
+		entries := []model.TimelineEntry{}
+		for _, followerID := range followerIDs {
+			followerEntry := entry
+			followerEntry.UserID = followerID
+			entries = append(entries, followerEntry)
+		}
+		if err := s.timelineRepository.AddTimelineEntries(entries); err != nil {
+			return err
+		}
+		if nextFollowID == nil {
+			return nil
+		}
+		afterFollowID = nextFollowID
+	}
+}
+
+// build backfills a timeline from everyone the user follows and the user themself, then marks it built
+func (s *timelineService) build(userID string, followingIDs []string) error {
+	sourceIDs := append([]string{userID}, followingIDs...)
+	if err := s.backfill(userID, sourceIDs); err != nil {
+		return err
+	}
+	return s.timelineRepository.MarkTimelineBuilt(userID, time.Now())
+}
+
+// backfill adds the recent posts and reposts of the sources to the user's timeline,
+// posts of fan-out-on-read sources are left out as they are merged in on read
+func (s *timelineService) backfill(userID string, sourceIDs []string) error {
+	fanoutOnReadIDs, err := s.timelineRepository.GetFanoutOnReadUserIDs(sourceIDs)
+	if err != nil {
+		return err
+	}
+	isFanoutOnRead := map[string]bool{}
+	for _, sourceID := range fanoutOnReadIDs {
+		isFanoutOnRead[sourceID] = true
+	}
+	authorIDs := []string{}
+	for _, sourceID := range sourceIDs {
+		if !isFanoutOnRead[sourceID] || sourceID == userID {
+			authorIDs = append(authorIDs, sourceID)
+		}
+	}
+	postEntries, err := s.timelineRepository.GetRecentPostEntries(authorIDs, s.backfillPosts, nil)
+	if err != nil {
+		return err
+	}
+	repostEntries, err := s.timelineRepository.GetRecentRepostEntries(sourceIDs, s.backfillPosts, nil)
+	if err != nil {
+		return err
+	}
+	entries := append(postEntries, repostEntries...)
+	for i := range entries {
+		entries[i].UserID = userID
+	}
+	return s.timelineRepository.AddTimelineEntries(entries)
+}
+
+// keepTimelineSources drops the sources and reposts of users not in sourceIDs, like ones unfollowed but not pruned yet
+func keepTimelineSources(entries []model.TimelineEntry, sourceIDs []string) []model.TimelineEntry {
+	isSource := map[string]bool{}
+	for _, sourceID := range sourceIDs {
+		isSource[sourceID] = true
+	}
+	for i, entry := range entries {
+		kept := []string{}
+		for _, sourceID := range entry.SourceUserIDs {
+			if isSource[sourceID] {
+				kept = append(kept, sourceID)
+			}
+		}
+		entries[i].SourceUserIDs = kept
+		reposts := map[string]time.Time{}
+		for reposterID, repostDatetime := range entry.Reposts {
+			if isSource[reposterID] {
+				reposts[reposterID] = repostDatetime
+			}
+		}
+		entries[i].Reposts = reposts
+	}
+	return entries
+}
+
+// mergeTimelineEntries merges lists sorted newest first. A post in several of them is kept once
+// with every source and repost and the latest feedDatetime.
+func mergeTimelineEntries(entries []model.TimelineEntry, more []model.TimelineEntry, limit int) []model.TimelineEntry {
+	byPostID := map[primitive.ObjectID]*model.TimelineEntry{}
+	merged := []*model.TimelineEntry{}
+	for _, entry := range append(entries, more...) {
+		existing, ok := byPostID[entry.PostID]
+		if !ok {
+			first := entry
+			first.SourceUserIDs = append([]string{}, entry.SourceUserIDs...)
+			first.Reposts = map[string]time.Time{}
+			for reposterID, repostDatetime := range entry.Reposts {
+				first.Reposts[reposterID] = repostDatetime
+			}
+			byPostID[entry.PostID] = &first
+			merged = append(merged, &first)
+			continue
+		}
+		for _, sourceID := range entry.SourceUserIDs {
+			if !contains(existing.SourceUserIDs, sourceID) {
+				existing.SourceUserIDs = append(existing.SourceUserIDs, sourceID)
+			}
+		}
+		for reposterID, repostDatetime := range entry.Reposts {
+			if repostDatetime.After(existing.Reposts[reposterID]) {
+				existing.Reposts[reposterID] = repostDatetime
+			}
+		}
+		if entry.FeedDatetime.After(*existing.FeedDatetime) {
+			existing.FeedDatetime = entry.FeedDatetime
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if !merged[i].FeedDatetime.Equal(*merged[j].FeedDatetime) {
+			return merged[i].FeedDatetime.After(*merged[j].FeedDatetime)
+		}
+		return merged[i].PostID.Hex() > merged[j].PostID.Hex()
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	result := []model.TimelineEntry{}
+	for _, entry := range merged {
+		result = append(result, *entry)
+	}
+	return result
+}
+
+// latestRepost returns who reposted the entry's post last, the smaller user id wins a tie
+func latestRepost(entry model.TimelineEntry) (string, time.Time, bool) {
+	latestID := ""
+	var latestDatetime time.Time
+	for reposterID, repostDatetime := range entry.Reposts {
+		if latestID == "" || repostDatetime.After(latestDatetime) || (repostDatetime.Equal(latestDatetime) && reposterID < latestID) {
+			latestID = reposterID
+			latestDatetime = repostDatetime
+		}
+	}
+	return latestID, latestDatetime, latestID != ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func timelineEntry(postID primitive.ObjectID, feedDatetime time.Time, sourceUserIDs []string, reposts map[string]time.Time) model.TimelineEntry {
+	return model.TimelineEntry{PostID: postID, SourceUserIDs: sourceUserIDs, Reposts: reposts, FeedDatetime: &feedDatetime}
+}
+
+func TestMergeTimelineEntries(t *testing.T) {
+	now := time.Now()
+	shared := primitive.NewObjectID()
+	older := primitive.NewObjectID()
+	newer := primitive.NewObjectID()
+	entries := []model.TimelineEntry{
+		timelineEntry(shared, now.Add(-time.Minute), []string{"author"}, nil),
+		timelineEntry(older, now.Add(-time.Hour), []string{"friend"}, nil),
+	}
+	more := []model.TimelineEntry{
+		timelineEntry(newer, now, []string{"celebrity"}, nil),
+		timelineEntry(shared, now.Add(-30*time.Second), []string{"celebrity"}, map[string]time.Time{"celebrity": now.Add(-30 * time.Second)}),
+	}
+
+	merged := mergeTimelineEntries(entries, more, 10)
+	gotIDs := []primitive.ObjectID{}
+	for _, entry := range merged {
+		gotIDs = append(gotIDs, entry.PostID)
+	}
+	if !reflect.DeepEqual(gotIDs, []primitive.ObjectID{newer, shared, older}) {
+		t.Fatalf("got posts %v, want newest first with the shared post once", gotIDs)
+	}
+	sharedEntry := merged[1]
+	sort.Strings(sharedEntry.SourceUserIDs)
+	if !reflect.DeepEqual(sharedEntry.SourceUserIDs, []string{"author", "celebrity"}) {
+		t.Errorf("got sources %v, want both", sharedEntry.SourceUserIDs)
+	}
+	if !sharedEntry.FeedDatetime.Equal(now.Add(-30*time.Second)) || len(sharedEntry.Reposts) != 1 {
+		t.Errorf("got %v and reposts %v, want the repost's time", sharedEntry.FeedDatetime, sharedEntry.Reposts)
+	}
+	if len(entries[0].SourceUserIDs) != 1 {
+		t.Errorf("merging changed the input entry to %v", entries[0].SourceUserIDs)
+	}
+
+	if merged := mergeTimelineEntries(entries, more, 2); len(merged) != 2 {
+		t.Errorf("got %d entries, want the limit", len(merged))
+	}
+}
+
+func TestUnrepostRemovesRepostedBy(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	reposter := model.User{ID: primitive.NewObjectID(), Username: "reposter"}
+	reposterID := reposter.ID.Hex()
+	reposted := timelineEntry(primitive.NewObjectID(), now, []string{"friend", reposterID}, map[string]time.Time{reposterID: now})
+	own := timelineEntry(primitive.NewObjectID(), now.Add(-time.Minute), []string{reposterID}, map[string]time.Time{reposterID: now.Add(-time.Minute)})
+	timeline := &fakeTimelineService{
+		entries:   []model.TimelineEntry{reposted, own},
+		authorIDs: map[primitive.ObjectID]string{reposted.PostID: "friend", own.PostID: reposterID},
+	}
+	contentRepository := &fakeTimelineContentRepository{
+		visible:  map[primitive.ObjectID]bool{reposted.PostID: true, own.PostID: true},
+		reposted: map[string]bool{reposterID + reposted.PostID.Hex(): true, reposterID + own.PostID.Hex(): true},
+	}
+	contentService := &contentService{
+		envConfig:         &config.EnvConfig{CursorSecret: "secret"},
+		contentRepository: contentRepository,
+		userService:       &fakeTimelineUserService{users: []model.User{reposter}},
+		timelineService:   timeline,
+	}
+
+	for _, entry := range timeline.entries {
+		isRepost, err := contentService.ToggleRepostOnPost(reposterID, entry.PostID.Hex())
+		if err != nil || isRepost {
+			t.Fatalf("got %v and %v, want the post unreposted", isRepost, err)
+		}
+	}
+	page, err := contentService.getFollowingPage("me", 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != 2 {
+		t.Fatalf("got %d posts, want both still on the timeline", len(page.Posts))
+	}
+	for _, post := range page.Posts {
+		if post.RepostedBy != nil {
+			t.Errorf("got repostedBy %+v on %v, want none after the unrepost", post.RepostedBy, post.ID)
+		}
+	}
+	if !reflect.DeepEqual(timeline.entries[0].SourceUserIDs, []string{"friend"}) || !reflect.DeepEqual(timeline.entries[1].SourceUserIDs, []string{reposterID}) {
+		t.Errorf("got sources %v and %v, want the reposter kept only on their own post", timeline.entries[0].SourceUserIDs, timeline.entries[1].SourceUserIDs)
+	}
+}
+
+func TestKeepTimelineSources(t *testing.T) {
+	now := time.Now()
+	entries := []model.TimelineEntry{
+		timelineEntry(primitive.NewObjectID(), now, []string{"friend", "unfollowed"}, map[string]time.Time{"friend": now, "unfollowed": now}),
+	}
+	kept := keepTimelineSources(entries, []string{"me", "friend"})
+	if !reflect.DeepEqual(kept[0].SourceUserIDs, []string{"friend"}) {
+		t.Errorf("got sources %v, want only the followed one", kept[0].SourceUserIDs)
+	}
+	if _, ok := kept[0].Reposts["unfollowed"]; ok || len(kept[0].Reposts) != 1 {
+		t.Errorf("got reposts %v, want only the followed one", kept[0].Reposts)
+	}
+}
+
+func TestLatestRepost(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		reposts map[string]time.Time
+		wantID  string
+		wantOK  bool
+	}{
+		{"no reposts", nil, "", false},
+		{"latest wins", map[string]time.Time{"a": now.Add(-time.Minute), "b": now}, "b", true},
+		{"tie goes to the smaller id", map[string]time.Time{"b": now, "a": now}, "a", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := timelineEntry(primitive.NewObjectID(), now, nil, test.reposts)
+			gotID, _, ok := latestRepost(entry)
+			if gotID != test.wantID || ok != test.wantOK {
+				t.Errorf("got %q %v, want %q %v", gotID, ok, test.wantID, test.wantOK)
+			}
+		})
+	}
+}
+
+// fakeTimelineService pages through entries already sorted newest first
+type fakeTimelineService struct {
+	TimelineService
+	entries   []model.TimelineEntry
+	authorIDs map[primitive.ObjectID]string
+	reads     int
+}
+
+func (s *fakeTimelineService) GetTimeline(userID string, limit int, after *model.Cursor) ([]model.TimelineEntry, error) {
+	s.reads++
+	start := 0
+	if after != nil {
+		for i, entry := range s.entries {
+			if entry.PostID == after.ID {
+				start = i + 1
+			}
+		}
+	}
+	page := s.entries[start:]
+	if len(page) > limit+1 {
+		page = page[:limit+1]
+	}
+	return page, nil
+}
+
+// RemoveRepost keeps the reposter as a source of the posts they wrote, like the repository does
+func (s *fakeTimelineService) RemoveRepost(userID string, postID string) {
+	for i := range s.entries {
+		entry := &s.entries[i]
+		if entry.PostID.Hex() != postID {
+			continue
+		}
+		delete(entry.Reposts, userID)
+		if s.authorIDs[entry.PostID] == userID {
+			continue
+		}
+		sourceUserIDs := []string{}
+		for _, sourceUserID := range entry.SourceUserIDs {
+			if sourceUserID != userID {
+				sourceUserIDs = append(sourceUserIDs, sourceUserID)
+			}
+		}
+		entry.SourceUserIDs = sourceUserIDs
+	}
+}
+
+// fakeTimelineContentRepository only knows the visible posts
+type fakeTimelineContentRepository struct {
+	repository.ContentRepository
+	visible  map[primitive.ObjectID]bool
+	reposted map[string]bool
+}
+
+func (r *fakeTimelineContentRepository) IsPostRepostedByUserID(userID string, postID string) (bool, error) {
+	return r.reposted[userID+postID], nil
+}
+
+func (r *fakeTimelineContentRepository) UnrepostPost(userID string, postID string) error {
+	delete(r.reposted, userID+postID)
+	return nil
+}
+
+func (r *fakeTimelineContentRepository) GetPostsByIDs(userID string, postIDs []primitive.ObjectID) ([]model.PostDetail, error) {
+	posts := []model.PostDetail{}
+	for _, postID := range postIDs {
+		if r.visible[postID] {
+			posts = append(posts, model.PostDetail{ID: postID})
+		}
+	}
+	return posts, nil
+}
+
+type fakeTimelineUserService struct {
+	UserService
+	users []model.User
+}
+
+func (s *fakeTimelineUserService) GetUsersByIDList(userIDs []string) ([]model.User, error) {
+	return s.users, nil
+}
+
+func TestGetFollowingPageTopsUp(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	reposter := model.User{ID: primitive.NewObjectID(), Username: "reposter"}
+	entries := []model.TimelineEntry{}
+	visible := map[primitive.ObjectID]bool{}
+	for i := 0; i < 6; i++ {
+		entry := timelineEntry(primitive.NewObjectID(), now.Add(-time.Duration(i)*time.Minute), []string{"friend"}, nil)
+		entries = append(entries, entry)
+		// the second and third posts were deleted
+		visible[entry.PostID] = i != 1 && i != 2
+	}
+	entries[3].Reposts = map[string]time.Time{reposter.ID.Hex(): *entries[3].FeedDatetime, "other": now.Add(-time.Hour)}
+	timeline := &fakeTimelineService{entries: entries}
+	contentService := &contentService{
+		envConfig:         &config.EnvConfig{CursorSecret: "secret"},
+		contentRepository: &fakeTimelineContentRepository{visible: visible},
+		userService:       &fakeTimelineUserService{users: []model.User{reposter}},
+		timelineService:   timeline,
+	}
+
+	page, err := contentService.getFollowingPage("me", 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []primitive.ObjectID{entries[0].PostID, entries[3].PostID, entries[4].PostID}
+	got := []primitive.ObjectID{}
+	for _, post := range page.Posts {
+		got = append(got, post.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got posts %v, want the page topped up past the deleted ones %v", got, want)
+	}
+	if timeline.reads != 2 || !page.Pagination.HasMore || page.Pagination.NextCursor == "" {
+		t.Errorf("got %d reads and %+v", timeline.reads, page.Pagination)
+	}
+	repostedBy := page.Posts[1].RepostedBy
+	if repostedBy == nil || repostedBy.Username != "reposter" || repostedBy.TotalReposters != 2 {
+		t.Errorf("got repostedBy %+v, want the latest reposter of two", repostedBy)
+	}
+	if page.Posts[0].RepostedBy != nil || !page.Posts[1].FeedDatetime.Equal(*entries[3].FeedDatetime) {
+		t.Errorf("repostedBy and feedDatetime were not taken from the entries")
+	}
+
+	after, err := contentService.decodeCursor(postsCursorScope, page.Pagination.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err = contentService.getFollowingPage("me", 3, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].ID != entries[5].PostID || page.Pagination.HasMore {
+		t.Errorf("got %d posts and %+v on the last page", len(page.Posts), page.Pagination)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/config"
+	"github.com/tipbk/sneakfeed-service/model"
+	"github.com/tipbk/sneakfeed-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	trendingLimit    = 10
+	trendingLockName = "trending"
+)
+
+// TrendingService compares how many users used each hashtag and domain in the last TRENDING_WINDOW_MINUTES
+// against the TRENDING_BASELINE_HOURS before it. Only the replica holding the Mongo lock recomputes it,
+// every replica serves the stored result.
+type TrendingService interface {
+	Start()
+	RefreshTrending() error
+	GetTrending() (*model.Trending, error)
+}
+
+type trendingService struct {
+	envConfig          *config.EnvConfig
+	trendingRepository repository.TrendingRepository
+	lockRepository     repository.LockRepository
+	instanceID         string
+}
+
+func NewTrendingService(envConfig *config.EnvConfig, trendingRepository repository.TrendingRepository, lockRepository repository.LockRepository) TrendingService {
+	return &trendingService{
+		envConfig:          envConfig,
+		trendingRepository: trendingRepository,
+		lockRepository:     lockRepository,
+		instanceID:         primitive.NewObjectID().Hex(),
+	}
+}
+
+// Start refreshes trending in the background on every interval, the window moves forward with each refresh
+func (s *trendingService) Start() {
+	interval := time.Duration(s.envConfig.TrendingIntervalMinutes) * time.Minute
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			isLeader, err := s.lockRepository.AcquireLock(trendingLockName, s.instanceID, interval*3)
+			if err != nil {
+				fmt.Println("Error acquiring trending lock:", err)
+			} else if isLeader {
+				if err := s.RefreshTrending(); err != nil {
+					fmt.Println("Error refreshing trending:", err)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *trendingService) RefreshTrending() error {
+	now := time.Now()
+	window := time.Duration(s.envConfig.TrendingWindowMinutes) * time.Minute
+	baseline := time.Duration(s.envConfig.TrendingBaselineHours) * time.Hour
+	recentFrom := now.Add(-window)
+	baselineFrom := recentFrom.Add(-baseline)
+
+	hashtagUsages, err := s.trendingRepository.CountHashtagUsage(recentFrom, baselineFrom)
+	if err != nil {
+		return err
+	}
+	domainUsages, err := s.trendingRepository.CountDomainUsage(recentFrom, baselineFrom)
+	if err != nil {
+		return err
+	}
+
+	return s.trendingRepository.SaveTrending(&model.Trending{
+		Hashtags:         rankTrendingTerms(hashtagUsages, window, baseline, s.envConfig.TrendingMinUsers),
+		Domains:          rankTrendingTerms(domainUsages, window, baseline, s.envConfig.TrendingMinUsers),
+		ComputedDatetime: &now,
+	})
+}
+
+func (s *trendingService) GetTrending() (*model.Trending, error) {
+	trending, err := s.trendingRepository.GetTrending()
+	if err != nil {
+		return nil, err
+	}
+	return trending, nil
+}
+
+// rankTrendingTerms scores each term by how much faster it is used in the recent window than in the baseline.
+// The baseline gets one extra user so brand new terms don't divide by zero, and terms used by fewer than
+// minUsers distinct users are dropped so one account can't trend on its own.
+func rankTrendingTerms(usages []model.TermUsage, window, baseline time.Duration, minUsers int) []model.TrendingItem {
+	items := []model.TrendingItem{}
+	for _, usage := range usages {
+		if usage.RecentUsers < minUsers {
+			continue
+		}
+		recentRate := float64(usage.RecentUsers) / window.Hours()
+		baselineRate := float64(usage.BaselineUsers+1) / baseline.Hours()
+		score := recentRate / baselineRate
+		if score <= 1 {
+			continue
+		}
+		items = append(items, model.TrendingItem{
+			Name:          usage.Name,
+			RecentUsers:   usage.RecentUsers,
+			BaselineUsers: usage.BaselineUsers,
+			Score:         score,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Score != items[j].Score {
+			return items[i].Score > items[j].Score
+		}
+		if items[i].RecentUsers != items[j].RecentUsers {
+			return items[i].RecentUsers > items[j].RecentUsers
+		}
+		return items[i].Name < items[j].Name
+	})
+	if len(items) > trendingLimit {
+		items = items[:trendingLimit]
+	}
+	return items
+}
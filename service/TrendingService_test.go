@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tipbk/sneakfeed-service/model"
+)
+
+func TestRankTrendingTerms(t *testing.T) {
+	window := time.Hour
+	baseline := 24 * time.Hour
+	manyTerms := []model.TermUsage{}
+	for i := 0; i < trendingLimit+5; i++ {
+		manyTerms = append(manyTerms, model.TermUsage{Name: fmt.Sprintf("tag%02d", i), RecentUsers: 10 + i})
+	}
+
+	tests := []struct {
+		name     string
+		usages   []model.TermUsage
+		minUsers int
+		want     []string
+	}{
+		{
+			name:     "no usage",
+			usages:   []model.TermUsage{},
+			minUsers: 3,
+			want:     []string{},
+		},
+		{
+			name: "fewer distinct users than the spam guard are dropped",
+			usages: []model.TermUsage{
+				{Name: "spam", RecentUsers: 1},
+				{Name: "go", RecentUsers: 3},
+			},
+			minUsers: 3,
+			want:     []string{"go"},
+		},
+		{
+			name: "terms not used faster than their baseline are dropped",
+			usages: []model.TermUsage{
+				// 3 users an hour against 48 users a day, 2 an hour
+				{Name: "steady", RecentUsers: 3, BaselineUsers: 71},
+				{Name: "rising", RecentUsers: 3, BaselineUsers: 10},
+			},
+			minUsers: 3,
+			want:     []string{"rising"},
+		},
+		{
+			name: "ordered by speed up over the baseline",
+			usages: []model.TermUsage{
+				{Name: "big", RecentUsers: 50, BaselineUsers: 500},
+				{Name: "new", RecentUsers: 5, BaselineUsers: 0},
+				{Name: "mid", RecentUsers: 10, BaselineUsers: 23},
+			},
+			minUsers: 3,
+			want:     []string{"new", "mid", "big"},
+		},
+		{
+			name: "equal scores are ordered by recent users then name",
+			usages: []model.TermUsage{
+				{Name: "b", RecentUsers: 4, BaselineUsers: 1},
+				{Name: "c", RecentUsers: 8, BaselineUsers: 3},
+				{Name: "a", RecentUsers: 4, BaselineUsers: 1},
+			},
+			minUsers: 3,
+			want:     []string{"c", "a", "b"},
+		},
+		{
+			name:     "at most trendingLimit terms",
+			usages:   manyTerms,
+			minUsers: 3,
+			want:     []string{"tag14", "tag13", "tag12", "tag11", "tag10", "tag09", "tag08", "tag07", "tag06", "tag05"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items := rankTrendingTerms(test.usages, window, baseline, test.minUsers)
+			names := []string{}
+			for _, item := range items {
+				names = append(names, item.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(test.want) {
+				t.Errorf("got %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestRankTrendingTermsScore(t *testing.T) {
+	items := rankTrendingTerms([]model.TermUsage{{Name: "go", RecentUsers: 6, BaselineUsers: 11}}, time.Hour, 24*time.Hour, 3)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	// 6 users in the last hour against 12 a day, half a user an hour
+	if items[0].Score != 12 {
+		t.Errorf("got score %v, want 12", items[0].Score)
+	}
+	if items[0].RecentUsers != 6 || items[0].BaselineUsers != 11 {
+		t.Errorf("got users %d/%d, want 6/11", items[0].RecentUsers, items[0].BaselineUsers)
+	}
+}
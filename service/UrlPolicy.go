@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+
+	"github.com/tipbk/sneakfeed-service/config"
+)
+
+var ErrBlockedUrl = errors.New("link points to an address that is not allowed")
+
+// blockedNetworks are never fetched on behalf of a user: private, loopback, link-local
+// and the other special purpose ranges that can reach the service's own network
+var blockedNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	// ipv6 addresses carrying an ipv4 address: ipv4-compatible, NAT64, Teredo and 6to4.
+	// ipv4-mapped addresses are matched by the ipv4 ranges above.
+	"::/96",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+	"2001::/32",
+	"2002::/16",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// UrlPolicy decides which links the service may fetch. CheckUrl runs on the link and every redirect,
+// CheckAddress runs on the address actually dialed so DNS answers cannot sneak past it.
+type UrlPolicy interface {
+	CheckUrl(target *url.URL) error
+	CheckAddress(ip net.IP, port int) error
+	DialControl(network string, address string, conn syscall.RawConn) error
+}
+
+type urlPolicy struct {
+	allowedPorts map[int]bool
+}
+
+func NewUrlPolicy(envConfig *config.EnvConfig) UrlPolicy {
+	allowedPorts := map[int]bool{}
+	for _, port := range envConfig.MetadataAllowedPorts {
+		allowedPorts[port] = true
+	}
+	return &urlPolicy{
+		allowedPorts: allowedPorts,
+	}
+}
+
+func (p *urlPolicy) CheckUrl(target *url.URL) error {
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return ErrInvalidMetadataUrl
+	}
+	if target.User != nil {
+		return ErrBlockedUrl
+	}
+	portNumber, err := urlPort(target)
+	if err != nil || !p.allowedPorts[portNumber] {
+		return ErrBlockedUrl
+	}
+	// literal addresses can be refused before any connection is made
+	if ip := net.ParseIP(target.Hostname()); ip != nil {
+		return p.CheckAddress(ip, portNumber)
+	}
+	return nil
+}
+
+func (p *urlPolicy) CheckAddress(ip net.IP, port int) error {
+	if !p.allowedPorts[port] {
+		return ErrBlockedUrl
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return ErrBlockedUrl
+		}
+	}
+	return nil
+}
+
+// DialControl is used as net.Dialer.Control, it sees the resolved address of every connection
+func (p *urlPolicy) DialControl(network string, address string, conn syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	portNumber, err := strconv.Atoi(port)
+	if ip == nil || err != nil {
+		return fmt.Errorf("unexpected dial address %s", address)
+	}
+	return p.CheckAddress(ip, portNumber)
+}
+
+// urlPort is the port a link connects to, the scheme's default when it has none
+func urlPort(target *url.URL) (int, error) {
+	port := target.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+	return strconv.Atoi(port)
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
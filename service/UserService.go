@@ -2,14 +2,21 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
 
 	"github.com/tipbk/sneakfeed-service/model"
 	"github.com/tipbk/sneakfeed-service/repository"
 )
 
+// ErrInvalidProfileImage means the media picked as profile image is missing or not an image
+var ErrInvalidProfileImage = errors.New("invalid profile image")
+
 type userService struct {
-	userRepository repository.UserRepository
+	userRepository       repository.UserRepository
+	timelineService      TimelineService
+	mediaService         MediaService
+	imageUploaderService ImageUploaderService
 }
 
 type UserService interface {
@@ -19,14 +26,19 @@ type UserService interface {
 	FindUserWithUsername(username string) (*model.User, error)
 	FindUserViewByOthers(currentUserID, targetUsername string) (*model.UserViewByOthers, error)
 	GetUsersByIDList(userIDs []string) ([]model.User, error)
-	UpdateProfile(userID string, updatedUser *model.User) error
+	UpdateProfile(user *model.User, displayName string, imageBase64 string, profileImageMediaID string) error
+	FollowUser(userID string, followUserID string) error
+	UnfollowUser(userID string, followUserID string) error
 	ToggleFollowOnUser(userID string, followUserID string) (bool, error)
 	IsUserFollowed(userID, followUserID string) (bool, error)
 }
 
-func NewUserService(userRepository repository.UserRepository) UserService {
+func NewUserService(userRepository repository.UserRepository, timelineService TimelineService, mediaService MediaService, imageUploaderService ImageUploaderService) UserService {
 	return &userService{
-		userRepository: userRepository,
+		userRepository:       userRepository,
+		timelineService:      timelineService,
+		mediaService:         mediaService,
+		imageUploaderService: imageUploaderService,
 	}
 }
 
@@ -82,11 +94,59 @@ func (s *userService) GetUsersByIDList(userIDs []string) ([]model.User, error) {
 	return users, nil
 }
 
-func (s *userService) UpdateProfile(userID string, updatedUser *model.User) error {
-	err := s.userRepository.UpdateProfile(userID, updatedUser)
-	if err != nil {
+// UpdateProfile sets the display name and profile image, either uploaded media or a base64 image.
+// The profile holds a reference on its image, the one it replaced is let go once the new one is saved.
+func (s *userService) UpdateProfile(user *model.User, displayName string, imageBase64 string, profileImageMediaID string) error {
+	imageUrl := ""
+	previousImageUrl := user.ProfileImage
+	var profileMedia *model.MediaAttachment
+
+	if profileImageMediaID != "" {
+		media, err := s.mediaService.GetUserMedia(user.ID.Hex(), []string{profileImageMediaID})
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProfileImage, err)
+		}
+		if media[0].Type != model.MediaTypeImage {
+			return fmt.Errorf("%w: profile image must be an image", ErrInvalidProfileImage)
+		}
+		attachment := media[0].Attachment("")
+		imageUrl = attachment.Variant(ImageVariantAvatar)
+		profileMedia = &attachment
+	} else if imageBase64 != "" {
+		uploadResponse, err := s.imageUploaderService.UploadImage(imageBase64)
+		if err != nil {
+			return err
+		}
+		imageUrl = uploadResponse.Variant(ImageVariantAvatar)
+	}
+
+	if imageUrl != "" {
+		user.ProfileImage = imageUrl
+	}
+	if displayName != "" {
+		user.DisplayName = displayName
+	}
+
+	if err := s.userRepository.UpdateProfile(user.ID.Hex(), user); err != nil {
+		// the upload above took a reference for this profile, media picked by id only takes one once saved
+		if imageUrl != "" && profileMedia == nil {
+			if err := s.imageUploaderService.ReleaseImageUrl(imageUrl); err != nil {
+				fmt.Println("Error releasing profile image:", err)
+			}
+		}
 		return err
 	}
+
+	if profileMedia != nil {
+		if err := s.imageUploaderService.AcquireMedia(*profileMedia, 1); err != nil {
+			fmt.Println("Error acquiring profile image:", err)
+		}
+	}
+	if imageUrl != "" && previousImageUrl != "" {
+		if err := s.imageUploaderService.ReleaseImageUrl(previousImageUrl); err != nil {
+			fmt.Println("Error releasing profile image:", err)
+		}
+	}
 	return nil
 }
 
@@ -132,22 +192,37 @@ func (s *userService) IsUserFollowed(userID, followUserID string) (bool, error)
 	return isFollowed, nil
 }
 
+// FollowUser and UnfollowUser are idempotent, only a change touches the timeline
+func (s *userService) FollowUser(userID string, followUserID string) error {
+	isFollowed, err := s.userRepository.FollowUser(userID, followUserID)
+	if err != nil {
+		return err
+	}
+	if isFollowed {
+		s.timelineService.Follow(userID, followUserID)
+	}
+	return nil
+}
+
+func (s *userService) UnfollowUser(userID string, followUserID string) error {
+	isUnfollowed, err := s.userRepository.UnfollowUser(userID, followUserID)
+	if err != nil {
+		return err
+	}
+	if isUnfollowed {
+		s.timelineService.Unfollow(userID, followUserID)
+	}
+	return nil
+}
+
+// ToggleFollowOnUser is kept for the toggle endpoint, a retried toggle can still flip the follow back
 func (s *userService) ToggleFollowOnUser(userID string, followUserID string) (bool, error) {
 	isFollowed, err := s.userRepository.IsUserFollowed(userID, followUserID)
 	if err != nil {
 		return false, err
 	}
-	if isFollowed { //do unfollow
-		err := s.userRepository.UnfollowUser(userID, followUserID)
-		if err != nil {
-			return false, err
-		}
-		return false, nil
-	} else { // do follow
-		_, err := s.userRepository.FollowUser(userID, followUserID)
-		if err != nil {
-			return false, err
-		}
-		return true, nil
+	if isFollowed {
+		return false, s.UnfollowUser(userID, followUserID)
 	}
+	return true, s.FollowUser(userID, followUserID)
 }
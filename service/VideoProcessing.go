@@ -0,0 +1,336 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ffmpegTimeout = 2 * time.Minute
+	// browsers treat tiny gif delays as 100ms, so durations are computed the same way
+	minGifFrameDelay  = 2
+	maxMediaDimension = 4096
+	// every decoded frame is kept in memory at one byte per pixel, so frames and their total area are capped
+	maxGifFrames      = 1000
+	maxGifFramePixels = 100 * 1000 * 1000
+)
+
+var (
+	allowedVideoCodecs = map[string]bool{"h264": true, "vp8": true, "vp9": true, "av1": true}
+	allowedAudioCodecs = map[string]bool{"aac": true, "mp3": true, "opus": true, "vorbis": true}
+)
+
+// mediaRejectedError means the file itself is invalid, retrying won't help
+type mediaRejectedError struct {
+	reason string
+}
+
+func (e *mediaRejectedError) Error() string {
+	return e.reason
+}
+
+func rejectMedia(format string, args ...interface{}) error {
+	return &mediaRejectedError{reason: fmt.Sprintf(format, args...)}
+}
+
+// videoProbe is the part of `ffprobe -show_format -show_streams` output we look at
+type videoProbe struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation int `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+// videoInfo is a validated video, Width and Height already account for rotation
+type videoInfo struct {
+	Container   string
+	Extension   string
+	ContentType string
+	Width       int
+	Height      int
+	Duration    float64
+}
+
+func probeVideo(ffprobePath string, path string) (*videoProbe, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, ffprobePath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, rejectMedia("video could not be read")
+		}
+		return nil, err
+	}
+	var probe videoProbe
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, err
+	}
+	return &probe, nil
+}
+
+// validateVideo checks container, codecs, duration and dimensions of a probed video
+func validateVideo(probe *videoProbe, maxDuration float64) (*videoInfo, error) {
+	info := &videoInfo{}
+	formats := strings.Split(probe.Format.FormatName, ",")
+	for _, format := range formats {
+		switch format {
+		case "mp4":
+			info.Container, info.Extension, info.ContentType = "mp4", ".mp4", "video/mp4"
+		case "webm":
+			info.Container, info.Extension, info.ContentType = "webm", ".webm", "video/webm"
+		}
+	}
+	if info.Container == "" {
+		return nil, rejectMedia("video container %s is not supported", probe.Format.FormatName)
+	}
+
+	videoStreams := 0
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			videoStreams++
+			if !allowedVideoCodecs[stream.CodecName] {
+				return nil, rejectMedia("video codec %s is not supported", stream.CodecName)
+			}
+			info.Width, info.Height = stream.Width, stream.Height
+			if streamRotation(stream.Tags, stream.SideDataList)%180 != 0 {
+				info.Width, info.Height = info.Height, info.Width
+			}
+		case "audio":
+			if !allowedAudioCodecs[stream.CodecName] {
+				return nil, rejectMedia("audio codec %s is not supported", stream.CodecName)
+			}
+		}
+	}
+	if videoStreams != 1 {
+		return nil, rejectMedia("video must have exactly one video stream")
+	}
+	if info.Width <= 0 || info.Height <= 0 || info.Width > maxMediaDimension || info.Height > maxMediaDimension {
+		return nil, rejectMedia("video must be at most %dx%d", maxMediaDimension, maxMediaDimension)
+	}
+
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return nil, rejectMedia("video duration is unknown")
+	}
+	if duration > maxDuration {
+		return nil, rejectMedia("video cannot be longer than %.0f seconds", maxDuration)
+	}
+	info.Duration = duration
+	return info, nil
+}
+
+func streamRotation(tags map[string]string, sideData []struct {
+	Rotation int `json:"rotation"`
+}) int {
+	for _, data := range sideData {
+		if data.Rotation != 0 {
+			return data.Rotation
+		}
+	}
+	rotation, _ := strconv.Atoi(tags["rotate"])
+	return rotation
+}
+
+// remuxVideo copies the streams into a fresh container without the metadata of the upload,
+// mp4s get their index moved to the front so playback can start before the download ends
+func remuxVideo(ffmpegPath string, input string, output string, info *videoInfo) error {
+	args := []string{"-v", "error", "-y", "-i", input, "-map", "0:v:0", "-map", "0:a:0?", "-map_metadata", "-1", "-c", "copy"}
+	if info.Container == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return runFfmpeg(ffmpegPath, append(args, output)...)
+}
+
+// extractPosterFrame saves one upright frame from early in the video as png
+func extractPosterFrame(ffmpegPath string, input string, output string, duration float64) error {
+	position := 1.0
+	if duration < 2 {
+		position = duration / 2
+	}
+	return runFfmpeg(ffmpegPath, "-v", "error", "-y", "-ss", strconv.FormatFloat(position, 'f', 3, 64), "-i", input, "-frames:v", "1", output)
+}
+
+func runFfmpeg(ffmpegPath string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	command := exec.CommandContext(ctx, ffmpegPath, args...)
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return rejectMedia("video could not be processed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	return nil
+}
+
+// animatedGif is a decoded gif re-encoded without comments or application extensions
+type animatedGif struct {
+	Data     []byte
+	Poster   image.Image
+	Width    int
+	Height   int
+	Duration float64
+	Frames   int
+}
+
+// decodeAnimatedGif checks the canvas, frame count and frame area by reading the gif headers first,
+// so a gif bomb is refused before any frame is decoded
+func decodeAnimatedGif(file io.ReadSeeker, maxDuration float64) (*animatedGif, error) {
+	config, err := gif.DecodeConfig(file)
+	if err != nil {
+		return nil, rejectMedia("gif could not be read")
+	}
+	width, height := config.Width, config.Height
+	if width <= 0 || height <= 0 || width > maxMediaDimension || height > maxMediaDimension {
+		return nil, rejectMedia("gif must be at most %dx%d", maxMediaDimension, maxMediaDimension)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := checkGifFrames(bufio.NewReader(file), maxGifFrames, maxGifFramePixels); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	decoded, err := gif.DecodeAll(file)
+	if err != nil {
+		return nil, rejectMedia("gif could not be read")
+	}
+	duration := 0.0
+	for _, delay := range decoded.Delay {
+		if delay < minGifFrameDelay {
+			delay = 10
+		}
+		duration += float64(delay) / 100
+	}
+	if duration > maxDuration {
+		return nil, rejectMedia("gif cannot be longer than %.0f seconds", maxDuration)
+	}
+
+	// the first frame may not cover the whole canvas, so draw it onto one
+	poster := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(poster, decoded.Image[0].Bounds(), decoded.Image[0], decoded.Image[0].Bounds().Min, draw.Over)
+
+	var buffer bytes.Buffer
+	if err := gif.EncodeAll(&buffer, decoded); err != nil {
+		return nil, err
+	}
+	return &animatedGif{
+		Data:     buffer.Bytes(),
+		Poster:   poster,
+		Width:    width,
+		Height:   height,
+		Duration: duration,
+		Frames:   len(decoded.Image),
+	}, nil
+}
+
+// checkGifFrames walks the blocks of a gif without decompressing them and stops as soon as
+// there are more than maxFrames frames or their areas add up to more than maxPixels
+func checkGifFrames(reader *bufio.Reader, maxFrames int, maxPixels int64) error {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return rejectMedia("gif could not be read")
+	}
+	if err := skipGifColorTable(reader, header[10]); err != nil {
+		return err
+	}
+	frames := 0
+	pixels := int64(0)
+	for {
+		blockType, err := reader.ReadByte()
+		if err != nil {
+			return rejectMedia("gif could not be read")
+		}
+		switch blockType {
+		case 0x21: // extension, a label and data sub-blocks
+			if _, err := reader.ReadByte(); err != nil {
+				return rejectMedia("gif could not be read")
+			}
+			if err := skipGifSubBlocks(reader); err != nil {
+				return err
+			}
+		case 0x2c: // image descriptor, an optional color table, the LZW code size and data sub-blocks
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(reader, descriptor); err != nil {
+				return rejectMedia("gif could not be read")
+			}
+			frames++
+			pixels += int64(binary.LittleEndian.Uint16(descriptor[4:6])) * int64(binary.LittleEndian.Uint16(descriptor[6:8]))
+			if frames > maxFrames {
+				return rejectMedia("gif cannot have more than %d frames", maxFrames)
+			}
+			if pixels > maxPixels {
+				return rejectMedia("gif frames cannot add up to more than %d megapixels", maxPixels/1000000)
+			}
+			if err := skipGifColorTable(reader, descriptor[8]); err != nil {
+				return err
+			}
+			if _, err := reader.ReadByte(); err != nil {
+				return rejectMedia("gif could not be read")
+			}
+			if err := skipGifSubBlocks(reader); err != nil {
+				return err
+			}
+		case 0x3b: // trailer
+			return nil
+		default:
+			return rejectMedia("gif could not be read")
+		}
+	}
+}
+
+// skipGifColorTable skips the color table announced by the flags byte of the screen or image descriptor
+func skipGifColorTable(reader *bufio.Reader, flags byte) error {
+	if flags&0x80 == 0 {
+		return nil
+	}
+	if _, err := reader.Discard(3 * (1 << (flags&0x07 + 1))); err != nil {
+		return rejectMedia("gif could not be read")
+	}
+	return nil
+}
+
+func skipGifSubBlocks(reader *bufio.Reader) error {
+	for {
+		size, err := reader.ReadByte()
+		if err != nil {
+			return rejectMedia("gif could not be read")
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := reader.Discard(int(size)); err != nil {
+			return rejectMedia("gif could not be read")
+		}
+	}
+}
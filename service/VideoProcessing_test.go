@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+func encodeTestGif(t *testing.T, frames int, size int, delay int) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+		frame.SetColorIndex(i%size, 0, 1)
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, delay)
+	}
+	var buffer bytes.Buffer
+	if err := gif.EncodeAll(&buffer, animation); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// gifBomb is a few hundred bytes declaring frames of frameSize x frameSize on a canvas of the same size
+func gifBomb(frames int, frameSize uint16) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("GIF89a")
+	binary.Write(&buffer, binary.LittleEndian, [2]uint16{frameSize, frameSize})
+	buffer.Write([]byte{0, 0, 0})
+	for i := 0; i < frames; i++ {
+		buffer.WriteByte(0x2c)
+		binary.Write(&buffer, binary.LittleEndian, [4]uint16{0, 0, frameSize, frameSize})
+		// a two color local table, LZW code size 2 and one tiny data sub-block
+		buffer.Write([]byte{0x80, 0, 0, 0, 255, 255, 255, 2, 2, 0x4c, 0x01, 0})
+	}
+	buffer.WriteByte(0x3b)
+	return buffer.Bytes()
+}
+
+func isRejected(err error) bool {
+	var rejected *mediaRejectedError
+	return errors.As(err, &rejected)
+}
+
+func TestDecodeAnimatedGif(t *testing.T) {
+	animated, err := decodeAnimatedGif(bytes.NewReader(encodeTestGif(t, 3, 16, 50)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if animated.Frames != 3 || animated.Width != 16 || animated.Height != 16 {
+		t.Errorf("got %d frames of %dx%d, want 3 of 16x16", animated.Frames, animated.Width, animated.Height)
+	}
+	if animated.Duration != 1.5 {
+		t.Errorf("got duration %v, want 1.5", animated.Duration)
+	}
+}
+
+func TestDecodeAnimatedGifRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		wantReason string
+	}{
+		{
+			name:       "canvas larger than the dimension limit",
+			data:       gifBomb(1, maxMediaDimension+1),
+			wantReason: "gif must be at most",
+		},
+		{
+			name:       "too many frames",
+			data:       gifBomb(maxGifFrames+1, 1),
+			wantReason: "frames",
+		},
+		{
+			name:       "frames adding up to too many pixels",
+			data:       gifBomb(7, maxMediaDimension),
+			wantReason: "megapixels",
+		},
+		{
+			name:       "longer than the video limit",
+			data:       encodeTestGif(t, 30, 4, 100),
+			wantReason: "longer than",
+		},
+		{
+			name:       "not a gif",
+			data:       []byte("not a gif at all"),
+			wantReason: "could not be read",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeAnimatedGif(bytes.NewReader(test.data), 10)
+			if !isRejected(err) || !strings.Contains(err.Error(), test.wantReason) {
+				t.Errorf("got %v, want a rejection about %q", err, test.wantReason)
+			}
+		})
+	}
+}
+
+func TestCheckGifFramesStopsAtTheLimit(t *testing.T) {
+	// the frame limit is hit long before the reader runs out, the rest of the file is never read
+	data := append(gifBomb(maxGifFrames+1, 1), bytes.Repeat([]byte{0x2c}, 1<<20)...)
+	reader := bytes.NewReader(data)
+	if err := checkGifFrames(bufio.NewReader(reader), maxGifFrames, maxGifFramePixels); !isRejected(err) {
+		t.Fatalf("got %v, want a rejection", err)
+	}
+	if reader.Len() == 0 {
+		t.Error("the whole file was read")
+	}
+}
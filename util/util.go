@@ -1,13 +1,20 @@
 package util
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/tipbk/sneakfeed-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -111,23 +118,42 @@ func GetUserFromContext(c *gin.Context) (*model.User, error) {
 	return value.(*model.User), nil
 }
 
-func ParseStringToTime(s string) (*time.Time, error) {
-	layout := "2006-01-02T15:04:05.000Z"
-	t, err := time.Parse(layout, s)
+var ErrInvalidCursor = errors.New("invalid cursor")
 
-	if err != nil {
-		layout = "2006-01-02T15:04:05.00Z"
-		t, err = time.Parse(layout, s)
-		if err != nil {
-			layout = "2006-01-02T15:04:05.0Z"
-			t, err = time.Parse(layout, s)
-			if err != nil {
-				return nil, err
-			}
-		}
+// EncodeCursor signs the cursor together with the list it belongs to, so clients can only hand back cursors we gave out
+func EncodeCursor(secret string, scope string, cursor model.Cursor) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(cursor.Datetime.UnixMilli(), 10) + ":" + cursor.ID.Hex()))
+	return payload + "." + signCursor(secret, scope, payload)
+}
 
+func DecodeCursor(secret string, scope string, token string) (*model.Cursor, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signCursor(secret, scope, payload))) {
+		return nil, ErrInvalidCursor
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	millis, id, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	unixMilli, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
 	}
-	return &t, err
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &model.Cursor{Datetime: time.UnixMilli(unixMilli), ID: objectID}, nil
+}
+
+func signCursor(secret string, scope string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(scope + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
 
 func ConvertStringToInt(s string) (int, error) {
@@ -137,3 +163,85 @@ func ConvertStringToInt(s string) (int, error) {
 	}
 	return i, nil
 }
+
+// a hashtag must start the content or follow a character that can't be part of a word
+var hashtagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])(#[\p{L}\p{N}_]+)`)
+var numericRegex = regexp.MustCompile(`^[0-9]+$`)
+
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func ExtractHashtagEntities(content string) []model.HashtagEntity {
+	entities := []model.HashtagEntity{}
+	for _, match := range hashtagRegex.FindAllStringSubmatchIndex(content, -1) {
+		tag := NormalizeHashtag(content[match[2]:match[3]])
+		// skip #1 style numbers
+		if numericRegex.MatchString(tag) {
+			continue
+		}
+		entities = append(entities, model.HashtagEntity{
+			Tag:   tag,
+			Start: utf8.RuneCountInString(content[:match[2]]),
+			End:   utf8.RuneCountInString(content[:match[3]]),
+		})
+	}
+	return entities
+}
+
+// ExtractHashtags returns the unique normalized hashtags in content
+func ExtractHashtags(content string) []string {
+	hashtags := []string{}
+	seen := make(map[string]bool)
+	for _, entity := range ExtractHashtagEntities(content) {
+		if seen[entity.Tag] {
+			continue
+		}
+		seen[entity.Tag] = true
+		hashtags = append(hashtags, entity.Tag)
+	}
+	return hashtags
+}
+
+var urlRegex = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// ExtractFirstUrl returns the first http or https link in content without trailing punctuation, or an empty string.
+// A closing paren is only kept when the link opened one, like wikipedia urls.
+func ExtractFirstUrl(content string) string {
+	link := urlRegex.FindString(content)
+	for {
+		trimmed := strings.TrimRight(link, ".,;:!?'\"]}*")
+		if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, ")") > strings.Count(trimmed, "(") {
+			trimmed = trimmed[:len(trimmed)-1]
+		}
+		if trimmed == link {
+			return link
+		}
+		link = trimmed
+	}
+}
+
+// usernames follow the register rule, 5 to 15 letters or numbers. A handle touching a word or another @ on
+// either side, like mail@example or @alice@bobby, is not a mention.
+var mentionRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])(@[0-9A-Za-z]{5,15})(?:[^\p{L}\p{N}_@]|$)`)
+
+// ExtractMentionEntities finds @username handles in content. UserID is left empty for the caller to resolve.
+func ExtractMentionEntities(content string) []model.MentionEntity {
+	entities := []model.MentionEntity{}
+	// the trailing boundary is consumed by each match, so scan from the end of every handle
+	offset := 0
+	for offset < len(content) {
+		match := mentionRegex.FindStringSubmatchIndex(content[offset:])
+		if match == nil {
+			break
+		}
+		start, end := offset+match[2], offset+match[3]
+		entities = append(entities, model.MentionEntity{
+			Username: strings.ToLower(content[start+1 : end]),
+			Start:    utf8.RuneCountInString(content[:start]),
+			End:      utf8.RuneCountInString(content[:end]),
+		})
+		offset = end
+	}
+	return entities
+}
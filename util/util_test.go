@@ -0,0 +1,107 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tipbk/sneakfeed-service/model"
+)
+
+func TestExtractMentionEntities(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []model.MentionEntity
+	}{
+		{
+			name:    "no mentions",
+			content: "hello world",
+			want:    []model.MentionEntity{},
+		},
+		{
+			name:    "at the start and lowercased",
+			content: "@Alice hi",
+			want:    []model.MentionEntity{{Username: "alice", Start: 0, End: 6}},
+		},
+		{
+			name:    "several mentions separated by spaces",
+			content: "hi @alice and @bobby",
+			want: []model.MentionEntity{
+				{Username: "alice", Start: 3, End: 9},
+				{Username: "bobby", Start: 14, End: 20},
+			},
+		},
+		{
+			name:    "mentions separated by a single character",
+			content: "@alice,@bobby",
+			want: []model.MentionEntity{
+				{Username: "alice", Start: 0, End: 6},
+				{Username: "bobby", Start: 7, End: 13},
+			},
+		},
+		{
+			name:    "surrounding punctuation",
+			content: "(@alice) @bobby. @carol! @dave1's",
+			want: []model.MentionEntity{
+				{Username: "alice", Start: 1, End: 7},
+				{Username: "bobby", Start: 9, End: 15},
+				{Username: "carol", Start: 17, End: 23},
+				{Username: "dave1", Start: 25, End: 31},
+			},
+		},
+		{
+			name:    "handles next to another @",
+			content: "@alice@bobby and @@carol and carol@@dave1",
+			want:    []model.MentionEntity{},
+		},
+		{
+			name:    "email addresses",
+			content: "mail me at alice@example.com",
+			want:    []model.MentionEntity{},
+		},
+		{
+			name:    "underscore neighbours",
+			content: "_@alice @bobby_",
+			want:    []model.MentionEntity{},
+		},
+		{
+			name:    "shorter than 5 characters",
+			content: "@abcd",
+			want:    []model.MentionEntity{},
+		},
+		{
+			name:    "exactly 5 and 15 characters",
+			content: "@abcde @abcdefghijklmno",
+			want: []model.MentionEntity{
+				{Username: "abcde", Start: 0, End: 6},
+				{Username: "abcdefghijklmno", Start: 7, End: 23},
+			},
+		},
+		{
+			name:    "longer than 15 characters",
+			content: "@abcdefghijklmnop",
+			want:    []model.MentionEntity{},
+		},
+		{
+			name:    "unicode letters next to a handle",
+			content: "é@alice @bobbyé @carol",
+			want:    []model.MentionEntity{{Username: "carol", Start: 16, End: 22}},
+		},
+		{
+			name:    "offsets count runes",
+			content: "สวัสดี @alice 👋 @bobby",
+			want: []model.MentionEntity{
+				{Username: "alice", Start: 7, End: 13},
+				{Username: "bobby", Start: 16, End: 22},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ExtractMentionEntities(test.content)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ExtractMentionEntities(%q) = %+v, want %+v", test.content, got, test.want)
+			}
+		})
+	}
+}